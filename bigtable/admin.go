@@ -19,6 +19,7 @@ package bigtable
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
 	btopt "cloud.google.com/go/bigtable/internal/option"
@@ -26,7 +27,9 @@ import (
 	"google.golang.org/api/option"
 	"google.golang.org/api/transport"
 	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	"google.golang.org/genproto/googleapis/longrunning"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 )
 
@@ -154,7 +157,14 @@ func (ac *AdminClient) DeleteColumnFamily(ctx context.Context, table, family str
 
 // TableInfo represents information about a table.
 type TableInfo struct {
-	Families []string
+	Families    []string
+	FamilyInfos []FamilyInfo // sorted by name
+}
+
+// FamilyInfo represents information about a column family.
+type FamilyInfo struct {
+	Name     string
+	GCPolicy GCPolicy // NoGCPolicy() if the family has no GC rule
 }
 
 // TableInfo retrieves information about a table.
@@ -169,12 +179,20 @@ func (ac *AdminClient) TableInfo(ctx context.Context, table string) (*TableInfo,
 		return nil, err
 	}
 	ti := &TableInfo{}
-	for fam := range res.ColumnFamilies {
+	for fam, cf := range res.ColumnFamilies {
 		ti.Families = append(ti.Families, fam)
+		ti.FamilyInfos = append(ti.FamilyInfos, FamilyInfo{Name: fam, GCPolicy: gcRuleToPolicy(cf.GcRule)})
 	}
+	sort.Sort(byFamilyName(ti.FamilyInfos))
 	return ti, nil
 }
 
+type byFamilyName []FamilyInfo
+
+func (b byFamilyName) Len() int           { return len(b) }
+func (b byFamilyName) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byFamilyName) Less(i, j int) bool { return b[i].Name < b[j].Name }
+
 // SetGCPolicy specifies which cells in a column family should be garbage collected.
 // GC executes opportunistically in the background; table reads may return data
 // matching the GC policy.
@@ -199,8 +217,9 @@ const instanceAdminAddr = "bigtableadmin.googleapis.com:443"
 // InstanceAdminClient is a client type for performing admin operations on instances.
 // These operations can be substantially more dangerous than those provided by AdminClient.
 type InstanceAdminClient struct {
-	conn    *grpc.ClientConn
-	iClient btapb.BigtableInstanceAdminClient
+	conn      *grpc.ClientConn
+	iClient   btapb.BigtableInstanceAdminClient
+	lroClient longrunning.OperationsClient
 
 	project string
 
@@ -220,8 +239,9 @@ func NewInstanceAdminClient(ctx context.Context, project string, opts ...option.
 		return nil, fmt.Errorf("dialing: %v", err)
 	}
 	return &InstanceAdminClient{
-		conn:    conn,
-		iClient: btapb.NewBigtableInstanceAdminClient(conn),
+		conn:      conn,
+		iClient:   btapb.NewBigtableInstanceAdminClient(conn),
+		lroClient: longrunning.NewOperationsClient(conn),
 
 		project: project,
 		md:      metadata.Pairs(resourcePrefixHeader, "projects/"+project),
@@ -265,3 +285,161 @@ func (cac *InstanceAdminClient) Instances(ctx context.Context) ([]*InstanceInfo,
 	}
 	return is, nil
 }
+
+// StorageType is the type of storage used for all tables in an instance.
+type StorageType int
+
+const (
+	// SSD stores tables on solid-state drives. It is the default.
+	SSD StorageType = iota
+	// HDD stores tables on hard disk drives, which cost less but have
+	// higher latency.
+	HDD
+)
+
+func (st StorageType) proto() btapb.StorageType {
+	if st == HDD {
+		return btapb.StorageType_HDD
+	}
+	return btapb.StorageType_SSD
+}
+
+func (st StorageType) String() string {
+	if st == HDD {
+		return "HDD"
+	}
+	return "SSD"
+}
+
+// InstanceConf contains the information necessary to create an instance
+// with a single cluster.
+type InstanceConf struct {
+	InstanceId, DisplayName string
+	ClusterId, Zone         string // Zone is e.g. "us-central1-b"
+	NumNodes                int32
+	StorageType             StorageType
+}
+
+// CreateInstance creates a new instance in the project, and waits for the
+// creation to finish. This method may return before the instance is ready
+// for use if ctx is done first.
+func (iac *InstanceAdminClient) CreateInstance(ctx context.Context, conf *InstanceConf) error {
+	ctx = metadata.NewContext(ctx, iac.md)
+	req := &btapb.CreateInstanceRequest{
+		Parent:     "projects/" + iac.project,
+		InstanceId: conf.InstanceId,
+		Instance:   &btapb.Instance{DisplayName: conf.DisplayName},
+		Clusters: map[string]*btapb.Cluster{
+			conf.ClusterId: {
+				ServeNodes:         conf.NumNodes,
+				DefaultStorageType: conf.StorageType.proto(),
+				Location:           "projects/" + iac.project + "/locations/" + conf.Zone,
+			},
+		},
+	}
+	op, err := iac.iClient.CreateInstance(ctx, req)
+	if err != nil {
+		return err
+	}
+	return iac.waitForOperation(ctx, op)
+}
+
+// DeleteInstance deletes an instance from the project.
+func (iac *InstanceAdminClient) DeleteInstance(ctx context.Context, instanceId string) error {
+	ctx = metadata.NewContext(ctx, iac.md)
+	req := &btapb.DeleteInstanceRequest{
+		Name: "projects/" + iac.project + "/instances/" + instanceId,
+	}
+	_, err := iac.iClient.DeleteInstance(ctx, req)
+	return err
+}
+
+// ClusterInfo represents information about a cluster.
+type ClusterInfo struct {
+	Name        string      // name of the cluster
+	Zone        string      // GCP zone of the cluster (e.g. "us-central1-a")
+	ServeNodes  int         // number of allocated serve nodes
+	State       string      // state of the cluster
+	StorageType StorageType // storage type of the cluster's tables
+}
+
+var (
+	clusterNameRegexp  = regexp.MustCompile(`^projects/[^/]+/instances/[^/]+/clusters/([^/]+)$`)
+	locationNameRegexp = regexp.MustCompile(`^projects/[^/]+/locations/([^/]+)$`)
+)
+
+// Clusters lists the clusters in an instance.
+func (iac *InstanceAdminClient) Clusters(ctx context.Context, instanceId string) ([]*ClusterInfo, error) {
+	ctx = metadata.NewContext(ctx, iac.md)
+	req := &btapb.ListClustersRequest{
+		Parent: "projects/" + iac.project + "/instances/" + instanceId,
+	}
+	var cis []*ClusterInfo
+	for {
+		res, err := iac.iClient.ListClusters(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range res.Clusters {
+			m := clusterNameRegexp.FindStringSubmatch(c.Name)
+			if m == nil {
+				return nil, fmt.Errorf("malformed cluster name %q", c.Name)
+			}
+			ci := &ClusterInfo{
+				Name:       m[1],
+				Zone:       c.Location,
+				ServeNodes: int(c.ServeNodes),
+				State:      c.State.String(),
+			}
+			if m := locationNameRegexp.FindStringSubmatch(c.Location); m != nil {
+				ci.Zone = m[1]
+			}
+			if c.DefaultStorageType == btapb.StorageType_HDD {
+				ci.StorageType = HDD
+			}
+			cis = append(cis, ci)
+		}
+		if res.NextPageToken == "" {
+			return cis, nil
+		}
+		req.PageToken = res.NextPageToken
+	}
+}
+
+// UpdateCluster sets the number of serve nodes of a cluster, and waits for
+// the update to finish.
+func (iac *InstanceAdminClient) UpdateCluster(ctx context.Context, instanceId, clusterId string, serveNodes int32) error {
+	ctx = metadata.NewContext(ctx, iac.md)
+	cluster := &btapb.Cluster{
+		Name:       "projects/" + iac.project + "/instances/" + instanceId + "/clusters/" + clusterId,
+		ServeNodes: serveNodes,
+	}
+	op, err := iac.iClient.UpdateCluster(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	return iac.waitForOperation(ctx, op)
+}
+
+// waitForOperation polls the long-running operation op until it is done,
+// and returns the operation's error, if any.
+func (iac *InstanceAdminClient) waitForOperation(ctx context.Context, op *longrunning.Operation) error {
+	var bo backoff
+	for !op.Done {
+		if err := bo.sleep(ctx); err != nil {
+			return err
+		}
+		res, err := iac.lroClient.GetOperation(ctx, &longrunning.GetOperationRequest{Name: op.Name})
+		if err != nil {
+			if isRetryable(err) {
+				continue
+			}
+			return err
+		}
+		op = res
+	}
+	if r, ok := op.Result.(*longrunning.Operation_Error); ok {
+		return grpc.Errorf(codes.Code(r.Error.Code), "%s", r.Error.Message)
+	}
+	return nil
+}
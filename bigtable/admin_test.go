@@ -15,15 +15,23 @@
 package bigtable
 
 import (
+	"net"
 	"reflect"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"cloud.google.com/go/bigtable/bttest"
+	emptypb "github.com/golang/protobuf/ptypes/empty"
 	"golang.org/x/net/context"
 	"google.golang.org/api/option"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	"google.golang.org/genproto/googleapis/longrunning"
+	rpcpb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 )
 
 func TestAdminIntegration(t *testing.T) {
@@ -71,3 +79,291 @@ func TestAdminIntegration(t *testing.T) {
 		t.Errorf("adminClient.Tables returned %#v, want %#v", got, want)
 	}
 }
+
+// fakeInstanceAdminServer is a BigtableInstanceAdminServer whose operations
+// finish after being polled once.
+type fakeInstanceAdminServer struct {
+	btapb.BigtableInstanceAdminServer // unimplemented methods panic
+	longrunning.OperationsServer
+
+	mu        sync.Mutex
+	clusters  map[string]*btapb.Cluster // keyed by full name
+	deleted   []string
+	polls     int
+	failNodes int32 // UpdateCluster fails for this node count
+}
+
+func (s *fakeInstanceAdminServer) CreateInstance(ctx context.Context, req *btapb.CreateInstanceRequest) (*longrunning.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, c := range req.Clusters {
+		c.Name = req.Parent + "/instances/" + req.InstanceId + "/clusters/" + id
+		c.State = btapb.Cluster_READY
+		s.clusters[c.Name] = c
+	}
+	return &longrunning.Operation{Name: "operations/create"}, nil
+}
+
+func (s *fakeInstanceAdminServer) DeleteInstance(ctx context.Context, req *btapb.DeleteInstanceRequest) (*emptypb.Empty, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleted = append(s.deleted, req.Name)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *fakeInstanceAdminServer) ListClusters(ctx context.Context, req *btapb.ListClustersRequest) (*btapb.ListClustersResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := &btapb.ListClustersResponse{}
+	for name, c := range s.clusters {
+		if strings.HasPrefix(name, req.Parent+"/") {
+			res.Clusters = append(res.Clusters, c)
+		}
+	}
+	return res, nil
+}
+
+func (s *fakeInstanceAdminServer) UpdateCluster(ctx context.Context, req *btapb.Cluster) (*longrunning.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if req.ServeNodes == s.failNodes {
+		return &longrunning.Operation{
+			Name:   "operations/update",
+			Done:   true,
+			Result: &longrunning.Operation_Error{Error: &rpcpb.Status{Code: int32(codes.ResourceExhausted), Message: "no quota"}},
+		}, nil
+	}
+	c, ok := s.clusters[req.Name]
+	if !ok {
+		return nil, grpc.Errorf(codes.NotFound, "no cluster %q", req.Name)
+	}
+	c.ServeNodes = req.ServeNodes
+	return &longrunning.Operation{Name: "operations/update"}, nil
+}
+
+func (s *fakeInstanceAdminServer) GetOperation(ctx context.Context, req *longrunning.GetOperationRequest) (*longrunning.Operation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.polls++
+	return &longrunning.Operation{Name: req.Name, Done: true}, nil
+}
+
+func TestInstanceAdmin(t *testing.T) {
+	srv := &fakeInstanceAdminServer{clusters: make(map[string]*btapb.Cluster), failNodes: 100}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsrv := grpc.NewServer()
+	btapb.RegisterBigtableInstanceAdminServer(gsrv, srv)
+	longrunning.RegisterOperationsServer(gsrv, srv)
+	go gsrv.Serve(l)
+	defer gsrv.Stop()
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	iac, err := NewInstanceAdminClient(context.Background(), "proj", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer iac.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = iac.CreateInstance(ctx, &InstanceConf{
+		InstanceId:  "inst",
+		DisplayName: "My instance",
+		ClusterId:   "inst-c1",
+		Zone:        "us-central1-b",
+		NumNodes:    3,
+		StorageType: HDD,
+	})
+	if err != nil {
+		t.Fatalf("CreateInstance: %v", err)
+	}
+	srv.mu.Lock()
+	polls := srv.polls
+	srv.mu.Unlock()
+	if polls != 1 {
+		t.Errorf("CreateInstance polled the operation %d times, want 1", polls)
+	}
+
+	if err := iac.UpdateCluster(ctx, "inst", "inst-c1", 5); err != nil {
+		t.Fatalf("UpdateCluster: %v", err)
+	}
+	cis, err := iac.Clusters(ctx, "inst")
+	if err != nil {
+		t.Fatalf("Clusters: %v", err)
+	}
+	want := []*ClusterInfo{{Name: "inst-c1", Zone: "us-central1-b", ServeNodes: 5, State: "READY", StorageType: HDD}}
+	if !reflect.DeepEqual(cis, want) {
+		t.Errorf("Clusters = %+v, want %+v", cis[0], want[0])
+	}
+
+	err = iac.UpdateCluster(ctx, "inst", "inst-c1", 100)
+	if grpc.Code(err) != codes.ResourceExhausted {
+		t.Errorf("UpdateCluster with a failing operation: got error %v, want code %v", err, codes.ResourceExhausted)
+	}
+
+	if err := iac.DeleteInstance(ctx, "inst"); err != nil {
+		t.Fatalf("DeleteInstance: %v", err)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if want := []string{"projects/proj/instances/inst"}; !reflect.DeepEqual(srv.deleted, want) {
+		t.Errorf("deleted instances %q, want %q", srv.deleted, want)
+	}
+}
+
+func TestGCRuleToPolicy(t *testing.T) {
+	for _, p := range []GCPolicy{
+		NoGCPolicy(),
+		MaxVersionsPolicy(3),
+		MaxAgePolicy(72 * time.Hour),
+		MaxAgePolicy(1500 * time.Millisecond),
+		UnionPolicy(MaxVersionsPolicy(10), MaxAgePolicy(time.Hour)),
+		IntersectionPolicy(MaxVersionsPolicy(1), UnionPolicy(MaxAgePolicy(time.Minute), MaxVersionsPolicy(5))),
+	} {
+		if got := gcRuleToPolicy(p.proto()); got.String() != p.String() {
+			t.Errorf("gcRuleToPolicy(%v.proto()) = %v", p, got)
+		}
+	}
+	if got := gcRuleToPolicy(nil); got.String() != "" {
+		t.Errorf("gcRuleToPolicy(nil) = %v, want no policy", got)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	srv, err := bttest.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ac, err := NewAdminClient(ctx, "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ac.Close()
+
+	// An existing table with a family to keep, one to change and one to prune.
+	if err := ac.CreateTable(ctx, "users"); err != nil {
+		t.Fatal(err)
+	}
+	for _, fam := range []string{"keep", "change", "extra"} {
+		if err := ac.CreateColumnFamily(ctx, "users", fam); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ac.SetGCPolicy(ctx, "users", "change", MaxVersionsPolicy(1)); err != nil {
+		t.Fatal(err)
+	}
+
+	schema := Schema{
+		"users": {
+			"keep":   nil,
+			"change": UnionPolicy(MaxVersionsPolicy(2), MaxAgePolicy(24*time.Hour)),
+			"new":    MaxVersionsPolicy(5),
+		},
+		"events": {
+			"e": MaxAgePolicy(time.Hour),
+		},
+	}
+	changes, err := ac.DiffSchema(ctx, schema, PruneFamilies())
+	if err != nil {
+		t.Fatalf("DiffSchema: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"create table events",
+		"create family events:e with GC policy age() > 1h",
+		"change GC policy of users:change from versions() > 1 to (versions() > 2 || age() > 1d)",
+		"delete family users:extra",
+		"create family users:new with GC policy versions() > 5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("DiffSchema changes:\ngot  %q\nwant %q", got, want)
+	}
+
+	if err := ac.ApplySchema(ctx, changes); err != nil {
+		t.Fatalf("ApplySchema: %v", err)
+	}
+	changes, err = ac.DiffSchema(ctx, schema, PruneFamilies())
+	if err != nil {
+		t.Fatalf("DiffSchema after ApplySchema: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("DiffSchema after ApplySchema returned changes %v", changes)
+	}
+
+	ti, err := ac.TableInfo(ctx, "users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fams []string
+	for _, fi := range ti.FamilyInfos {
+		fams = append(fams, fi.Name+"="+fi.GCPolicy.String())
+	}
+	if want := []string{"change=(versions() > 2 || age() > 1d)", "keep=", "new=versions() > 5"}; !reflect.DeepEqual(fams, want) {
+		t.Errorf("TableInfo families = %q, want %q", fams, want)
+	}
+
+	// Without PruneFamilies, unlisted families are left alone.
+	if err := ac.CreateColumnFamily(ctx, "users", "extra"); err != nil {
+		t.Fatal(err)
+	}
+	if changes, err := ac.DiffSchema(ctx, schema); err != nil || len(changes) != 0 {
+		t.Errorf("DiffSchema without PruneFamilies = %v, %v; want no changes", changes, err)
+	}
+
+	// The members of a union may be listed in any order.
+	schema["users"]["change"] = UnionPolicy(MaxAgePolicy(24*time.Hour), MaxVersionsPolicy(2))
+	if changes, err := ac.DiffSchema(ctx, schema); err != nil || len(changes) != 0 {
+		t.Errorf("DiffSchema with reordered union = %v, %v; want no changes", changes, err)
+	}
+}
+
+func TestEqualGCPolicies(t *testing.T) {
+	for _, test := range []struct {
+		a, b GCPolicy
+		want bool
+	}{
+		{NoGCPolicy(), NoGCPolicy(), true},
+		{MaxVersionsPolicy(1), MaxVersionsPolicy(1), true},
+		{MaxVersionsPolicy(1), MaxVersionsPolicy(2), false},
+		{MaxAgePolicy(time.Hour), MaxAgePolicy(60 * time.Minute), true},
+		{MaxVersionsPolicy(1), NoGCPolicy(), false},
+		{
+			UnionPolicy(MaxVersionsPolicy(1), IntersectionPolicy(MaxAgePolicy(time.Hour), MaxVersionsPolicy(3))),
+			UnionPolicy(IntersectionPolicy(MaxVersionsPolicy(3), MaxAgePolicy(time.Hour)), MaxVersionsPolicy(1)),
+			true,
+		},
+		{
+			UnionPolicy(MaxVersionsPolicy(1), MaxAgePolicy(time.Hour)),
+			IntersectionPolicy(MaxVersionsPolicy(1), MaxAgePolicy(time.Hour)),
+			false,
+		},
+	} {
+		if got := equalGCPolicies(test.a, test.b); got != test.want {
+			t.Errorf("equalGCPolicies(%v, %v) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+	for _, p := range []GCPolicy{nil, NoGCPolicy()} {
+		if !isNoGCPolicy(p) {
+			t.Errorf("isNoGCPolicy(%v) = false, want true", p)
+		}
+	}
+	if isNoGCPolicy(MaxVersionsPolicy(1)) {
+		t.Error("isNoGCPolicy(MaxVersionsPolicy(1)) = true, want false")
+	}
+}
@@ -0,0 +1,234 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/internal/bundler"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultBatchDelayThreshold is the default value for BatchWriterSettings.DelayThreshold.
+	DefaultBatchDelayThreshold = time.Second
+
+	// DefaultBatchCountThreshold is the default value for BatchWriterSettings.CountThreshold.
+	DefaultBatchCountThreshold = 100
+
+	// DefaultBatchByteThreshold is the default value for BatchWriterSettings.ByteThreshold.
+	DefaultBatchByteThreshold = 1e6 // 1M
+
+	// DefaultBatchBufferedByteLimit is the default value for BatchWriterSettings.BufferedByteLimit.
+	DefaultBatchBufferedByteLimit = 1e8 // 100M
+)
+
+// ErrBatchWriterClosed is returned by BatchWriter.Add after the BatchWriter has been closed.
+var ErrBatchWriterClosed = errors.New("bigtable: BatchWriter is closed")
+
+// BatchWriterSettings configures a BatchWriter.
+// The zero value of each field means to use its default.
+type BatchWriterSettings struct {
+	// Once this delay has passed since the first mutation was added
+	// to a batch, the batch is applied.
+	DelayThreshold time.Duration
+
+	// Once a batch has this many mutations, it is applied.
+	CountThreshold int
+
+	// Once the mutations in a batch reach this many bytes, it is applied.
+	ByteThreshold int
+
+	// The maximum number of bytes of mutations that may be buffered or
+	// being applied at once. When it is reached, Add blocks until earlier
+	// batches have been applied.
+	BufferedByteLimit int
+
+	// OnError, if not nil, is called with the row key and error of each
+	// mutation that fails to apply. Calls are made serially.
+	OnError func(rowKey string, err error)
+}
+
+// A BatchWriter buffers mutations, and applies them to a table in bulk
+// once a batch is large enough or old enough.
+// Mutations are applied with ApplyBulk, so transient failures are retried.
+//
+// A BatchWriter is safe to use concurrently.
+type BatchWriter struct {
+	ctx      context.Context
+	t        *Table
+	onError  func(rowKey string, err error)
+	bundler  *bundler.Bundler
+	maxBytes int
+
+	mu     sync.Mutex
+	bytes  int           // bytes of mutations that are buffered or being applied
+	spacec chan struct{} // closed and re-created when bytes decreases
+	closed bool
+}
+
+// batchEntry is a mutation waiting in a BatchWriter.
+type batchEntry struct {
+	rowKey string
+	mut    *Mutation
+	size   int
+}
+
+// NewBatchWriter returns a BatchWriter that applies mutations to the table.
+// ctx is used for applying mutations; Close must be called when the
+// BatchWriter is no longer needed.
+// A nil settings uses the defaults.
+func (t *Table) NewBatchWriter(ctx context.Context, settings *BatchWriterSettings) *BatchWriter {
+	var s BatchWriterSettings
+	if settings != nil {
+		s = *settings
+	}
+	if s.DelayThreshold == 0 {
+		s.DelayThreshold = DefaultBatchDelayThreshold
+	}
+	if s.CountThreshold == 0 {
+		s.CountThreshold = DefaultBatchCountThreshold
+	}
+	if s.ByteThreshold == 0 {
+		s.ByteThreshold = DefaultBatchByteThreshold
+	}
+	if s.BufferedByteLimit == 0 {
+		s.BufferedByteLimit = DefaultBatchBufferedByteLimit
+	}
+
+	w := &BatchWriter{
+		ctx:      ctx,
+		t:        t,
+		onError:  s.OnError,
+		maxBytes: s.BufferedByteLimit,
+		spacec:   make(chan struct{}),
+	}
+	w.bundler = bundler.NewBundler(&batchEntry{}, func(entries interface{}) {
+		w.apply(entries.([]*batchEntry))
+	})
+	w.bundler.DelayThreshold = s.DelayThreshold
+	w.bundler.BundleCountThreshold = s.CountThreshold
+	w.bundler.BundleByteThreshold = s.ByteThreshold
+	// The BatchWriter does its own flow control in Add, so the bundler
+	// must never reject a mutation.
+	w.bundler.BufferedByteLimit = math.MaxInt32
+	return w
+}
+
+// Add adds a mutation of the given row to the current batch.
+// The mutation is applied asynchronously; failures are reported to
+// the OnError function of the BatchWriter's settings.
+//
+// If the BatchWriter's buffer is full, Add blocks until there is room,
+// or until ctx is done, in which case it returns ctx.Err().
+// Conditional mutations cannot be batched, and result in an error.
+func (w *BatchWriter) Add(ctx context.Context, rowKey string, m *Mutation) error {
+	if m.cond != nil {
+		return errors.New("bigtable: conditional mutations cannot be applied in bulk")
+	}
+	size := len(rowKey)
+	for _, op := range m.ops {
+		size += proto.Size(op)
+	}
+	if err := w.reserve(ctx, size); err != nil {
+		return err
+	}
+	if err := w.bundler.Add(&batchEntry{rowKey: rowKey, mut: m, size: size}, size); err != nil {
+		w.release(size)
+		return err
+	}
+	return nil
+}
+
+// reserve waits until size bytes can be buffered, and accounts for them.
+// A mutation larger than the limit is allowed when nothing else is buffered,
+// so that it can still be applied.
+func (w *BatchWriter) reserve(ctx context.Context, size int) error {
+	for {
+		w.mu.Lock()
+		if w.closed {
+			w.mu.Unlock()
+			return ErrBatchWriterClosed
+		}
+		if w.bytes == 0 || w.bytes+size <= w.maxBytes {
+			w.bytes += size
+			w.mu.Unlock()
+			return nil
+		}
+		spacec := w.spacec
+		w.mu.Unlock()
+
+		select {
+		case <-spacec:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release gives back buffer space reserved by reserve.
+func (w *BatchWriter) release(size int) {
+	w.mu.Lock()
+	w.bytes -= size
+	close(w.spacec)
+	w.spacec = make(chan struct{})
+	w.mu.Unlock()
+}
+
+// apply applies a batch of mutations, reporting any failures.
+func (w *BatchWriter) apply(entries []*batchEntry) {
+	rowKeys := make([]string, len(entries))
+	muts := make([]*Mutation, len(entries))
+	size := 0
+	for i, e := range entries {
+		rowKeys[i] = e.rowKey
+		muts[i] = e.mut
+		size += e.size
+	}
+	defer w.release(size)
+
+	errs, err := w.t.ApplyBulk(w.ctx, rowKeys, muts)
+	if w.onError == nil {
+		return
+	}
+	for i, key := range rowKeys {
+		if err != nil {
+			w.onError(key, err)
+		} else if errs != nil && errs[i] != nil {
+			w.onError(key, errs[i])
+		}
+	}
+}
+
+// Flush waits until all mutations added so far have been applied.
+func (w *BatchWriter) Flush() {
+	w.bundler.Flush()
+}
+
+// Close applies all outstanding mutations and shuts down the BatchWriter.
+// Calls to Add after Close return ErrBatchWriterClosed.
+// Close must not be called concurrently with Add.
+func (w *BatchWriter) Close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.bundler.Close()
+}
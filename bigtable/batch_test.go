@@ -0,0 +1,103 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+func TestBatchWriter(t *testing.T) {
+	srv := &failingServer{
+		mutateFailures: []map[string]codes.Code{
+			nil,
+			{"c": codes.InvalidArgument},
+		},
+	}
+	tbl, cleanup := setupFailingServer(t, srv)
+	defer cleanup()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	failed := make(map[string]codes.Code)
+	w := tbl.NewBatchWriter(ctx, &BatchWriterSettings{
+		CountThreshold: 2,
+		DelayThreshold: time.Hour,
+		OnError: func(rowKey string, err error) {
+			failed[rowKey] = grpc.Code(err)
+		},
+	})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		m := NewMutation()
+		m.Set("fam", "col", 1000, []byte(key))
+		if err := w.Add(ctx, key, m); err != nil {
+			t.Fatalf("Add(%q): %v", key, err)
+		}
+	}
+	w.Close()
+
+	var got [][]string
+	for _, req := range srv.mutateReqs {
+		var keys []string
+		for _, entry := range req.Entries {
+			keys = append(keys, string(entry.RowKey))
+		}
+		got = append(got, keys)
+	}
+	if want := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got batches %v, want %v", got, want)
+	}
+	if want := map[string]codes.Code{"c": codes.InvalidArgument}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("got failures %v, want %v", failed, want)
+	}
+	if err := w.Add(ctx, "f", NewMutation()); err != ErrBatchWriterClosed {
+		t.Errorf("Add after Close: got %v, want ErrBatchWriterClosed", err)
+	}
+}
+
+func TestBatchWriterFlowControl(t *testing.T) {
+	srv := &failingServer{}
+	tbl, cleanup := setupFailingServer(t, srv)
+	defer cleanup()
+	ctx := context.Background()
+
+	m := NewMutation()
+	m.Set("fam", "col", 1000, make([]byte, 100))
+	w := tbl.NewBatchWriter(ctx, &BatchWriterSettings{
+		DelayThreshold:    time.Hour,
+		BufferedByteLimit: 150,
+	})
+	defer w.Close()
+	if err := w.Add(ctx, "a", m); err != nil {
+		t.Fatal(err)
+	}
+	// The buffer is full until the first batch is applied, so Add blocks.
+	tctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := w.Add(tctx, "b", m); err != context.DeadlineExceeded {
+		t.Fatalf("Add with full buffer: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	w.Flush()
+	if err := w.Add(ctx, "b", m); err != nil {
+		t.Errorf("Add after Flush: %v", err)
+	}
+}
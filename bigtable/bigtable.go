@@ -43,6 +43,8 @@ type Client struct {
 	client btpb.BigtableClient
 
 	project, instance string
+
+	stats StatsHandler // may be nil
 }
 
 // NewClient creates a new Client for a given project and instance.
@@ -102,15 +104,75 @@ func (c *Client) Open(table string) *Table {
 //
 // By default, the yielded rows will contain all values in all cells.
 // Use RowFilter to limit the cells returned.
-func (t *Table) ReadRows(ctx context.Context, arg RowSet, f func(Row) bool, opts ...ReadOption) error {
+//
+// If the read fails with a transient error, ReadRows retries with backoff,
+// resuming after the last row passed to f, so f never sees a row twice.
+// It gives up when ctx is done, or after many attempts in a row that read
+// no rows, returning the last error.
+//
+// If arg covers no rows, as an empty RowList does, ReadRows reads nothing
+// and makes no request.
+func (t *Table) ReadRows(ctx context.Context, arg RowSet, f func(Row) bool, opts ...ReadOption) (err error) {
+	cs := t.startCall("ReadRows")
+	defer func() { t.endCall(ctx, cs, err) }()
+	return t.retryReadRows(ctx, arg, f, cs, opts...)
+}
+
+// retryReadRows implements ReadRows, recording stats in cs.
+func (t *Table) retryReadRows(ctx context.Context, arg RowSet, f func(Row) bool, cs *CallStats, opts ...ReadOption) error {
 	ctx = metadata.NewContext(ctx, t.md)
-	req := &btpb.ReadRowsRequest{
-		TableName: t.c.fullTableName(t.table),
-		Rows:      arg.proto(),
-	}
-	for _, opt := range opts {
-		opt.set(req)
+
+	var (
+		prevRowKey string // key of the last row passed to f
+		rowsRead   int64
+		bo         backoff
+	)
+	for {
+		if !arg.valid() {
+			return nil
+		}
+		req := &btpb.ReadRowsRequest{
+			TableName: t.c.fullTableName(t.table),
+			Rows:      arg.proto(),
+		}
+		for _, opt := range opts {
+			opt.set(req)
+		}
+		if req.RowsLimit > 0 {
+			// Only read the rows that earlier attempts have not.
+			if rowsRead >= req.RowsLimit {
+				return nil
+			}
+			req.RowsLimit -= rowsRead
+		}
+
+		prevRowsRead := rowsRead
+		cs.attempt()
+		err := t.readRows(ctx, req, func(r Row) bool {
+			prevRowKey = r.Key()
+			rowsRead++
+			cs.addRow(r)
+			return f(r)
+		})
+		if err == nil || !isRetryable(err) {
+			return err
+		}
+		if rowsRead > prevRowsRead {
+			// The attempt made progress, so start backing off afresh.
+			bo = backoff{}
+		}
+		if bo.retry(ctx) != nil {
+			return err
+		}
+		if rowsRead > 0 {
+			arg = arg.retainRowsAfter(prevRowKey)
+		}
 	}
+}
+
+// readRows makes a single ReadRows RPC, passing each row to f.
+// It returns nil if the stream completes or if f returns false.
+func (t *Table) readRows(ctx context.Context, req *btpb.ReadRowsRequest, f func(Row) bool) error {
 	ctx, cancel := context.WithCancel(ctx) // for aborting the stream
 	defer cancel()
 
@@ -156,15 +218,67 @@ func (t *Table) ReadRows(ctx context.Context, arg RowSet, f func(Row) bool, opts
 
 // ReadRow is a convenience implementation of a single-row reader.
 // A missing row will return a zero-length map and a nil error.
-func (t *Table) ReadRow(ctx context.Context, row string, opts ...ReadOption) (Row, error) {
-	var r Row
-	err := t.ReadRows(ctx, SingleRow(row), func(rr Row) bool {
+func (t *Table) ReadRow(ctx context.Context, row string, opts ...ReadOption) (r Row, err error) {
+	cs := t.startCall("ReadRow")
+	defer func() { t.endCall(ctx, cs, err) }()
+	err = t.retryReadRows(ctx, SingleRow(row), func(rr Row) bool {
 		r = rr
 		return true
-	}, opts...)
+	}, cs, opts...)
 	return r, err
 }
 
+// A RowKeySample is a sample of a table's row keys, returned by SampleRowKeys.
+type RowKeySample struct {
+	// Key is a row key in the table. The last sample of a table
+	// has an empty key, representing the end of the table.
+	Key string
+
+	// OffsetBytes is the approximate total size of all the rows in the
+	// table that precede Key.
+	OffsetBytes int64
+}
+
+// SampleRowKeys returns a sample of the row keys in the table, in ascending
+// order. The keys delimit contiguous sections of the table of approximately
+// equal size, which can be used to split the table for parallel processing.
+// See RangesFromSamples and ScanParallel.
+func (t *Table) SampleRowKeys(ctx context.Context) (samples []RowKeySample, err error) {
+	cs := t.startCall("SampleRowKeys")
+	defer func() { t.endCall(ctx, cs, err) }()
+	ctx = metadata.NewContext(ctx, t.md)
+	req := &btpb.SampleRowKeysRequest{TableName: t.c.fullTableName(t.table)}
+	var bo backoff
+	for {
+		cs.attempt()
+		samples, err := t.sampleRowKeys(ctx, req)
+		if err == nil || !isRetryable(err) {
+			return samples, err
+		}
+		if bo.sleep(ctx) != nil {
+			return nil, err
+		}
+	}
+}
+
+func (t *Table) sampleRowKeys(ctx context.Context, req *btpb.SampleRowKeysRequest) ([]RowKeySample, error) {
+	stream, err := t.c.client.SampleRowKeys(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	var samples []RowKeySample
+	for {
+		res, err := stream.Recv()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, RowKeySample{Key: string(res.RowKey), OffsetBytes: res.OffsetBytes})
+	}
+}
+
 // decodeFamilyProto adds the cell data from f to the given row.
 func decodeFamilyProto(r Row, row string, f *btpb.Family) {
 	fam := f.Name // does not have colon
@@ -181,9 +295,19 @@ func decodeFamilyProto(r Row, row string, f *btpb.Family) {
 	}
 }
 
-// RowSet is a set of rows to be read. It is satisfied by RowList and RowRange.
+// RowSet is a set of rows to be read.
+// It is satisfied by RowList, RowRange, RowRangeList and RowSetList.
+// An empty RowList, RowRangeList or RowSetList, or a RowRange that contains
+// no keys, covers no rows, rather than the whole table.
 type RowSet interface {
 	proto() *btpb.RowSet
+
+	// retainRowsAfter returns a new RowSet that does not include the
+	// given row key or any row key lexicographically less than it.
+	retainRowsAfter(lastRowKey string) RowSet
+
+	// valid reports whether this set can cover at least one row.
+	valid() bool
 }
 
 // RowList is a sequence of row keys.
@@ -197,13 +321,33 @@ func (r RowList) proto() *btpb.RowSet {
 	return &btpb.RowSet{RowKeys: keys}
 }
 
+func (r RowList) retainRowsAfter(lastRowKey string) RowSet {
+	var retained RowList
+	for _, key := range r {
+		if key > lastRowKey {
+			retained = append(retained, key)
+		}
+	}
+	return retained
+}
+
+func (r RowList) valid() bool {
+	return len(r) > 0
+}
+
 // A RowRange is a half-open interval [Start, Limit) encompassing
 // all the rows with keys at least as large as Start, and less than Limit.
 // (Bigtable string comparison is the same as Go's.)
 // A RowRange can be unbounded, encompassing all keys at least as large as Start.
+//
+// NewOpenRange, NewClosedRange and NewOpenClosedRange return ranges that
+// exclude Start or include Limit instead.
 type RowRange struct {
 	start string
 	limit string
+
+	startOpen   bool // whether start is excluded from the range
+	limitClosed bool // whether limit is included in the range
 }
 
 // NewRange returns the new RowRange [begin, end).
@@ -214,6 +358,34 @@ func NewRange(begin, end string) RowRange {
 	}
 }
 
+// NewOpenClosedRange returns the new RowRange (begin, end].
+func NewOpenClosedRange(begin, end string) RowRange {
+	return RowRange{
+		start:       begin,
+		limit:       end,
+		startOpen:   true,
+		limitClosed: true,
+	}
+}
+
+// NewOpenRange returns the new RowRange (begin, end).
+func NewOpenRange(begin, end string) RowRange {
+	return RowRange{
+		start:     begin,
+		limit:     end,
+		startOpen: true,
+	}
+}
+
+// NewClosedRange returns the new RowRange [begin, end].
+func NewClosedRange(begin, end string) RowRange {
+	return RowRange{
+		start:       begin,
+		limit:       end,
+		limitClosed: true,
+	}
+}
+
 // Unbounded tests whether a RowRange is unbounded.
 func (r RowRange) Unbounded() bool {
 	return r.limit == ""
@@ -221,25 +393,138 @@ func (r RowRange) Unbounded() bool {
 
 // Contains says whether the RowRange contains the key.
 func (r RowRange) Contains(row string) bool {
-	return r.start <= row && (r.limit == "" || r.limit > row)
+	if r.startOpen && row <= r.start || row < r.start {
+		return false
+	}
+	if r.Unbounded() {
+		return true
+	}
+	if r.limitClosed {
+		return row <= r.limit
+	}
+	return row < r.limit
 }
 
 // String provides a printable description of a RowRange.
 func (r RowRange) String() string {
+	lb := "["
+	if r.startOpen {
+		lb = "("
+	}
 	a := strconv.Quote(r.start)
 	if r.Unbounded() {
-		return fmt.Sprintf("[%s,∞)", a)
+		return fmt.Sprintf("%s%s,∞)", lb, a)
+	}
+	rb := ")"
+	if r.limitClosed {
+		rb = "]"
 	}
-	return fmt.Sprintf("[%s,%q)", a, r.limit)
+	return fmt.Sprintf("%s%s,%q%s", lb, a, r.limit, rb)
 }
 
 func (r RowRange) proto() *btpb.RowSet {
-	var rr *btpb.RowRange
-	rr = &btpb.RowRange{StartKey: &btpb.RowRange_StartKeyClosed{StartKeyClosed: []byte(r.start)}}
+	return &btpb.RowSet{RowRanges: []*btpb.RowRange{r.rangeProto()}}
+}
+
+// rangeProto returns the RowRange as a *btpb.RowRange.
+func (r RowRange) rangeProto() *btpb.RowRange {
+	rr := &btpb.RowRange{}
+	if r.startOpen {
+		rr.StartKey = &btpb.RowRange_StartKeyOpen{StartKeyOpen: []byte(r.start)}
+	} else {
+		rr.StartKey = &btpb.RowRange_StartKeyClosed{StartKeyClosed: []byte(r.start)}
+	}
 	if !r.Unbounded() {
-		rr.EndKey = &btpb.RowRange_EndKeyOpen{EndKeyOpen: []byte(r.limit)}
+		if r.limitClosed {
+			rr.EndKey = &btpb.RowRange_EndKeyClosed{EndKeyClosed: []byte(r.limit)}
+		} else {
+			rr.EndKey = &btpb.RowRange_EndKeyOpen{EndKeyOpen: []byte(r.limit)}
+		}
+	}
+	return rr
+}
+
+func (r RowRange) retainRowsAfter(lastRowKey string) RowSet {
+	if lastRowKey < r.start {
+		return r
+	}
+	// Start just after lastRowKey, which has already been read.
+	r.start = lastRowKey
+	r.startOpen = true
+	return r
+}
+
+func (r RowRange) valid() bool {
+	if r.Unbounded() || r.start < r.limit {
+		return true
+	}
+	return r.start == r.limit && !r.startOpen && r.limitClosed
+}
+
+// RowRangeList is a sequence of RowRanges, representing the union of the ranges.
+// The ranges may overlap; each row is read at most once.
+type RowRangeList []RowRange
+
+func (r RowRangeList) proto() *btpb.RowSet {
+	ranges := make([]*btpb.RowRange, len(r))
+	for i, rr := range r {
+		ranges[i] = rr.rangeProto()
+	}
+	return &btpb.RowSet{RowRanges: ranges}
+}
+
+func (r RowRangeList) retainRowsAfter(lastRowKey string) RowSet {
+	var retained RowRangeList
+	for _, rr := range r {
+		if nr := rr.retainRowsAfter(lastRowKey).(RowRange); nr.valid() {
+			retained = append(retained, nr)
+		}
+	}
+	return retained
+}
+
+func (r RowRangeList) valid() bool {
+	for _, rr := range r {
+		if rr.valid() {
+			return true
+		}
+	}
+	return false
+}
+
+// RowSetList is a sequence of RowSets, representing their union.
+// It can be used to read a mix of individual rows and row ranges in one call,
+// for example RowSetList{RowList{"a", "c"}, PrefixRange("x")}.
+// Each row is read at most once.
+type RowSetList []RowSet
+
+func (r RowSetList) proto() *btpb.RowSet {
+	rs := &btpb.RowSet{}
+	for _, s := range r {
+		p := s.proto()
+		rs.RowKeys = append(rs.RowKeys, p.RowKeys...)
+		rs.RowRanges = append(rs.RowRanges, p.RowRanges...)
+	}
+	return rs
+}
+
+func (r RowSetList) retainRowsAfter(lastRowKey string) RowSet {
+	var retained RowSetList
+	for _, s := range r {
+		if ns := s.retainRowsAfter(lastRowKey); ns.valid() {
+			retained = append(retained, ns)
+		}
+	}
+	return retained
+}
+
+func (r RowSetList) valid() bool {
+	for _, s := range r {
+		if s.valid() {
+			return true
+		}
 	}
-	return &btpb.RowSet{RowRanges: []*btpb.RowRange{rr}}
+	return false
 }
 
 // SingleRow returns a RowRange for reading a single row.
@@ -305,7 +590,9 @@ type limitRows struct{ limit int64 }
 func (lr limitRows) set(req *btpb.ReadRowsRequest) { req.RowsLimit = lr.limit }
 
 // Apply applies a Mutation to a specific row.
-func (t *Table) Apply(ctx context.Context, row string, m *Mutation, opts ...ApplyOption) error {
+func (t *Table) Apply(ctx context.Context, row string, m *Mutation, opts ...ApplyOption) (err error) {
+	cs := t.startCall("Apply")
+	defer func() { t.endCall(ctx, cs, err) }()
 	ctx = metadata.NewContext(ctx, t.md)
 	after := func(res proto.Message) {
 		for _, o := range opts {
@@ -313,6 +600,8 @@ func (t *Table) Apply(ctx context.Context, row string, m *Mutation, opts ...Appl
 		}
 	}
 
+	cs.attempt()
+
 	if m.cond == nil {
 		req := &btpb.MutateRowRequest{
 			TableName: t.c.fullTableName(t.table),
@@ -321,6 +610,7 @@ func (t *Table) Apply(ctx context.Context, row string, m *Mutation, opts ...Appl
 		}
 		res, err := t.c.client.MutateRow(ctx, req)
 		if err == nil {
+			cs.addWritten(1)
 			after(res)
 		}
 		return err
@@ -338,6 +628,14 @@ func (t *Table) Apply(ctx context.Context, row string, m *Mutation, opts ...Appl
 	}
 	res, err := t.c.client.CheckAndMutateRow(ctx, req)
 	if err == nil {
+		// The row is written only if the branch that ran has mutations.
+		ran := req.FalseMutations
+		if res.PredicateMatched {
+			ran = req.TrueMutations
+		}
+		if len(ran) > 0 {
+			cs.addWritten(1)
+		}
 		after(res)
 	}
 	return err
@@ -402,6 +700,18 @@ func (m *Mutation) Set(family, column string, ts Timestamp, value []byte) {
 	}}})
 }
 
+// idempotent reports whether applying the mutation twice has the same
+// effect as applying it once. It is false for mutations that set a cell
+// with the server's timestamp.
+func (m *Mutation) idempotent() bool {
+	for _, op := range m.ops {
+		if set := op.GetSetCell(); set != nil && set.TimestampMicros == int64(ServerTime) {
+			return false
+		}
+	}
+	return true
+}
+
 // DeleteCellsInColumn will delete all the cells whose columns are family:column.
 func (m *Mutation) DeleteCellsInColumn(family, column string) {
 	m.ops = append(m.ops, &btpb.Mutation{Mutation: &btpb.Mutation_DeleteFromColumn_{&btpb.Mutation_DeleteFromColumn{
@@ -445,64 +755,166 @@ func (m *Mutation) DeleteRow() {
 // fail to apply, ([]err, nil) will be returned, and the errors
 // will correspond to the relevant rowKeys/muts arguments.
 //
+// Mutations that fail with a transient error are retried with backoff,
+// unless they are not idempotent, until ctx is done or many attempts in a
+// row have failed to apply any more of them. A mutation is not idempotent
+// if it sets a cell with the ServerTime timestamp.
+// The returned errors are the final status of each mutation.
+// Use GetBulkStats to find out how often mutations were retried.
+//
 // Depending on how the mutations are batched at the server one mutation may fail due to a problem
 // with another mutation. In this case the same error will be reported for both mutations.
 //
 // Conditional mutations cannot be applied in bulk and providing one will result in an error.
-func (t *Table) ApplyBulk(ctx context.Context, rowKeys []string, muts []*Mutation, opts ...ApplyOption) ([]error, error) {
+func (t *Table) ApplyBulk(ctx context.Context, rowKeys []string, muts []*Mutation, opts ...ApplyOption) (errs []error, err error) {
+	cs := t.startCall("ApplyBulk")
+	defer func() { t.endCall(ctx, cs, err) }()
 	ctx = metadata.NewContext(ctx, t.md)
 	if len(rowKeys) != len(muts) {
 		return nil, fmt.Errorf("mismatched rowKeys and mutation array lengths: %d, %d", len(rowKeys), len(muts))
 	}
+	for _, mut := range muts {
+		if mut.cond != nil {
+			return nil, fmt.Errorf("conditional mutations cannot be applied in bulk")
+		}
+	}
 
+	var stats *BulkStats
+	for _, o := range opts {
+		if o, ok := o.(bulkStatsOption); ok {
+			stats = o.stats
+		}
+	}
+	if stats != nil {
+		*stats = BulkStats{Retries: make([]int, len(rowKeys))}
+	}
 	after := func(res proto.Message) {
 		for _, o := range opts {
 			o.after(res)
 		}
 	}
 
-	req := &btpb.MutateRowsRequest{
-		TableName: t.c.fullTableName(t.table),
-		Entries:   make([]*btpb.MutateRowsRequest_Entry, len(rowKeys)),
+	errs = make([]error, len(rowKeys))
+	pending := make([]int, len(rowKeys)) // indexes into rowKeys and muts
+	for i := range pending {
+		pending[i] = i
 	}
-	for i, key := range rowKeys {
-		mut := muts[i]
-		if mut.cond != nil {
-			return nil, fmt.Errorf("conditional mutations cannot be applied in bulk")
+	var bo backoff
+	for attempt := 0; ; attempt++ {
+		if stats != nil {
+			stats.Attempts++
+		}
+		cs.attempt()
+		retry, err := t.doApplyBulk(ctx, rowKeys, muts, pending, errs, after)
+		if err != nil && attempt == 0 && !isRetryable(err) {
+			return nil, err
+		}
+		if len(retry) == 0 {
+			break
+		}
+		if len(retry) < len(pending) {
+			// Some mutations were applied, so start backing off afresh.
+			bo = backoff{}
+		}
+		if bo.retry(ctx) != nil {
+			break
+		}
+		pending = retry
+		if stats != nil {
+			for _, i := range pending {
+				stats.Retries[i]++
+			}
 		}
-		req.Entries[i] = &btpb.MutateRowsRequest_Entry{RowKey: []byte(key), Mutations: mut.ops}
 	}
-	stream, err := t.c.client.MutateRows(ctx, req)
-	if err != nil {
-		return nil, err
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	cs.addWritten(len(rowKeys) - failed)
+	if failed > 0 {
+		return errs, nil
 	}
+	return nil, nil
+}
 
-	var errors []error // kept as nil if everything is OK
-	for {
-		res, err := stream.Recv()
-		if err == io.EOF {
-			break
+// doApplyBulk makes a single MutateRows RPC for the mutations at the given
+// indexes, and records the status of each one in errs.
+// It returns the indexes of the mutations that should be retried.
+// If the RPC itself fails, the error is returned, and recorded for each
+// mutation whose status was not received. If the RPC succeeds without a
+// status for some mutations, they are recorded as failing with Internal.
+func (t *Table) doApplyBulk(ctx context.Context, rowKeys []string, muts []*Mutation, idxs []int, errs []error, after func(proto.Message)) (retry []int, err error) {
+	req := &btpb.MutateRowsRequest{
+		TableName: t.c.fullTableName(t.table),
+		Entries:   make([]*btpb.MutateRowsRequest_Entry, len(idxs)),
+	}
+	for j, i := range idxs {
+		req.Entries[j] = &btpb.MutateRowsRequest_Entry{RowKey: []byte(rowKeys[i]), Mutations: muts[i].ops}
+	}
+	done := make([]bool, len(idxs)) // whether the status of each entry was received
+	setErr := func(i int, err error) {
+		errs[i] = err
+		if err != nil && isRetryable(err) && muts[i].idempotent() {
+			retry = append(retry, i)
 		}
+	}
+
+	stream, err := t.c.client.MutateRows(ctx, req)
+	for err == nil {
+		var res *btpb.MutateRowsResponse
+		res, err = stream.Recv()
 		if err != nil {
-			return nil, err
+			break
 		}
-
-		for i, entry := range res.Entries {
-			status := entry.Status
-			if status.Code == int32(codes.OK) {
+		for _, entry := range res.Entries {
+			j := int(entry.Index)
+			if j < 0 || j >= len(idxs) {
 				continue
 			}
-			if errors == nil {
-				errors = make([]error, len(rowKeys))
+			done[j] = true
+			status := entry.Status
+			if status.Code == int32(codes.OK) {
+				setErr(idxs[j], nil)
+			} else {
+				setErr(idxs[j], grpc.Errorf(codes.Code(status.Code), "%s", status.Message))
 			}
-			errors[i] = grpc.Errorf(codes.Code(status.Code), status.Message)
 		}
 		after(res)
 	}
+	entryErr := err
+	if err == io.EOF {
+		err = nil
+		entryErr = grpc.Errorf(codes.Internal, "bigtable: no status received for mutation")
+	}
+	for j, i := range idxs {
+		if !done[j] {
+			setErr(i, entryErr)
+		}
+	}
+	return retry, err
+}
+
+// BulkStats reports the retries made by ApplyBulk.
+type BulkStats struct {
+	// Attempts is the number of MutateRows RPCs made.
+	Attempts int
 
-	return errors, nil
+	// Retries holds the number of times each mutation was retried,
+	// indexed in the same way as the mutations passed to ApplyBulk.
+	Retries []int
 }
 
+// GetBulkStats returns an ApplyOption that fills in stats when
+// passed to ApplyBulk. It has no effect on Apply.
+func GetBulkStats(stats *BulkStats) ApplyOption { return bulkStatsOption{stats} }
+
+type bulkStatsOption struct{ stats *BulkStats }
+
+func (bulkStatsOption) after(res proto.Message) {}
+
 // Timestamp is in units of microseconds since 1 January 1970.
 type Timestamp int64
 
@@ -521,21 +933,26 @@ func (ts Timestamp) Time() time.Time { return time.Unix(0, int64(ts)*1e3) }
 
 // ApplyReadModifyWrite applies a ReadModifyWrite to a specific row.
 // It returns the newly written cells.
-func (t *Table) ApplyReadModifyWrite(ctx context.Context, row string, m *ReadModifyWrite) (Row, error) {
+func (t *Table) ApplyReadModifyWrite(ctx context.Context, row string, m *ReadModifyWrite) (r Row, err error) {
+	cs := t.startCall("ApplyReadModifyWrite")
+	defer func() { t.endCall(ctx, cs, err) }()
 	ctx = metadata.NewContext(ctx, t.md)
 	req := &btpb.ReadModifyWriteRowRequest{
 		TableName: t.c.fullTableName(t.table),
 		RowKey:    []byte(row),
 		Rules:     m.ops,
 	}
+	cs.attempt()
 	res, err := t.c.client.ReadModifyWriteRow(ctx, req)
 	if err != nil {
 		return nil, err
 	}
-	r := make(Row)
+	r = make(Row)
 	for _, fam := range res.Row.Families { // res is *btpb.Row, fam is *btpb.Family
 		decodeFamilyProto(r, row, fam)
 	}
+	cs.addWritten(1)
+	cs.addRow(r)
 	return r, nil
 }
 
@@ -58,6 +58,35 @@ func TestPrefix(t *testing.T) {
 	}
 }
 
+func TestRowRange(t *testing.T) {
+	tests := []struct {
+		rr      RowRange
+		str     string
+		in, out []string
+	}{
+		{NewRange("b", "d"), `["b","d")`, []string{"b", "c"}, []string{"a", "d"}},
+		{NewOpenRange("b", "d"), `("b","d")`, []string{"b\x00", "c"}, []string{"b", "d"}},
+		{NewClosedRange("b", "d"), `["b","d"]`, []string{"b", "d"}, []string{"a", "d\x00"}},
+		{NewOpenClosedRange("b", "d"), `("b","d"]`, []string{"c", "d"}, []string{"b", "e"}},
+		{InfiniteRange("b"), `["b",∞)`, []string{"b", "zzz"}, []string{"a"}},
+	}
+	for _, tc := range tests {
+		if got := tc.rr.String(); got != tc.str {
+			t.Errorf("String() = %s, want %s", got, tc.str)
+		}
+		for _, row := range tc.in {
+			if !tc.rr.Contains(row) {
+				t.Errorf("%v.Contains(%q) = false, want true", tc.rr, row)
+			}
+		}
+		for _, row := range tc.out {
+			if tc.rr.Contains(row) {
+				t.Errorf("%v.Contains(%q) = true, want false", tc.rr, row)
+			}
+		}
+	}
+}
+
 var useProd = flag.String("use_prod", "", `if set to "proj,instance,table", run integration test against production`)
 
 func TestClientIntegration(t *testing.T) {
@@ -182,7 +211,7 @@ func TestClientIntegration(t *testing.T) {
 	// Do a bunch of reads with filters.
 	readTests := []struct {
 		desc   string
-		rr     RowRange
+		rr     RowSet
 		filter Filter // may be nil
 
 		// We do the read, grab all the cells, turn them into "<row>-<col>-<val>",
@@ -214,6 +243,31 @@ func TestClientIntegration(t *testing.T) {
 			rr:   SingleRow("wmckinley"),
 			want: "wmckinley-tjefferson-1",
 		},
+		{
+			desc: "read with NewOpenRange, unfiltered",
+			rr:   NewOpenRange("gwashington", "tjefferson"),
+			want: "jadams-gwashington-1,jadams-tjefferson-1",
+		},
+		{
+			desc: "read with NewClosedRange, unfiltered",
+			rr:   NewClosedRange("gwashington", "jadams"),
+			want: "gwashington-jadams-1,jadams-gwashington-1,jadams-tjefferson-1",
+		},
+		{
+			desc: "read with NewOpenClosedRange, unfiltered",
+			rr:   NewOpenClosedRange("jadams", "tjefferson"),
+			want: "tjefferson-gwashington-1,tjefferson-jadams-1,tjefferson-wmckinley-1",
+		},
+		{
+			desc: "read with RowRangeList, unfiltered",
+			rr:   RowRangeList{NewRange("gargamel", "hubbard"), InfiniteRange("wm"), PrefixRange("wmc")},
+			want: "gwashington-jadams-1,wmckinley-tjefferson-1",
+		},
+		{
+			desc: "read with RowSetList, unfiltered",
+			rr:   RowSetList{RowList{"gwashington", "nobody"}, PrefixRange("jad")},
+			want: "gwashington-jadams-1,jadams-gwashington-1,jadams-tjefferson-1",
+		},
 		{
 			desc:   "read all, with ColumnFilter",
 			rr:     RowRange{},
@@ -30,6 +30,7 @@ To use a Server, create it, and then connect to it with no security:
 package bttest // import "cloud.google.com/go/bigtable/bttest"
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"log"
@@ -68,6 +69,7 @@ type server struct {
 	mu     sync.Mutex
 	tables map[string]*table // keyed by fully qualified name
 	gcc    chan int          // set when gcloop starts, closed when server shuts down
+	clock  func() time.Time  // if nil, time.Now is used
 
 	// Any unimplemented methods will cause a panic.
 	btapb.BigtableTableAdminServer
@@ -111,6 +113,23 @@ func (s *Server) Close() {
 	s.l.Close()
 }
 
+// SetClock sets the function the server uses to get the current time
+// when applying MaxAge GC rules. Passing nil restores the default, time.Now.
+// Together with RunGC, this lets tests check retention behavior
+// without waiting for real time to pass.
+func (s *Server) SetClock(now func() time.Time) {
+	s.s.mu.Lock()
+	s.s.clock = now
+	s.s.mu.Unlock()
+}
+
+// RunGC performs a garbage collection pass over all tables,
+// applying each column family's GC rule. It returns once the pass is complete.
+// GC also runs periodically in the background once any GC rule is set.
+func (s *Server) RunGC() {
+	s.s.gc()
+}
+
 func (s *server) CreateTable(ctx context.Context, req *btapb.CreateTableRequest) (*btapb.Table, error) {
 	tbl := req.Parent + "/tables/" + req.TableId
 
@@ -228,14 +247,22 @@ func (s *server) ReadRows(req *btpb.ReadRowsRequest, stream btpb.Bigtable_ReadRo
 	tbl.mu.RLock()
 
 	rowSet := make(map[string]*row)
+	rs := req.Rows
+	if rs == nil {
+		rs = &btpb.RowSet{}
+	}
+	if len(rs.RowKeys) == 0 && len(rs.RowRanges) == 0 {
+		// An empty row set means the entire table.
+		addRows("", "", tbl, rowSet)
+	}
 	// Add the explicitly given keys
-	for _, key := range req.Rows.RowKeys {
+	for _, key := range rs.RowKeys {
 		start := string(key)
 		addRows(start, start+"\x00", tbl, rowSet)
 	}
 
 	// Add keys from row ranges
-	for _, rr := range req.Rows.RowRanges {
+	for _, rr := range rs.RowRanges {
 		var start, end string
 		switch sk := rr.StartKey.(type) {
 		case *btpb.RowRange_StartKeyClosed:
@@ -260,10 +287,18 @@ func (s *server) ReadRows(req *btpb.ReadRowsRequest, stream btpb.Bigtable_ReadRo
 	}
 	sort.Sort(byRowKey(rows))
 
+	count := int64(0)
 	for _, r := range rows {
-		if err := streamRow(stream, r, req.Filter); err != nil {
+		if req.RowsLimit > 0 && count >= req.RowsLimit {
+			break
+		}
+		sent, err := streamRow(stream, r, req.Filter)
+		if err != nil {
 			return err
 		}
+		if sent {
+			count++
+		}
 	}
 	return nil
 }
@@ -283,28 +318,30 @@ func addRows(start, end string, tbl *table, rowSet map[string]*row) {
 	}
 }
 
-func streamRow(stream btpb.Bigtable_ReadRowsServer, r *row, f *btpb.RowFilter) error {
+// streamRow sends the cells of r that pass f, and reports whether any did,
+// in which case the client sees a row.
+func streamRow(stream btpb.Bigtable_ReadRowsServer, r *row, f *btpb.RowFilter) (bool, error) {
 	r.mu.Lock()
 	nr := r.copy()
 	r.mu.Unlock()
 	r = nr
 
-	filterRow(f, r)
+	if err := filterRow(f, r); err != nil {
+		return false, err
+	}
 
 	rrr := &btpb.ReadRowsResponse{}
-	for col, cells := range r.cells {
+	for _, col := range r.sortedColumns() {
+		cells := r.cells[col]
 		i := strings.Index(col, ":") // guaranteed to exist
 		fam, col := col[:i], col[i+1:]
-		if len(cells) == 0 {
-			continue
-		}
-		// TODO(dsymonds): Apply transformers.
 		for _, cell := range cells {
 			rrr.Chunks = append(rrr.Chunks, &btpb.ReadRowsResponse_CellChunk{
 				RowKey:          []byte(r.key),
 				FamilyName:      &wrappers.StringValue{Value: fam},
 				Qualifier:       &wrappers.BytesValue{Value: []byte(col)},
 				TimestampMicros: cell.ts,
+				Labels:          cell.labels,
 				Value:           cell.value,
 			})
 		}
@@ -315,104 +352,331 @@ func streamRow(stream btpb.Bigtable_ReadRowsServer, r *row, f *btpb.RowFilter) e
 		rrr.Chunks[len(rrr.Chunks)-1].RowStatus = &btpb.ReadRowsResponse_CellChunk_CommitRow{CommitRow: true}
 	}
 
-	return stream.Send(rrr)
+	return len(rrr.Chunks) > 0, stream.Send(rrr)
 }
 
 // filterRow modifies a row with the given filter.
-func filterRow(f *btpb.RowFilter, r *row) {
+// It returns an error if the filter is malformed or not supported.
+func filterRow(f *btpb.RowFilter, r *row) error {
+	sink := newRow(r.key)
+	if err := applyFilter(f, r, sink); err != nil {
+		return err
+	}
+	// Cells that reached a sink filter bypass the rest of the filter,
+	// and are merged into the final result.
+	r.merge(sink)
+	return nil
+}
+
+// applyFilter modifies a row with the given filter.
+// Cells that reach a sink filter are moved to sink.
+func applyFilter(f *btpb.RowFilter, r *row, sink *row) error {
 	if f == nil {
-		return
+		return nil
 	}
 	// Handle filters that apply beyond just including/excluding cells.
 	switch f := f.Filter.(type) {
 	case *btpb.RowFilter_Chain_:
 		for _, sub := range f.Chain.Filters {
-			filterRow(sub, r)
+			if err := applyFilter(sub, r, sink); err != nil {
+				return err
+			}
 		}
-		return
+		return nil
 	case *btpb.RowFilter_Interleave_:
 		srs := make([]*row, 0, len(f.Interleave.Filters))
 		for _, sub := range f.Interleave.Filters {
 			sr := r.copy()
-			filterRow(sub, sr)
+			if err := applyFilter(sub, sr, sink); err != nil {
+				return err
+			}
 			srs = append(srs, sr)
 		}
-		// merge
-		// TODO(dsymonds): is this correct?
+		// Merge the results of each sub-filter.
+		// Cells matched by more than one sub-filter are output more than once.
 		r.cells = make(map[string][]cell)
 		for _, sr := range srs {
-			for col, cs := range sr.cells {
-				r.cells[col] = append(r.cells[col], cs...)
+			r.merge(sr)
+		}
+		return nil
+	case *btpb.RowFilter_Condition_:
+		cond := f.Condition
+		for _, sub := range []*btpb.RowFilter{cond.PredicateFilter, cond.TrueFilter, cond.FalseFilter} {
+			if containsSink(sub) {
+				return grpc.Errorf(codes.InvalidArgument, "sink filter not allowed within a condition filter")
 			}
 		}
-		for _, cs := range r.cells {
-			sort.Sort(byDescTS(cs))
+		pr := r.copy()
+		if err := applyFilter(cond.PredicateFilter, pr, sink); err != nil {
+			return err
+		}
+		next := cond.FalseFilter
+		if !pr.isEmpty() {
+			next = cond.TrueFilter
 		}
-		return
+		if next == nil {
+			// A missing branch outputs nothing.
+			r.cells = make(map[string][]cell)
+			return nil
+		}
+		return applyFilter(next, r, sink)
+	case *btpb.RowFilter_Sink:
+		if !f.Sink {
+			return grpc.Errorf(codes.InvalidArgument, "sink filter must be true")
+		}
+		sink.merge(r)
+		r.cells = make(map[string][]cell)
+		return nil
+	case *btpb.RowFilter_PassAllFilter:
+		if !f.PassAllFilter {
+			return grpc.Errorf(codes.InvalidArgument, "pass_all_filter must be true")
+		}
+		return nil
+	case *btpb.RowFilter_BlockAllFilter:
+		if !f.BlockAllFilter {
+			return grpc.Errorf(codes.InvalidArgument, "block_all_filter must be true")
+		}
+		r.cells = make(map[string][]cell)
+		return nil
+	case *btpb.RowFilter_RowKeyRegexFilter:
+		rx, err := compileRegexp("row_key_regex_filter", string(f.RowKeyRegexFilter))
+		if err != nil {
+			return err
+		}
+		if !rx.MatchString(r.key) {
+			r.cells = make(map[string][]cell)
+		}
+		return nil
+	case *btpb.RowFilter_RowSampleFilter:
+		p := f.RowSampleFilter
+		if p <= 0 || p >= 1 {
+			return grpc.Errorf(codes.InvalidArgument, "row_sample_filter %v must be in the open interval (0, 1)", p)
+		}
+		if rand.Float64() >= p {
+			r.cells = make(map[string][]cell)
+		}
+		return nil
 	case *btpb.RowFilter_CellsPerColumnLimitFilter:
 		lim := int(f.CellsPerColumnLimitFilter)
+		if lim < 0 {
+			return grpc.Errorf(codes.InvalidArgument, "cells_per_column_limit_filter %d must be non-negative", lim)
+		}
 		for col, cs := range r.cells {
 			if len(cs) > lim {
 				r.cells[col] = cs[:lim]
 			}
 		}
-		return
+		return nil
+	case *btpb.RowFilter_CellsPerRowLimitFilter:
+		lim := int(f.CellsPerRowLimitFilter)
+		if lim < 0 {
+			return grpc.Errorf(codes.InvalidArgument, "cells_per_row_limit_filter %d must be non-negative", lim)
+		}
+		// Cells are counted in the order they would be returned:
+		// by column, then by descending timestamp.
+		n := 0
+		for _, col := range r.sortedColumns() {
+			cs := r.cells[col]
+			if n+len(cs) > lim {
+				cs = cs[:lim-n]
+			}
+			n += len(cs)
+			r.setCells(col, cs)
+		}
+		return nil
+	case *btpb.RowFilter_CellsPerRowOffsetFilter:
+		off := int(f.CellsPerRowOffsetFilter)
+		if off < 0 {
+			return grpc.Errorf(codes.InvalidArgument, "cells_per_row_offset_filter %d must be non-negative", off)
+		}
+		for _, col := range r.sortedColumns() {
+			cs := r.cells[col]
+			if off >= len(cs) {
+				off -= len(cs)
+				cs = nil
+			} else {
+				cs, off = cs[off:], 0
+			}
+			r.setCells(col, cs)
+		}
+		return nil
 	}
 
 	// Any other case, operate on a per-cell basis.
 	for key, cs := range r.cells {
 		i := strings.Index(key, ":") // guaranteed to exist
 		fam, col := key[:i], key[i+1:]
-		r.cells[key] = filterCells(f, fam, col, cs)
+		ncs, err := filterCells(f, fam, col, cs)
+		if err != nil {
+			return err
+		}
+		r.setCells(key, ncs)
+	}
+	return nil
+}
+
+// containsSink reports whether the filter, or any of its sub-filters, is a sink filter.
+func containsSink(f *btpb.RowFilter) bool {
+	if f == nil {
+		return false
+	}
+	var subs []*btpb.RowFilter
+	switch f := f.Filter.(type) {
+	case *btpb.RowFilter_Sink:
+		return true
+	case *btpb.RowFilter_Chain_:
+		subs = f.Chain.Filters
+	case *btpb.RowFilter_Interleave_:
+		subs = f.Interleave.Filters
+	case *btpb.RowFilter_Condition_:
+		subs = []*btpb.RowFilter{f.Condition.PredicateFilter, f.Condition.TrueFilter, f.Condition.FalseFilter}
+	}
+	for _, sub := range subs {
+		if containsSink(sub) {
+			return true
+		}
 	}
+	return false
 }
 
-func filterCells(f *btpb.RowFilter, fam, col string, cs []cell) []cell {
+// filterCells applies a per-cell filter to the cells of a single column.
+// The returned slice does not alias cs.
+func filterCells(f *btpb.RowFilter, fam, col string, cs []cell) ([]cell, error) {
 	var ret []cell
 	for _, cell := range cs {
-		if includeCell(f, fam, col, cell) {
-			ret = append(ret, cell)
+		include, err := includeCell(f, fam, col, cell)
+		if err != nil {
+			return nil, err
+		}
+		if !include {
+			continue
+		}
+		cell, err = modifyCell(f, cell)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, cell)
+	}
+	return ret, nil
+}
+
+// modifyCell applies a transformer filter to a cell.
+// Filters that are not transformers leave the cell unchanged.
+func modifyCell(f *btpb.RowFilter, c cell) (cell, error) {
+	switch f := f.Filter.(type) {
+	case *btpb.RowFilter_StripValueTransformer:
+		if !f.StripValueTransformer {
+			return c, grpc.Errorf(codes.InvalidArgument, "strip_value_transformer must be true")
 		}
+		c.value = []byte{}
+	case *btpb.RowFilter_ApplyLabelTransformer:
+		// Use a full slice expression so that appending never writes
+		// into a labels slice shared with another copy of the cell.
+		c.labels = append(c.labels[:len(c.labels):len(c.labels)], f.ApplyLabelTransformer)
 	}
-	return ret
+	return c, nil
 }
 
-func includeCell(f *btpb.RowFilter, fam, col string, cell cell) bool {
+func includeCell(f *btpb.RowFilter, fam, col string, cell cell) (bool, error) {
 	if f == nil {
-		return true
+		return true, nil
 	}
-	// TODO(dsymonds): Implement many more filters.
 	switch f := f.Filter.(type) {
 	default:
-		log.Printf("WARNING: don't know how to handle filter of type %T (ignoring it)", f)
-		return true
+		return false, grpc.Errorf(codes.Unimplemented, "bttest: don't know how to handle filter of type %T", f)
+	case *btpb.RowFilter_StripValueTransformer, *btpb.RowFilter_ApplyLabelTransformer:
+		// Transformers keep every cell; see modifyCell.
+		return true, nil
 	case *btpb.RowFilter_FamilyNameRegexFilter:
-		pat := string(f.FamilyNameRegexFilter)
-		rx, err := regexp.Compile(pat)
+		rx, err := compileRegexp("family_name_regex_filter", f.FamilyNameRegexFilter)
 		if err != nil {
-			log.Printf("Bad family_name_regex_filter pattern %q: %v", pat, err)
-			return false
+			return false, err
 		}
-		return rx.MatchString(fam)
+		return rx.MatchString(fam), nil
 	case *btpb.RowFilter_ColumnQualifierRegexFilter:
-		pat := string(f.ColumnQualifierRegexFilter)
-		rx, err := regexp.Compile(pat)
+		rx, err := compileRegexp("column_qualifier_regex_filter", string(f.ColumnQualifierRegexFilter))
 		if err != nil {
-			log.Printf("Bad column_qualifier_regex_filter pattern %q: %v", pat, err)
-			return false
+			return false, err
 		}
-		return rx.MatchString(col)
+		return rx.MatchString(col), nil
 	case *btpb.RowFilter_ValueRegexFilter:
-		pat := string(f.ValueRegexFilter)
-		rx, err := regexp.Compile(pat)
+		rx, err := compileRegexp("value_regex_filter", string(f.ValueRegexFilter))
 		if err != nil {
-			log.Printf("Bad value_regex_filter pattern %q: %v", pat, err)
-			return false
+			return false, err
+		}
+		return rx.Match(cell.value), nil
+	case *btpb.RowFilter_ColumnRangeFilter:
+		cr := f.ColumnRangeFilter
+		if fam != cr.FamilyName {
+			return false, nil
+		}
+		q := []byte(col)
+		switch sq := cr.StartQualifier.(type) {
+		case *btpb.ColumnRange_StartQualifierClosed:
+			if bytes.Compare(q, sq.StartQualifierClosed) < 0 {
+				return false, nil
+			}
+		case *btpb.ColumnRange_StartQualifierOpen:
+			if bytes.Compare(q, sq.StartQualifierOpen) <= 0 {
+				return false, nil
+			}
 		}
-		return rx.Match(cell.value)
+		switch eq := cr.EndQualifier.(type) {
+		case *btpb.ColumnRange_EndQualifierClosed:
+			if bytes.Compare(q, eq.EndQualifierClosed) > 0 {
+				return false, nil
+			}
+		case *btpb.ColumnRange_EndQualifierOpen:
+			if bytes.Compare(q, eq.EndQualifierOpen) >= 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *btpb.RowFilter_ValueRangeFilter:
+		vr := f.ValueRangeFilter
+		switch sv := vr.StartValue.(type) {
+		case *btpb.ValueRange_StartValueClosed:
+			if bytes.Compare(cell.value, sv.StartValueClosed) < 0 {
+				return false, nil
+			}
+		case *btpb.ValueRange_StartValueOpen:
+			if bytes.Compare(cell.value, sv.StartValueOpen) <= 0 {
+				return false, nil
+			}
+		}
+		switch ev := vr.EndValue.(type) {
+		case *btpb.ValueRange_EndValueClosed:
+			if bytes.Compare(cell.value, ev.EndValueClosed) > 0 {
+				return false, nil
+			}
+		case *btpb.ValueRange_EndValueOpen:
+			if bytes.Compare(cell.value, ev.EndValueOpen) >= 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	case *btpb.RowFilter_TimestampRangeFilter:
+		tr := f.TimestampRangeFilter
+		// The start is inclusive and the end is exclusive.
+		// An end of zero is interpreted as infinity.
+		if cell.ts < tr.StartTimestampMicros {
+			return false, nil
+		}
+		if tr.EndTimestampMicros != 0 && cell.ts >= tr.EndTimestampMicros {
+			return false, nil
+		}
+		return true, nil
 	}
 }
 
+func compileRegexp(field, pat string) (*regexp.Regexp, error) {
+	rx, err := regexp.Compile(pat)
+	if err != nil {
+		return nil, grpc.Errorf(codes.InvalidArgument, "bad %s pattern %q: %v", field, pat, err)
+	}
+	return rx, nil
+}
+
 func (s *server) MutateRow(ctx context.Context, req *btpb.MutateRowRequest) (*btpb.MutateRowResponse, error) {
 	s.mu.Lock()
 	tbl, ok := s.tables[req.TableName]
@@ -487,13 +751,10 @@ func (s *server) CheckAndMutateRow(ctx context.Context, req *btpb.CheckAndMutate
 		// Use true_mutations iff any cells in the row match the filter.
 		// TODO(dsymonds): This could be cheaper.
 		nr := r.copy()
-		filterRow(req.PredicateFilter, nr)
-		for _, cs := range nr.cells {
-			if len(cs) > 0 {
-				whichMut = true
-				break
-			}
+		if err := filterRow(req.PredicateFilter, nr); err != nil {
+			return nil, err
 		}
+		whichMut = !nr.isEmpty()
 		// TODO(dsymonds): Figure out if this is supposed to be set
 		// even when there's no predicate filter.
 		res.PredicateMatched = whichMut
@@ -690,6 +951,54 @@ func (s *server) ReadModifyWriteRow(ctx context.Context, req *btpb.ReadModifyWri
 	return &btpb.ReadModifyWriteRowResponse{Row: res}, nil
 }
 
+// maxSamples is the approximate maximum number of row key samples
+// returned by SampleRowKeys for a table.
+const maxSamples = 100
+
+func (s *server) SampleRowKeys(req *btpb.SampleRowKeysRequest, stream btpb.Bigtable_SampleRowKeysServer) error {
+	s.mu.Lock()
+	tbl, ok := s.tables[req.TableName]
+	s.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no such table %q", req.TableName)
+	}
+
+	tbl.mu.RLock()
+	sizes := make([]int64, len(tbl.rows))
+	var total int64
+	for i, r := range tbl.rows {
+		r.mu.Lock()
+		sizes[i] = r.size()
+		r.mu.Unlock()
+		total += sizes[i]
+	}
+	// Sample a row whenever the rows before it pass the next multiple of step,
+	// so that samples delimit sections of roughly equal size.
+	step := total / maxSamples
+	if step < 1 {
+		step = 1
+	}
+	var samples []*btpb.SampleRowKeysResponse
+	var offset, next int64 = 0, step
+	for i, r := range tbl.rows {
+		if offset >= next {
+			samples = append(samples, &btpb.SampleRowKeysResponse{RowKey: []byte(r.key), OffsetBytes: offset})
+			next = offset + step
+		}
+		offset += sizes[i]
+	}
+	tbl.mu.RUnlock()
+
+	// The last sample has an empty key, representing the end of the table.
+	samples = append(samples, &btpb.SampleRowKeysResponse{RowKey: []byte{}, OffsetBytes: total})
+	for _, res := range samples {
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // needGC is invoked whenever the server needs gcloop running.
 func (s *server) needGC() {
 	s.mu.Lock()
@@ -715,16 +1024,24 @@ func (s *server) gcloop(done <-chan int) {
 			return // server has been closed
 		}
 
-		// Do a GC pass over all tables.
-		var tables []*table
-		s.mu.Lock()
-		for _, tbl := range s.tables {
-			tables = append(tables, tbl)
-		}
-		s.mu.Unlock()
-		for _, tbl := range tables {
-			tbl.gc()
-		}
+		s.gc()
+	}
+}
+
+// gc does a GC pass over all tables.
+func (s *server) gc() {
+	var tables []*table
+	s.mu.Lock()
+	for _, tbl := range s.tables {
+		tables = append(tables, tbl)
+	}
+	now := time.Now()
+	if s.clock != nil {
+		now = s.clock()
+	}
+	s.mu.Unlock()
+	for _, tbl := range tables {
+		tbl.gc(now)
 	}
 }
 
@@ -796,7 +1113,9 @@ func (t *table) mutableRow(row string) *row {
 	return r
 }
 
-func (t *table) gc() {
+// gc applies the column families' GC rules to every row,
+// treating now as the current time.
+func (t *table) gc(now time.Time) {
 	// This method doesn't add or remove rows, so we only need a read lock for the table.
 	t.mu.RLock()
 	defer t.mu.RUnlock()
@@ -814,7 +1133,7 @@ func (t *table) gc() {
 
 	for _, r := range t.rows {
 		r.mu.Lock()
-		r.gc(rules)
+		r.gc(rules, now)
 		r.mu.Unlock()
 	}
 }
@@ -854,37 +1173,118 @@ func (r *row) copy() *row {
 	return nr
 }
 
-// gc applies the given GC rules to the row.
+// size returns the approximate storage size of the row in bytes.
+// r.mu should be held.
+func (r *row) size() int64 {
+	n := int64(len(r.key))
+	for col, cs := range r.cells {
+		for _, c := range cs {
+			n += int64(len(col) + len(c.value) + 8) // 8 bytes for the timestamp
+		}
+	}
+	return n
+}
+
+// isEmpty reports whether the row has no cells.
+// r.mu should be held.
+func (r *row) isEmpty() bool {
+	for _, cs := range r.cells {
+		if len(cs) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedColumns returns the full column names of the row,
+// sorted by family and then by qualifier.
+// r.mu should be held.
+func (r *row) sortedColumns() []string {
+	cols := make([]string, 0, len(r.cells))
+	for col := range r.cells {
+		cols = append(cols, col)
+	}
+	sort.Sort(byColumn(cols))
+	return cols
+}
+
+// setCells replaces the cells in a column, removing the column if cs is empty.
 // r.mu should be held.
-func (r *row) gc(rules map[string]*btapb.GcRule) {
+func (r *row) setCells(col string, cs []cell) {
+	if len(cs) == 0 {
+		delete(r.cells, col)
+		return
+	}
+	r.cells[col] = cs
+}
+
+// merge adds the cells of other to the row, keeping each column in
+// descending timestamp order. Cells present in both rows are duplicated.
+// r.mu should be held.
+func (r *row) merge(other *row) {
+	for col, cs := range other.cells {
+		if len(cs) == 0 {
+			continue
+		}
+		ncs := append(append([]cell(nil), r.cells[col]...), cs...)
+		sort.Stable(byDescTS(ncs))
+		r.cells[col] = ncs
+	}
+}
+
+// gc applies the given GC rules to the row, treating now as the current time.
+// r.mu should be held.
+func (r *row) gc(rules map[string]*btapb.GcRule, now time.Time) {
 	for col, cs := range r.cells {
 		fam := col[:strings.Index(col, ":")]
 		rule, ok := rules[fam]
 		if !ok {
 			continue
 		}
-		r.cells[col] = applyGC(cs, rule)
+		r.setCells(col, applyGC(cs, rule, now))
 	}
 }
 
 var gcTypeWarn sync.Once
 
-// applyGC applies the given GC rule to the cells.
-func applyGC(cells []cell, rule *btapb.GcRule) []cell {
+// applyGC applies the given GC rule to the cells, and returns the cells to keep.
+// The cells must be in descending timestamp order, and are not modified.
+func applyGC(cells []cell, rule *btapb.GcRule, now time.Time) []cell {
 	switch rule := rule.Rule.(type) {
 	default:
-		// TODO(dsymonds): Support GcRule_Intersection_
 		gcTypeWarn.Do(func() {
 			log.Printf("Unsupported GC rule type %T", rule)
 		})
+	case nil:
+		// An empty rule keeps everything.
 	case *btapb.GcRule_Union_:
+		// A cell is deleted if any of the rules would delete it.
 		for _, sub := range rule.Union.Rules {
-			cells = applyGC(cells, sub)
+			cells = applyGC(cells, sub, now)
 		}
 		return cells
+	case *btapb.GcRule_Intersection_:
+		// A cell is deleted only if all of the rules would delete it.
+		// With no rules, nothing is deleted.
+		if len(rule.Intersection.Rules) == 0 {
+			return cells
+		}
+		keep := make(map[int64]bool) // keyed by timestamp, which is unique within a column
+		for _, sub := range rule.Intersection.Rules {
+			for _, c := range applyGC(cells, sub, now) {
+				keep[c.ts] = true
+			}
+		}
+		var ret []cell
+		for _, c := range cells {
+			if keep[c.ts] {
+				ret = append(ret, c)
+			}
+		}
+		return ret
 	case *btapb.GcRule_MaxAge:
 		// Timestamps are in microseconds.
-		cutoff := time.Now().UnixNano() / 1e3
+		cutoff := now.UnixNano() / 1e3
 		cutoff -= rule.MaxAge.Seconds * 1e6
 		cutoff -= int64(rule.MaxAge.Nanos) / 1e3
 		// The slice of cells in in descending timestamp order.
@@ -905,8 +1305,9 @@ func applyGC(cells []cell, rule *btapb.GcRule) []cell {
 }
 
 type cell struct {
-	ts    int64
-	value []byte
+	ts     int64
+	value  []byte
+	labels []string
 }
 
 type byDescTS []cell
@@ -915,6 +1316,26 @@ func (b byDescTS) Len() int           { return len(b) }
 func (b byDescTS) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
 func (b byDescTS) Less(i, j int) bool { return b[i].ts > b[j].ts }
 
+// byColumn sorts full column names by family and then by qualifier.
+type byColumn []string
+
+func (b byColumn) Len() int      { return len(b) }
+func (b byColumn) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byColumn) Less(i, j int) bool {
+	fi, qi := splitColumn(b[i])
+	fj, qj := splitColumn(b[j])
+	if fi != fj {
+		return fi < fj
+	}
+	return qi < qj
+}
+
+// splitColumn splits a full column name into its family and qualifier.
+func splitColumn(col string) (fam, qual string) {
+	i := strings.Index(col, ":") // guaranteed to exist
+	return col[:i], col[i+1:]
+}
+
 type columnFamily struct {
 	name   string
 	gcRule *btapb.GcRule
@@ -22,6 +22,7 @@ import (
 	"testing"
 	"time"
 
+	durpb "github.com/golang/protobuf/ptypes/duration"
 	"golang.org/x/net/context"
 	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
 	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
@@ -120,7 +121,7 @@ func TestConcurrentMutationsReadModifyAndGC(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			tbl.gc()
+			tbl.gc(time.Now())
 		}()
 	}
 	done := make(chan struct{})
@@ -173,3 +174,313 @@ func TestCreateTableWithFamily(t *testing.T) {
 		t.Errorf("Invalid MaxNumVersions: wanted:%d, got:%d", want, got)
 	}
 }
+
+func TestFilterRow(t *testing.T) {
+	newTestRow := func() *row {
+		r := newRow("row")
+		r.cells["fam:a"] = []cell{{ts: 3000, value: []byte("a3")}, {ts: 2000, value: []byte("a2")}, {ts: 1000, value: []byte("a1")}}
+		r.cells["fam:b"] = []cell{{ts: 2000, value: []byte("b2")}}
+		r.cells["other:c"] = []cell{{ts: 1000, value: []byte("c1")}}
+		return r
+	}
+	chain := func(fs ...*btpb.RowFilter) *btpb.RowFilter {
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_Chain_{Chain: &btpb.RowFilter_Chain{Filters: fs}}}
+	}
+	famRegex := func(pat string) *btpb.RowFilter {
+		return &btpb.RowFilter{Filter: &btpb.RowFilter_FamilyNameRegexFilter{FamilyNameRegexFilter: pat}}
+	}
+	block := &btpb.RowFilter{Filter: &btpb.RowFilter_BlockAllFilter{BlockAllFilter: true}}
+	pass := &btpb.RowFilter{Filter: &btpb.RowFilter_PassAllFilter{PassAllFilter: true}}
+
+	for _, test := range []struct {
+		desc string
+		f    *btpb.RowFilter
+		want []string // values of the remaining cells, in output order
+	}{
+		{
+			desc: "pass all",
+			f:    pass,
+			want: []string{"a3", "a2", "a1", "b2", "c1"},
+		},
+		{
+			desc: "block all",
+			f:    block,
+		},
+		{
+			desc: "column range",
+			f: &btpb.RowFilter{Filter: &btpb.RowFilter_ColumnRangeFilter{ColumnRangeFilter: &btpb.ColumnRange{
+				FamilyName:     "fam",
+				StartQualifier: &btpb.ColumnRange_StartQualifierOpen{StartQualifierOpen: []byte("a")},
+				EndQualifier:   &btpb.ColumnRange_EndQualifierClosed{EndQualifierClosed: []byte("b")},
+			}}},
+			want: []string{"b2"},
+		},
+		{
+			desc: "value range",
+			f: &btpb.RowFilter{Filter: &btpb.RowFilter_ValueRangeFilter{ValueRangeFilter: &btpb.ValueRange{
+				StartValue: &btpb.ValueRange_StartValueClosed{StartValueClosed: []byte("a2")},
+				EndValue:   &btpb.ValueRange_EndValueOpen{EndValueOpen: []byte("c1")},
+			}}},
+			want: []string{"a3", "a2", "b2"},
+		},
+		{
+			desc: "timestamp range",
+			f: &btpb.RowFilter{Filter: &btpb.RowFilter_TimestampRangeFilter{TimestampRangeFilter: &btpb.TimestampRange{
+				StartTimestampMicros: 2000,
+				EndTimestampMicros:   3000,
+			}}},
+			want: []string{"a2", "b2"},
+		},
+		{
+			desc: "cells per row limit",
+			f:    &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerRowLimitFilter{CellsPerRowLimitFilter: 4}},
+			want: []string{"a3", "a2", "a1", "b2"},
+		},
+		{
+			desc: "cells per row offset",
+			f:    &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerRowOffsetFilter{CellsPerRowOffsetFilter: 2}},
+			want: []string{"a1", "b2", "c1"},
+		},
+		{
+			desc: "cells per column limit",
+			f:    &btpb.RowFilter{Filter: &btpb.RowFilter_CellsPerColumnLimitFilter{CellsPerColumnLimitFilter: 1}},
+			want: []string{"a3", "b2", "c1"},
+		},
+		{
+			desc: "condition true",
+			f: &btpb.RowFilter{Filter: &btpb.RowFilter_Condition_{Condition: &btpb.RowFilter_Condition{
+				PredicateFilter: famRegex("other"),
+				TrueFilter:      famRegex("fam"),
+				FalseFilter:     pass,
+			}}},
+			want: []string{"a3", "a2", "a1", "b2"},
+		},
+		{
+			desc: "condition false without branch",
+			f: &btpb.RowFilter{Filter: &btpb.RowFilter_Condition_{Condition: &btpb.RowFilter_Condition{
+				PredicateFilter: famRegex("missing"),
+				TrueFilter:      pass,
+			}}},
+		},
+		{
+			desc: "sink",
+			f: chain(
+				&btpb.RowFilter{Filter: &btpb.RowFilter_Interleave_{Interleave: &btpb.RowFilter_Interleave{Filters: []*btpb.RowFilter{
+					chain(famRegex("other"), &btpb.RowFilter{Filter: &btpb.RowFilter_Sink{Sink: true}}),
+					famRegex("fam"),
+				}}}},
+				block,
+			),
+			want: []string{"c1"},
+		},
+		{
+			desc: "strip value",
+			f: chain(
+				famRegex("other"),
+				&btpb.RowFilter{Filter: &btpb.RowFilter_StripValueTransformer{StripValueTransformer: true}},
+			),
+			want: []string{""},
+		},
+	} {
+		r := newTestRow()
+		if err := filterRow(test.f, r); err != nil {
+			t.Errorf("%s: filterRow: %v", test.desc, err)
+			continue
+		}
+		var got []string
+		for _, col := range r.sortedColumns() {
+			for _, c := range r.cells[col] {
+				got = append(got, string(c.value))
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("%s: got %q, want %q", test.desc, got, test.want)
+		}
+	}
+}
+
+func TestFilterRowLabels(t *testing.T) {
+	r := newRow("row")
+	r.cells["fam:a"] = []cell{{ts: 1000, value: []byte("v")}}
+	f := &btpb.RowFilter{Filter: &btpb.RowFilter_ApplyLabelTransformer{ApplyLabelTransformer: "label"}}
+	if err := filterRow(f, r); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.cells["fam:a"][0].labels; len(got) != 1 || got[0] != "label" {
+		t.Errorf("labels = %q, want [label]", got)
+	}
+}
+
+func TestFilterRowErrors(t *testing.T) {
+	for _, f := range []*btpb.RowFilter{
+		{Filter: &btpb.RowFilter_FamilyNameRegexFilter{FamilyNameRegexFilter: "("}},
+		{Filter: &btpb.RowFilter_RowSampleFilter{RowSampleFilter: 1.5}},
+		{Filter: &btpb.RowFilter_BlockAllFilter{BlockAllFilter: false}},
+		{Filter: &btpb.RowFilter_Condition_{Condition: &btpb.RowFilter_Condition{
+			PredicateFilter: &btpb.RowFilter{Filter: &btpb.RowFilter_Sink{Sink: true}},
+		}}},
+	} {
+		r := newRow("row")
+		r.cells["fam:a"] = []cell{{ts: 1000, value: []byte("v")}}
+		if err := filterRow(f, r); err == nil {
+			t.Errorf("filterRow(%v): got nil error, want error", f)
+		}
+	}
+}
+
+func TestGCRules(t *testing.T) {
+	maxAge := func(d time.Duration) *btapb.GcRule {
+		return &btapb.GcRule{Rule: &btapb.GcRule_MaxAge{MaxAge: &durpb.Duration{Seconds: int64(d.Seconds())}}}
+	}
+	maxVersions := func(n int32) *btapb.GcRule {
+		return &btapb.GcRule{Rule: &btapb.GcRule_MaxNumVersions{MaxNumVersions: n}}
+	}
+	union := func(rules ...*btapb.GcRule) *btapb.GcRule {
+		return &btapb.GcRule{Rule: &btapb.GcRule_Union_{Union: &btapb.GcRule_Union{Rules: rules}}}
+	}
+	intersection := func(rules ...*btapb.GcRule) *btapb.GcRule {
+		return &btapb.GcRule{Rule: &btapb.GcRule_Intersection_{Intersection: &btapb.GcRule_Intersection{Rules: rules}}}
+	}
+
+	now := time.Unix(1e6, 0)
+	hoursAgo := func(h int64) int64 { return now.UnixNano()/1e3 - h*3600*1e6 }
+	cells := []cell{{ts: hoursAgo(0)}, {ts: hoursAgo(2)}, {ts: hoursAgo(4)}, {ts: hoursAgo(6)}}
+
+	for _, test := range []struct {
+		desc string
+		rule *btapb.GcRule
+		want int // number of cells kept
+	}{
+		{"max age", maxAge(3 * time.Hour), 2},
+		{"max versions", maxVersions(3), 3},
+		{"union", union(maxAge(5*time.Hour), maxVersions(1)), 1},
+		{"intersection", intersection(maxAge(3*time.Hour), maxVersions(3)), 3},
+		{"empty intersection", intersection(), 4},
+		{"nested", union(intersection(maxAge(1*time.Hour), maxVersions(2)), maxAge(5*time.Hour)), 2},
+	} {
+		got := applyGC(cells, test.rule, now)
+		if len(got) != test.want {
+			t.Errorf("%s: kept %d cells, want %d", test.desc, len(got), test.want)
+		}
+	}
+}
+
+func TestRunGC(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	s := srv.s
+	ctx := context.Background()
+
+	now := time.Unix(1e6, 0)
+	srv.SetClock(func() time.Time { return now })
+
+	newTbl := btapb.Table{
+		ColumnFamilies: map[string]*btapb.ColumnFamily{
+			"cf": {GcRule: &btapb.GcRule{Rule: &btapb.GcRule_MaxAge{MaxAge: &durpb.Duration{Seconds: 3600}}}},
+		},
+	}
+	tblInfo, err := s.CreateTable(ctx, &btapb.CreateTableRequest{Parent: "cluster", TableId: "t", Table: &newTbl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := &btpb.MutateRowRequest{
+		TableName: tblInfo.Name,
+		RowKey:    []byte("row"),
+		Mutations: []*btpb.Mutation{{
+			Mutation: &btpb.Mutation_SetCell_{SetCell: &btpb.Mutation_SetCell{
+				FamilyName:      "cf",
+				ColumnQualifier: []byte("col"),
+				TimestampMicros: now.UnixNano() / 1e3,
+				Value:           []byte("v"),
+			}},
+		}},
+	}
+	if _, err := s.MutateRow(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	cellCount := func() int {
+		r := s.tables[tblInfo.Name].mutableRow("row")
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		return len(r.cells["cf:col"])
+	}
+
+	srv.RunGC()
+	if got := cellCount(); got != 1 {
+		t.Fatalf("after GC at write time: got %d cells, want 1", got)
+	}
+	now = now.Add(2 * time.Hour)
+	srv.RunGC()
+	if got := cellCount(); got != 0 {
+		t.Errorf("after GC two hours later: got %d cells, want 0", got)
+	}
+}
+
+// readRowsStream collects the responses sent by server.ReadRows.
+type readRowsStream struct {
+	btpb.Bigtable_ReadRowsServer // unimplemented methods panic
+	responses                    []*btpb.ReadRowsResponse
+}
+
+func (s *readRowsStream) Send(res *btpb.ReadRowsResponse) error {
+	s.responses = append(s.responses, res)
+	return nil
+}
+
+func TestReadRowsLimit(t *testing.T) {
+	s := &server{tables: make(map[string]*table)}
+	ctx := context.Background()
+	newTbl := btapb.Table{
+		ColumnFamilies: map[string]*btapb.ColumnFamily{"cf": {}},
+	}
+	tblInfo, err := s.CreateTable(ctx, &btapb.CreateTableRequest{Parent: "cluster", TableId: "t", Table: &newTbl})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		req := &btpb.MutateRowRequest{
+			TableName: tblInfo.Name,
+			RowKey:    []byte(key),
+			Mutations: []*btpb.Mutation{{
+				Mutation: &btpb.Mutation_SetCell_{SetCell: &btpb.Mutation_SetCell{
+					FamilyName:      "cf",
+					ColumnQualifier: []byte("col"),
+					Value:           []byte(key),
+				}},
+			}},
+		}
+		if _, err := s.MutateRow(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		limit  int64
+		filter *btpb.RowFilter
+		want   string
+	}{
+		{0, nil, "abcd"},
+		{2, nil, "ab"},
+		{10, nil, "abcd"},
+		// Rows that the filter removes entirely don't count against the limit.
+		{2, &btpb.RowFilter{Filter: &btpb.RowFilter_ValueRegexFilter{ValueRegexFilter: []byte("[bcd]")}}, "bc"},
+	} {
+		stream := &readRowsStream{}
+		req := &btpb.ReadRowsRequest{TableName: tblInfo.Name, RowsLimit: test.limit, Filter: test.filter}
+		if err := s.ReadRows(req, stream); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for _, res := range stream.responses {
+			if len(res.Chunks) > 0 {
+				got += string(res.Chunks[0].RowKey)
+			}
+		}
+		if got != test.want {
+			t.Errorf("RowsLimit %d, filter %v: got rows %q, want %q", test.limit, test.filter, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bttest
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+)
+
+// snapshotMagic begins every snapshot, and identifies the format version.
+const snapshotMagic = "bttest snapshot v1\n"
+
+// A snapshot starts with snapshotMagic, followed by the number of tables
+// as a uvarint. Each table is then written as a btapb.Table record holding
+// its name and column families with their GC rules, the number of rows as a
+// uvarint, and that many btpb.Row records. A record is a serialized protocol
+// buffer preceded by its length as a uvarint.
+//
+// Tables, rows, families and columns are written in sorted order,
+// so the same data always produces the same snapshot.
+
+// Snapshot writes the tables, column families, GC rules and cells
+// held by the server to w, in a format that Restore can read.
+// Each row is read atomically, but the snapshot as a whole is not;
+// writes that are concurrent with Snapshot may or may not be included.
+func (s *Server) Snapshot(w io.Writer) error {
+	s.s.mu.Lock()
+	names := make([]string, 0, len(s.s.tables))
+	tables := make(map[string]*table, len(s.s.tables))
+	for name, tbl := range s.s.tables {
+		names = append(names, name)
+		tables[name] = tbl
+	}
+	s.s.mu.Unlock()
+	sort.Strings(names)
+
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(snapshotMagic); err != nil {
+		return err
+	}
+	if err := writeUvarint(bw, uint64(len(names))); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := tables[name].snapshot(bw, name); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (t *table) snapshot(w *bufio.Writer, name string) error {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if err := writeRecord(w, &btapb.Table{
+		Name:           name,
+		ColumnFamilies: toColumnFamilies(t.families),
+	}); err != nil {
+		return err
+	}
+	if err := writeUvarint(w, uint64(len(t.rows))); err != nil {
+		return err
+	}
+	for _, r := range t.rows {
+		r.mu.Lock()
+		pr := r.proto()
+		r.mu.Unlock()
+		if err := writeRecord(w, pr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proto returns the row as a btpb.Row, with families and columns in sorted order.
+// r.mu should be held.
+func (r *row) proto() *btpb.Row {
+	pr := &btpb.Row{Key: []byte(r.key)}
+	var fam *btpb.Family
+	for _, col := range r.sortedColumns() {
+		cs := r.cells[col]
+		if len(cs) == 0 {
+			continue
+		}
+		f, q := splitColumn(col)
+		if fam == nil || fam.Name != f {
+			fam = &btpb.Family{Name: f}
+			pr.Families = append(pr.Families, fam)
+		}
+		pc := &btpb.Column{Qualifier: []byte(q)}
+		for _, c := range cs {
+			pc.Cells = append(pc.Cells, &btpb.Cell{TimestampMicros: c.ts, Value: c.value})
+		}
+		fam.Columns = append(fam.Columns, pc)
+	}
+	return pr
+}
+
+// Restore reads a snapshot written by Snapshot and adds its tables to the server.
+// It returns an error, and adds no tables, if the snapshot is malformed
+// or if any of its tables already exist.
+func (s *Server) Restore(r io.Reader) error {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return fmt.Errorf("bttest: reading snapshot header: %v", err)
+	}
+	if string(magic) != snapshotMagic {
+		return errors.New("bttest: not a snapshot, or unsupported snapshot version")
+	}
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return fmt.Errorf("bttest: reading table count: %v", err)
+	}
+
+	tables := make(map[string]*table)
+	for i := uint64(0); i < n; i++ {
+		name, tbl, err := restoreTable(br)
+		if err != nil {
+			return err
+		}
+		if _, ok := tables[name]; ok {
+			return fmt.Errorf("bttest: table %q appears twice in snapshot", name)
+		}
+		tables[name] = tbl
+	}
+
+	s.s.mu.Lock()
+	for name := range tables {
+		if _, ok := s.s.tables[name]; ok {
+			s.s.mu.Unlock()
+			return fmt.Errorf("bttest: table %q already exists", name)
+		}
+	}
+	gc := false
+	for name, tbl := range tables {
+		s.s.tables[name] = tbl
+		for _, cf := range tbl.families {
+			gc = gc || cf.gcRule != nil
+		}
+	}
+	s.s.mu.Unlock()
+
+	if gc {
+		s.s.needGC()
+	}
+	return nil
+}
+
+func restoreTable(br *bufio.Reader) (string, *table, error) {
+	var pt btapb.Table
+	if err := readRecord(br, &pt); err != nil {
+		return "", nil, fmt.Errorf("bttest: reading table: %v", err)
+	}
+	tbl := &table{
+		families: make(map[string]*columnFamily),
+		rowIndex: make(map[string]*row),
+	}
+	for id, cf := range pt.ColumnFamilies {
+		tbl.families[id] = &columnFamily{
+			name:   pt.Name + "/columnFamilies/" + id,
+			gcRule: cf.GcRule,
+		}
+	}
+	nrows, err := binary.ReadUvarint(br)
+	if err != nil {
+		return "", nil, fmt.Errorf("bttest: reading row count of table %q: %v", pt.Name, err)
+	}
+	for i := uint64(0); i < nrows; i++ {
+		var pr btpb.Row
+		if err := readRecord(br, &pr); err != nil {
+			return "", nil, fmt.Errorf("bttest: reading row of table %q: %v", pt.Name, err)
+		}
+		r := newRow(string(pr.Key))
+		if _, ok := tbl.rowIndex[r.key]; ok {
+			return "", nil, fmt.Errorf("bttest: row %q appears twice in table %q", r.key, pt.Name)
+		}
+		for _, fam := range pr.Families {
+			if _, ok := tbl.families[fam.Name]; !ok {
+				return "", nil, fmt.Errorf("bttest: row %q of table %q uses unknown family %q", r.key, pt.Name, fam.Name)
+			}
+			for _, col := range fam.Columns {
+				var cs []cell
+				for _, c := range col.Cells {
+					cs = append(cs, cell{ts: c.TimestampMicros, value: c.Value})
+				}
+				sort.Sort(byDescTS(cs))
+				r.setCells(fmt.Sprintf("%s:%s", fam.Name, col.Qualifier), cs)
+			}
+		}
+		tbl.rowIndex[r.key] = r
+		tbl.rows = append(tbl.rows, r)
+	}
+	sort.Sort(byRowKey(tbl.rows))
+	return pt.Name, tbl, nil
+}
+
+func writeUvarint(w *bufio.Writer, x uint64) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, err := w.Write(buf[:binary.PutUvarint(buf[:], x)])
+	return err
+}
+
+func writeRecord(w *bufio.Writer, m proto.Message) error {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if err := writeUvarint(w, uint64(len(b))); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// maxRecordSize bounds the size of a single record, to guard against
+// allocating huge buffers when reading a corrupt snapshot.
+const maxRecordSize = 1 << 30
+
+func readRecord(br *bufio.Reader, m proto.Message) error {
+	n, err := binary.ReadUvarint(br)
+	if err != nil {
+		return err
+	}
+	if n > maxRecordSize {
+		return fmt.Errorf("record too large (%d bytes)", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, m)
+}
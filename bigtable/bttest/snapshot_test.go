@@ -0,0 +1,127 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bttest
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+	btapb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	src, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	ctx := context.Background()
+
+	gcRule := &btapb.GcRule{Rule: &btapb.GcRule_MaxNumVersions{MaxNumVersions: 2}}
+	tblInfo, err := src.s.CreateTable(ctx, &btapb.CreateTableRequest{
+		Parent:  "cluster",
+		TableId: "t",
+		Table: &btapb.Table{ColumnFamilies: map[string]*btapb.ColumnFamily{
+			"cf":    {GcRule: gcRule},
+			"other": {},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCell := func(fam, col string, ts int64, value string) *btpb.Mutation {
+		return &btpb.Mutation{Mutation: &btpb.Mutation_SetCell_{SetCell: &btpb.Mutation_SetCell{
+			FamilyName:      fam,
+			ColumnQualifier: []byte(col),
+			TimestampMicros: ts,
+			Value:           []byte(value),
+		}}}
+	}
+	for _, key := range []string{"b", "a", "c"} {
+		req := &btpb.MutateRowRequest{
+			TableName: tblInfo.Name,
+			RowKey:    []byte(key),
+			Mutations: []*btpb.Mutation{
+				setCell("cf", "x", 1000, key+"1"),
+				setCell("cf", "x", 2000, key+"2"),
+				setCell("other", "y", 1000, key),
+			},
+		}
+		if _, err := src.s.MutateRow(ctx, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := src.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	snap := buf.Bytes()
+
+	dst, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	if err := dst.Restore(bytes.NewReader(snap)); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+
+	got, err := dst.s.GetTable(ctx, &btapb.GetTableRequest{Name: tblInfo.Name})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ColumnFamilies) != 2 || got.ColumnFamilies["cf"].GcRule.GetMaxNumVersions() != 2 {
+		t.Errorf("restored column families = %v, want cf with MaxNumVersions(2) and other", got.ColumnFamilies)
+	}
+	srcTbl, dstTbl := src.s.tables[tblInfo.Name], dst.s.tables[tblInfo.Name]
+	if len(dstTbl.rows) != len(srcTbl.rows) {
+		t.Fatalf("restored %d rows, want %d", len(dstTbl.rows), len(srcTbl.rows))
+	}
+	for i, r := range srcTbl.rows {
+		if got, want := dstTbl.rows[i].proto(), r.proto(); !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: got %v, want %v", i, got, want)
+		}
+	}
+
+	// Snapshots of the same data are identical.
+	buf.Reset()
+	if err := dst.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot of restored server: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), snap) {
+		t.Error("snapshot of restored server differs from original snapshot")
+	}
+
+	// Restoring over existing tables fails.
+	if err := dst.Restore(bytes.NewReader(snap)); err == nil {
+		t.Error("Restore over existing tables: got nil error, want error")
+	}
+	// Truncated snapshots are rejected.
+	empty, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	if err := empty.Restore(bytes.NewReader(snap[:len(snap)-1])); err == nil {
+		t.Error("Restore of truncated snapshot: got nil error, want error")
+	}
+	if len(empty.s.tables) != 0 {
+		t.Errorf("Restore of truncated snapshot added %d tables, want 0", len(empty.s.tables))
+	}
+}
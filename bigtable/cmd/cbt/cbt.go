@@ -51,9 +51,9 @@ var (
 func getClient() *bigtable.Client {
 	if client == nil {
 		var err error
-		client, err = bigtable.NewClient(context.Background(), config.Project, config.Instance)
+		client, err = bigtable.NewClient(context.Background(), config.Project, config.Instance, config.DataOptions()...)
 		if err != nil {
-			log.Fatalf("Making bigtable.Client: %v", err)
+			fatalf("Making bigtable.Client: %v", err)
 		}
 	}
 	return client
@@ -62,9 +62,9 @@ func getClient() *bigtable.Client {
 func getAdminClient() *bigtable.AdminClient {
 	if adminClient == nil {
 		var err error
-		adminClient, err = bigtable.NewAdminClient(context.Background(), config.Project, config.Instance)
+		adminClient, err = bigtable.NewAdminClient(context.Background(), config.Project, config.Instance, config.AdminOptions()...)
 		if err != nil {
-			log.Fatalf("Making bigtable.AdminClient: %v", err)
+			fatalf("Making bigtable.AdminClient: %v", err)
 		}
 	}
 	return adminClient
@@ -73,30 +73,58 @@ func getAdminClient() *bigtable.AdminClient {
 func getInstanceAdminClient() *bigtable.InstanceAdminClient {
 	if instanceAdminClient == nil {
 		var err error
-		instanceAdminClient, err = bigtable.NewInstanceAdminClient(context.Background(), config.Project)
+		instanceAdminClient, err = bigtable.NewInstanceAdminClient(context.Background(), config.Project, config.AdminOptions()...)
 		if err != nil {
-			log.Fatalf("Making bigtable.InstanceAdminClient: %v", err)
+			fatalf("Making bigtable.InstanceAdminClient: %v", err)
 		}
 	}
 	return instanceAdminClient
 }
 
+// fatalf logs a message and aborts the current command.
+// Outside of cbt shell, that exits the program.
+// It must be called on the goroutine running the command, since the shell
+// only recovers the abort there; callbacks run on other goroutines should
+// record their errors for the command to report.
+func fatalf(format string, args ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, args...))
+	abort()
+}
+
+// fatal is like fatalf, but formats its arguments like fmt.Sprint.
+func fatal(args ...interface{}) {
+	log.Output(2, fmt.Sprint(args...))
+	abort()
+}
+
+// abort stops the current command. In cbt shell it panics with
+// errCommandFailed, which the shell recovers.
+func abort() {
+	if inShell {
+		panic(errCommandFailed)
+	}
+	os.Exit(1)
+}
+
 func main() {
 	var err error
 	config, err = cbtrc.Load()
 	if err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	config.RegisterFlags()
 
 	flag.Usage = func() { usage(os.Stderr) }
 	flag.Parse()
 	if err := config.CheckFlags(); err != nil {
-		log.Fatal(err)
+		fatal(err)
 	}
 	if config.Creds != "" {
 		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", config.Creds)
 	}
+	if config.Emulator != "" {
+		os.Setenv("BIGTABLE_EMULATOR_HOST", config.Emulator)
+	}
 	if flag.NArg() == 0 {
 		usage(os.Stderr)
 		os.Exit(1)
@@ -105,11 +133,11 @@ func main() {
 	if *oFlag != "" {
 		f, err := os.Create(*oFlag)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 		defer func() {
 			if err := f.Close(); err != nil {
-				log.Fatal(err)
+				fatal(err)
 			}
 		}()
 		os.Stdout = f
@@ -122,7 +150,7 @@ func main() {
 			return
 		}
 	}
-	log.Fatalf("Unknown command %q", flag.Arg(0))
+	fatalf("Unknown command %q", flag.Arg(0))
 }
 
 func usage(w io.Writer) {
@@ -146,12 +174,21 @@ func init() {
 }
 
 var configHelp = `
-For convenience, values of the -project, -instance and -creds flags
-may be specified in ` + cbtrc.Filename() + ` in this format:
+For convenience, values of the -project, -instance, -creds, -emulator,
+-admin-endpoint and -data-endpoint flags may be specified in
+` + cbtrc.Filename() + ` in this format:
 	project = my-project-123
 	instance = my-instance
 	creds = path-to-account-key.json
+	admin-endpoint = hostname:port
+	data-endpoint = hostname:port
+	emulator = localhost:9000
 All values are optional, and all will be overridden by flags.
+
+Values may be grouped into named profiles, which override the values
+at the top of the file when selected with -profile or $` + cbtrc.ProfileEnv + `:
+	[staging]
+	instance = my-staging-instance
 `
 
 var commands = []struct {
@@ -171,6 +208,18 @@ var commands = []struct {
 		do:    doCreateFamily,
 		Usage: "cbt createfamily <table> <family>",
 	},
+	{
+		Name: "createinstance",
+		Desc: "Create an instance with an initial cluster",
+		do:   doCreateInstance,
+		Usage: "cbt createinstance <instance-id> <display-name> <cluster-id> <zone> <num-nodes> <storage-type>\n" +
+			"  instance-id		Permanent, unique id for the instance\n" +
+			"  display-name		Description of the instance\n" +
+			"  cluster-id		Permanent, unique id for the cluster in the instance\n" +
+			"  zone			The zone in which to create the cluster\n" +
+			"  num-nodes		The number of nodes to create\n" +
+			"  storage-type		SSD or HDD\n",
+	},
 	{
 		Name:  "createtable",
 		Desc:  "Create a table",
@@ -183,6 +232,12 @@ var commands = []struct {
 		do:    doDeleteFamily,
 		Usage: "cbt deletefamily <table> <family>",
 	},
+	{
+		Name:  "deleteinstance",
+		Desc:  "Delete an instance",
+		do:    doDeleteInstance,
+		Usage: "cbt deleteinstance <instance>",
+	},
 	{
 		Name:  "deleterow",
 		Desc:  "Delete a row",
@@ -201,12 +256,45 @@ var commands = []struct {
 		do:    doDoc,
 		Usage: "cbt doc",
 	},
+	{
+		Name: "export",
+		Desc: "Export rows to a file",
+		do:   doExport,
+		Usage: "cbt export <table> [start=<row>] [end=<row>] [prefix=<prefix>] [format=<format>]\n" +
+			"	[values=<enc>] [file=<file>]\n" +
+			"  start=<row>		Start exporting at this row\n" +
+			"  end=<row>		Stop exporting before this row\n" +
+			"  prefix=<prefix>	Export rows with this prefix\n" +
+			"  format=<format>	Output format, csv or jsonl (default jsonl, or from the file extension)\n" +
+			"  values=<enc>		Encoding of csv values, base64 (default) or text\n" +
+			"  file=<file>		Write to this file instead of stdout\n" +
+			"\n" +
+			"  The jsonl format writes one JSON object per row, with base64-encoded values.\n" +
+			"  The csv format writes a header line, then one row,family:column,timestamp,value\n" +
+			"  line per cell. values=text writes values unencoded, which suits only textual\n" +
+			"  values: other bytes, and carriage returns, do not survive import.",
+	},
 	{
 		Name:  "help",
 		Desc:  "Print help text",
 		do:    doHelp,
 		Usage: "cbt help [command]",
 	},
+	{
+		Name: "import",
+		Desc: "Import rows from a file",
+		do:   doImport,
+		Usage: "cbt import <table> <file> [format=<format>] [map=<from>:<to> ...]\n" +
+			"  <file>			File written by cbt export, or - for stdin\n" +
+			"  format=<format>	Input format, csv or jsonl (default from the file extension)\n" +
+			"  map=<from>:<to>	Write cells in family <from> to family <to>; may be repeated",
+	},
+	{
+		Name:  "listclusters",
+		Desc:  "List clusters in an instance",
+		do:    doListClusters,
+		Usage: "cbt listclusters",
+	},
 	{
 		Name:  "listinstances",
 		Desc:  "List instances in a project",
@@ -214,10 +302,11 @@ var commands = []struct {
 		Usage: "cbt listinstances",
 	},
 	{
-		Name:  "lookup",
-		Desc:  "Read from a single row",
-		do:    doLookup,
-		Usage: "cbt lookup <table> <row>",
+		Name: "lookup",
+		Desc: "Read from a single row",
+		do:   doLookup,
+		Usage: "cbt lookup <table> <row> [format=<format>] [decode=<type>] [filter=<expr>]\n" +
+			formatHelp + filterHelp,
 	},
 	{
 		Name: "ls",
@@ -237,10 +326,12 @@ var commands = []struct {
 		Desc: "Read rows",
 		do:   doRead,
 		Usage: "cbt read <table> [start=<row>] [end=<row>] [prefix=<prefix>] [count=<n>]\n" +
+			"	[format=<format>] [decode=<type>] [filter=<expr>]\n" +
 			"  start=<row>		Start reading at this row\n" +
 			"  end=<row>		Stop reading before this row\n" +
 			"  prefix=<prefix>	Read rows with this prefix\n" +
-			"  count=<n>		Read only this many rows\n",
+			"  count=<n>		Read only this many rows\n" +
+			formatHelp + filterHelp,
 	},
 	{
 		Name: "set",
@@ -262,11 +353,34 @@ var commands = []struct {
 			`  maxage=<d>		Maximum timestamp age to preserve (e.g. "1h", "4d")` + "\n" +
 			"  maxversions=<n>	Maximum number of versions to preserve",
 	},
+	{
+		Name: "shell",
+		Desc: "Run commands interactively",
+		do:   doShell,
+		Usage: "cbt shell\n" +
+			"  Runs cbt commands, without the leading \"cbt\", reusing one set of clients.\n" +
+			"  End a line with a tab to list the completions of its last word, which may be\n" +
+			"  a command, table, family or instance name.\n" +
+			"  History is saved in ~/.cbt_history.\n" +
+			"\n" +
+			"  Additional commands:\n" +
+			"  exit			Leave the shell\n" +
+			"  history		Print the command history\n" +
+			"  use <instance>		Switch to another instance in the same project",
+	},
+	{
+		Name: "updatecluster",
+		Desc: "Update a cluster in the configured instance",
+		do:   doUpdateCluster,
+		Usage: "cbt updatecluster <cluster-id> [num-nodes=num-nodes]\n" +
+			"  cluster-id		Permanent, unique id for the cluster in the instance\n" +
+			"  num-nodes		The number of nodes to update to",
+	},
 }
 
 func doCount(ctx context.Context, args ...string) {
 	if len(args) != 1 {
-		log.Fatal("usage: cbt count <table>")
+		fatal("usage: cbt count <table>")
 	}
 	tbl := getClient().Open(args[0])
 
@@ -276,60 +390,104 @@ func doCount(ctx context.Context, args ...string) {
 		return true
 	}, bigtable.RowFilter(bigtable.StripValueFilter()))
 	if err != nil {
-		log.Fatalf("Reading rows: %v", err)
+		fatalf("Reading rows: %v", err)
 	}
 	fmt.Println(n)
 }
 
 func doCreateFamily(ctx context.Context, args ...string) {
 	if len(args) != 2 {
-		log.Fatal("usage: cbt createfamily <table> <family>")
+		fatal("usage: cbt createfamily <table> <family>")
 	}
 	err := getAdminClient().CreateColumnFamily(ctx, args[0], args[1])
 	if err != nil {
-		log.Fatalf("Creating column family: %v", err)
+		fatalf("Creating column family: %v", err)
+	}
+}
+
+func doCreateInstance(ctx context.Context, args ...string) {
+	if len(args) != 6 {
+		fatal("usage: cbt createinstance <instance-id> <display-name> <cluster-id> <zone> <num-nodes> <storage-type>")
+	}
+	sn, err := strconv.ParseInt(args[4], 0, 32)
+	if err != nil {
+		fatalf("Bad num-nodes %q: %v", args[4], err)
+	}
+	st, err := parseStorageType(args[5])
+	if err != nil {
+		fatal(err)
+	}
+	ic := bigtable.InstanceConf{
+		InstanceId:  args[0],
+		DisplayName: args[1],
+		ClusterId:   args[2],
+		Zone:        args[3],
+		NumNodes:    int32(sn),
+		StorageType: st,
+	}
+	if err := getInstanceAdminClient().CreateInstance(ctx, &ic); err != nil {
+		fatalf("Creating instance: %v", err)
 	}
 }
 
+func parseStorageType(s string) (bigtable.StorageType, error) {
+	switch s {
+	case "SSD":
+		return bigtable.SSD, nil
+	case "HDD":
+		return bigtable.HDD, nil
+	}
+	return -1, fmt.Errorf("Invalid storage type %q; want SSD or HDD", s)
+}
+
 func doCreateTable(ctx context.Context, args ...string) {
 	if len(args) != 1 {
-		log.Fatal("usage: cbt createtable <table>")
+		fatal("usage: cbt createtable <table>")
 	}
 	err := getAdminClient().CreateTable(ctx, args[0])
 	if err != nil {
-		log.Fatalf("Creating table: %v", err)
+		fatalf("Creating table: %v", err)
 	}
 }
 
 func doDeleteFamily(ctx context.Context, args ...string) {
 	if len(args) != 2 {
-		log.Fatal("usage: cbt deletefamily <table> <family>")
+		fatal("usage: cbt deletefamily <table> <family>")
 	}
 	err := getAdminClient().DeleteColumnFamily(ctx, args[0], args[1])
 	if err != nil {
-		log.Fatalf("Deleting column family: %v", err)
+		fatalf("Deleting column family: %v", err)
+	}
+}
+
+func doDeleteInstance(ctx context.Context, args ...string) {
+	if len(args) != 1 {
+		fatal("usage: cbt deleteinstance <instance>")
+	}
+	if err := getInstanceAdminClient().DeleteInstance(ctx, args[0]); err != nil {
+		fatalf("Deleting instance: %v", err)
 	}
 }
 
 func doDeleteRow(ctx context.Context, args ...string) {
 	if len(args) != 2 {
-		log.Fatal("usage: cbt deleterow <table> <row>")
+		fatal("usage: cbt deleterow <table> <row>")
 	}
 	tbl := getClient().Open(args[0])
 	mut := bigtable.NewMutation()
 	mut.DeleteRow()
 	if err := tbl.Apply(ctx, args[1], mut); err != nil {
-		log.Fatalf("Deleting row: %v", err)
+		fatalf("Deleting row: %v", err)
 	}
 }
 
 func doDeleteTable(ctx context.Context, args ...string) {
 	if len(args) != 1 {
-		log.Fatalf("Can't do `cbt deletetable %s`", args)
+		fatalf("Can't do `cbt deletetable %s`", args)
 	}
 	err := getAdminClient().DeleteTable(ctx, args[0])
 	if err != nil {
-		log.Fatalf("Deleting table: %v", err)
+		fatalf("Deleting table: %v", err)
 	}
 }
 
@@ -338,25 +496,28 @@ var (
 	doDocFn   func(ctx context.Context, args ...string)
 	doHelpFn  func(ctx context.Context, args ...string)
 	doMDDocFn func(ctx context.Context, args ...string)
+	doShellFn func(ctx context.Context, args ...string)
 )
 
 func init() {
 	doDocFn = doDocReal
 	doHelpFn = doHelpReal
 	doMDDocFn = doMDDocReal
+	doShellFn = doShellReal
 }
 
 func doDoc(ctx context.Context, args ...string)   { doDocFn(ctx, args...) }
 func doHelp(ctx context.Context, args ...string)  { doHelpFn(ctx, args...) }
 func doMDDoc(ctx context.Context, args ...string) { doMDDocFn(ctx, args...) }
+func doShell(ctx context.Context, args ...string) { doShellFn(ctx, args...) }
 
 func docFlags() []*flag.Flag {
 	// Only include specific flags, in a specific order.
 	var flags []*flag.Flag
-	for _, name := range []string{"project", "instance", "creds"} {
+	for _, name := range []string{"project", "instance", "creds", "profile", "emulator", "admin-endpoint", "data-endpoint"} {
 		f := flag.Lookup(name)
 		if f == nil {
-			log.Fatalf("Flag not linked: -%s", name)
+			fatalf("Flag not linked: -%s", name)
 		}
 		flags = append(flags, f)
 	}
@@ -370,11 +531,11 @@ func doDocReal(ctx context.Context, args ...string) {
 	}
 	var buf bytes.Buffer
 	if err := docTemplate.Execute(&buf, data); err != nil {
-		log.Fatalf("Bad doc template: %v", err)
+		fatalf("Bad doc template: %v", err)
 	}
 	out, err := format.Source(buf.Bytes())
 	if err != nil {
-		log.Fatalf("Bad doc output: %v", err)
+		fatalf("Bad doc output: %v", err)
 	}
 	os.Stdout.Write(out)
 }
@@ -393,7 +554,7 @@ var docTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
 	Parse(`
 // DO NOT EDIT. THIS IS AUTOMATICALLY GENERATED.
 // Run "go generate" to regenerate.
-//go:generate go run cbt.go -o cbtdoc.go doc
+//go:generate go run cbt.go dataio.go filterexpr.go rowfmt.go shell.go -o cbtdoc.go doc
 
 /*
 Cbt is a tool for doing basic interactions with Cloud Bigtable.
@@ -437,16 +598,16 @@ func doHelpReal(ctx context.Context, args ...string) {
 			return
 		}
 	}
-	log.Fatalf("Don't know command %q", args[0])
+	fatalf("Don't know command %q", args[0])
 }
 
 func doListInstances(ctx context.Context, args ...string) {
 	if len(args) != 0 {
-		log.Fatalf("usage: cbt listinstances")
+		fatalf("usage: cbt listinstances")
 	}
 	is, err := getInstanceAdminClient().Instances(ctx)
 	if err != nil {
-		log.Fatalf("Getting list of instances: %v", err)
+		fatalf("Getting list of instances: %v", err)
 	}
 	tw := tabwriter.NewWriter(os.Stdout, 10, 8, 4, '\t', 0)
 	fmt.Fprintf(tw, "Instance Name\tInfo\n")
@@ -457,37 +618,60 @@ func doListInstances(ctx context.Context, args ...string) {
 	tw.Flush()
 }
 
+func doListClusters(ctx context.Context, args ...string) {
+	if len(args) != 0 {
+		fatalf("usage: cbt listclusters")
+	}
+	cis, err := getInstanceAdminClient().Clusters(ctx, config.Instance)
+	if err != nil {
+		fatalf("Getting list of clusters: %v", err)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 10, 8, 4, '\t', 0)
+	fmt.Fprintf(tw, "Cluster Name\tZone\tNodes\tStorage\tState\n")
+	fmt.Fprintf(tw, "------------\t----\t-----\t-------\t-----\n")
+	for _, ci := range cis {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\t%s\n", ci.Name, ci.Zone, ci.ServeNodes, ci.StorageType, ci.State)
+	}
+	tw.Flush()
+}
+
 func doLookup(ctx context.Context, args ...string) {
-	if len(args) != 2 {
-		log.Fatalf("usage: cbt lookup <table> <row>")
+	if len(args) < 2 {
+		fatalf("usage: cbt lookup <table> <row> [args ...]")
 	}
 	table, row := args[0], args[1]
+	parsed, _ := parseArgs(args[2:], []string{"format", "decode", "filter"}, nil)
+	p, opts := printOptions(parsed)
+
 	tbl := getClient().Open(table)
-	r, err := tbl.ReadRow(ctx, row)
+	r, err := tbl.ReadRow(ctx, row, opts...)
 	if err != nil {
-		log.Fatalf("Reading row: %v", err)
+		fatalf("Reading row: %v", err)
+	}
+	if err := p.printRow(r); err != nil {
+		fatalf("Printing row: %v", err)
+	}
+	if err := p.flush(); err != nil {
+		fatalf("Printing row: %v", err)
 	}
-	printRow(r)
 }
 
-func printRow(r bigtable.Row) {
-	fmt.Println(strings.Repeat("-", 40))
-	fmt.Println(r.Key())
-
-	var fams []string
-	for fam := range r {
-		fams = append(fams, fam)
+// printOptions returns the row printer and read options selected by
+// the format, decode and filter args of read and lookup.
+func printOptions(parsed map[string]string) (rowPrinter, []bigtable.ReadOption) {
+	p, err := newRowPrinter(os.Stdout, parsed["format"], parsed["decode"])
+	if err != nil {
+		fatal(err)
 	}
-	sort.Strings(fams)
-	for _, fam := range fams {
-		ris := r[fam]
-		sort.Sort(byColumn(ris))
-		for _, ri := range ris {
-			ts := time.Unix(0, int64(ri.Timestamp)*1e3)
-			fmt.Printf("  %-40s @ %s\n", ri.Column, ts.Format("2006/01/02-15:04:05.000000"))
-			fmt.Printf("    %q\n", ri.Value)
+	var opts []bigtable.ReadOption
+	if expr := parsed["filter"]; expr != "" {
+		f, err := parseFilter(expr)
+		if err != nil {
+			fatal(err)
 		}
+		opts = append(opts, bigtable.RowFilter(f))
 	}
+	return p, opts
 }
 
 type byColumn []bigtable.ReadItem
@@ -499,11 +683,11 @@ func (b byColumn) Less(i, j int) bool { return b[i].Column < b[j].Column }
 func doLS(ctx context.Context, args ...string) {
 	switch len(args) {
 	default:
-		log.Fatalf("Can't do `cbt ls %s`", args)
+		fatalf("Can't do `cbt ls %s`", args)
 	case 0:
 		tables, err := getAdminClient().Tables(ctx)
 		if err != nil {
-			log.Fatalf("Getting list of tables: %v", err)
+			fatalf("Getting list of tables: %v", err)
 		}
 		sort.Strings(tables)
 		for _, table := range tables {
@@ -513,7 +697,7 @@ func doLS(ctx context.Context, args ...string) {
 		table := args[0]
 		ti, err := getAdminClient().TableInfo(ctx, table)
 		if err != nil {
-			log.Fatalf("Getting table info: %v", err)
+			fatalf("Getting table info: %v", err)
 		}
 		sort.Strings(ti.Families)
 		for _, fam := range ti.Families {
@@ -529,7 +713,7 @@ func doMDDocReal(ctx context.Context, args ...string) {
 	}
 	var buf bytes.Buffer
 	if err := mddocTemplate.Execute(&buf, data); err != nil {
-		log.Fatalf("Bad mddoc template: %v", err)
+		fatalf("Bad mddoc template: %v", err)
 	}
 	io.Copy(os.Stdout, &buf)
 }
@@ -567,7 +751,7 @@ The options are:
 
 func doRead(ctx context.Context, args ...string) {
 	if len(args) < 1 {
-		log.Fatalf("usage: cbt read <table> [args ...]")
+		fatalf("usage: cbt read <table> [args ...]")
 	}
 	tbl := getClient().Open(args[0])
 
@@ -575,21 +759,21 @@ func doRead(ctx context.Context, args ...string) {
 	for _, arg := range args[1:] {
 		i := strings.Index(arg, "=")
 		if i < 0 {
-			log.Fatalf("Bad arg %q", arg)
+			fatalf("Bad arg %q", arg)
 		}
 		key, val := arg[:i], arg[i+1:]
 		switch key {
 		default:
-			log.Fatalf("Unknown arg key %q", key)
+			fatalf("Unknown arg key %q", key)
 		case "limit":
 			// Be nicer; we used to support this, but renamed it to "end".
-			log.Fatalf("Unknown arg key %q; did you mean %q?", key, "end")
-		case "start", "end", "prefix", "count":
+			fatalf("Unknown arg key %q; did you mean %q?", key, "end")
+		case "start", "end", "prefix", "count", "format", "decode", "filter":
 			parsed[key] = val
 		}
 	}
 	if (parsed["start"] != "" || parsed["end"] != "") && parsed["prefix"] != "" {
-		log.Fatal(`"start"/"end" may not be mixed with "prefix"`)
+		fatal(`"start"/"end" may not be mixed with "prefix"`)
 	}
 
 	var rr bigtable.RowRange
@@ -602,22 +786,28 @@ func doRead(ctx context.Context, args ...string) {
 		rr = bigtable.PrefixRange(prefix)
 	}
 
-	var opts []bigtable.ReadOption
+	p, opts := printOptions(parsed)
 	if count := parsed["count"]; count != "" {
 		n, err := strconv.ParseInt(count, 0, 64)
 		if err != nil {
-			log.Fatalf("Bad count %q: %v", count, err)
+			fatalf("Bad count %q: %v", count, err)
 		}
 		opts = append(opts, bigtable.LimitRows(n))
 	}
 
-	// TODO(dsymonds): Support filters.
+	var perr error
 	err := tbl.ReadRows(ctx, rr, func(r bigtable.Row) bool {
-		printRow(r)
-		return true
+		perr = p.printRow(r)
+		return perr == nil
 	}, opts...)
 	if err != nil {
-		log.Fatalf("Reading rows: %v", err)
+		fatalf("Reading rows: %v", err)
+	}
+	if perr == nil {
+		perr = p.flush()
+	}
+	if perr != nil {
+		fatalf("Printing rows: %v", perr)
 	}
 }
 
@@ -625,7 +815,7 @@ var setArg = regexp.MustCompile(`([^:]+):([^=]*)=(.*)`)
 
 func doSet(ctx context.Context, args ...string) {
 	if len(args) < 3 {
-		log.Fatalf("usage: cbt set <table> <row> family:[column]=val[@ts] ...")
+		fatalf("usage: cbt set <table> <row> family:[column]=val[@ts] ...")
 	}
 	tbl := getClient().Open(args[0])
 	row := args[1]
@@ -633,7 +823,7 @@ func doSet(ctx context.Context, args ...string) {
 	for _, arg := range args[2:] {
 		m := setArg.FindStringSubmatch(arg)
 		if m == nil {
-			log.Fatalf("Bad set arg %q", arg)
+			fatalf("Bad set arg %q", arg)
 		}
 		val := m[3]
 		ts := bigtable.Now()
@@ -648,13 +838,13 @@ func doSet(ctx context.Context, args ...string) {
 		mut.Set(m[1], m[2], ts, []byte(val))
 	}
 	if err := tbl.Apply(ctx, row, mut); err != nil {
-		log.Fatalf("Applying mutation: %v", err)
+		fatalf("Applying mutation: %v", err)
 	}
 }
 
 func doSetGCPolicy(ctx context.Context, args ...string) {
 	if len(args) < 3 {
-		log.Fatalf("usage: cbt setgcpolicy <table> <family> ( maxage=<d> | maxversions=<n> )")
+		fatalf("usage: cbt setgcpolicy <table> <family> ( maxage=<d> | maxversions=<n> )")
 	}
 	table := args[0]
 	fam := args[1]
@@ -664,20 +854,39 @@ func doSetGCPolicy(ctx context.Context, args ...string) {
 	case strings.HasPrefix(p, "maxage="):
 		d, err := parseDuration(p[7:])
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 		pol = bigtable.MaxAgePolicy(d)
 	case strings.HasPrefix(p, "maxversions="):
 		n, err := strconv.ParseUint(p[12:], 10, 16)
 		if err != nil {
-			log.Fatal(err)
+			fatal(err)
 		}
 		pol = bigtable.MaxVersionsPolicy(int(n))
 	default:
-		log.Fatalf("Bad GC policy %q", p)
+		fatalf("Bad GC policy %q", p)
 	}
 	if err := getAdminClient().SetGCPolicy(ctx, table, fam, pol); err != nil {
-		log.Fatalf("Setting GC policy: %v", err)
+		fatalf("Setting GC policy: %v", err)
+	}
+}
+
+func doUpdateCluster(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		fatal("usage: cbt updatecluster <cluster-id> [num-nodes=num-nodes]")
+	}
+	clusterId := args[0]
+	parsed, _ := parseArgs(args[1:], []string{"num-nodes"}, nil)
+	nodes := parsed["num-nodes"]
+	if nodes == "" {
+		fatal("Nothing to update; want num-nodes=<n>")
+	}
+	sn, err := strconv.ParseInt(nodes, 0, 32)
+	if err != nil {
+		fatalf("Bad num-nodes %q: %v", nodes, err)
+	}
+	if err := getInstanceAdminClient().UpdateCluster(ctx, config.Instance, clusterId, int32(sn)); err != nil {
+		fatalf("Updating cluster: %v", err)
 	}
 }
 
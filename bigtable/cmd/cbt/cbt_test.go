@@ -15,8 +15,14 @@
 package main
 
 import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"cloud.google.com/go/bigtable"
 )
 
 func TestParseDuration(t *testing.T) {
@@ -57,3 +63,226 @@ func TestParseDuration(t *testing.T) {
 		}
 	}
 }
+
+func TestRowFormats(t *testing.T) {
+	textRows := []dataRow{
+		{Key: "row1", Cells: []dataCell{
+			{Column: "fam:a", Timestamp: 2000, Value: []byte("one")},
+			{Column: "fam:a", Timestamp: 1000, Value: []byte("old")},
+			{Column: "fam:b", Timestamp: 1000, Value: []byte("with,comma and \"quotes\"")},
+		}},
+		{Key: "row2", Cells: []dataCell{
+			{Column: "other:", Timestamp: 0, Value: []byte("")},
+		}},
+	}
+	binaryRows := append(textRows[:len(textRows):len(textRows)], dataRow{Key: "row3", Cells: []dataCell{
+		{Column: "fam:bin", Timestamp: 1000, Value: []byte{0, 0xff, 0xfe, '\n'}},
+		{Column: "fam:crlf", Timestamp: 1000, Value: []byte("line1\r\nline2\r")},
+	}})
+	for _, test := range []struct {
+		desc       string
+		format     string
+		textValues bool
+		rows       []dataRow
+	}{
+		{"csv", "csv", false, binaryRows},
+		{"csv with text values", "csv", true, textRows},
+		{"jsonl", "jsonl", false, binaryRows},
+	} {
+		var buf bytes.Buffer
+		w, err := newRowWriter(test.format, &buf, test.textValues)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range test.rows {
+			if err := w.WriteRow(r); err != nil {
+				t.Fatalf("%s: WriteRow: %v", test.desc, err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("%s: Flush: %v", test.desc, err)
+		}
+
+		r, err := newRowReader(test.format, &buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []dataRow
+		for {
+			dr, err := r.ReadRow()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: ReadRow: %v", test.desc, err)
+			}
+			got = append(got, dr)
+		}
+		if !reflect.DeepEqual(got, test.rows) {
+			t.Errorf("%s: round trip\ngot  %+v\nwant %+v", test.desc, got, test.rows)
+		}
+	}
+}
+
+func TestCSVHeader(t *testing.T) {
+	for _, in := range []string{
+		"r,fam:a,0,v\n",
+		"row,column,timestamp,value_hex\n",
+	} {
+		r, err := newRowReader("csv", strings.NewReader(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := r.ReadRow(); err == nil || err == io.EOF {
+			t.Errorf("ReadRow(%q): got %v, want a header error", in, err)
+		}
+	}
+	r, err := newRowReader("csv", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadRow(); err != io.EOF {
+		t.Errorf("ReadRow of empty input: got %v, want io.EOF", err)
+	}
+}
+
+func TestImportMutationErrors(t *testing.T) {
+	dr := dataRow{Key: "r", Cells: []dataCell{{Column: "nocolon", Value: []byte("v")}}}
+	if _, err := importMutation(dr, nil); err == nil {
+		t.Error("importMutation with a bad column did not fail")
+	}
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	for name, want := range map[string]string{
+		"rows.csv":   "csv",
+		"rows.jsonl": "jsonl",
+		"rows.json":  "jsonl",
+		"rows.txt":   "",
+		"-":          "",
+	} {
+		if got := formatFromFilename(name); got != want {
+			t.Errorf("formatFromFilename(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		out  []string
+		fail bool
+	}{
+		{in: "", out: nil},
+		{in: "  ls  ", out: []string{"ls"}},
+		{in: "read t prefix=a count=3", out: []string{"read", "t", "prefix=a", "count=3"}},
+		{in: `set t r fam:col="hello world"`, out: []string{"set", "t", "r", "fam:col=hello world"}},
+		{in: `set t r 'fam:col=say "hi"'`, out: []string{"set", "t", "r", `fam:col=say "hi"`}},
+		{in: `lookup t ""`, out: []string{"lookup", "t", ""}},
+		{in: `set t r fam:col="oops`, fail: true},
+	}
+	for _, tc := range tests {
+		got, err := splitArgs(tc.in)
+		if tc.fail {
+			if err == nil {
+				t.Errorf("splitArgs(%q) did not fail", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("splitArgs(%q) unexpectedly failed: %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.out) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tc.in, got, tc.out)
+		}
+	}
+}
+
+func TestMatchPrefix(t *testing.T) {
+	candidates := []string{"createtable", "count", "createfamily", "count", "fam:"}
+	tests := []struct {
+		prefix string
+		out    []string
+	}{
+		{"", []string{"count", "createfamily", "createtable", "fam:"}},
+		{"co", []string{"count"}},
+		{"cr", []string{"createfamily", "createtable"}},
+		{"createt", []string{"createtable"}},
+		{"x", nil},
+	}
+	for _, tc := range tests {
+		if got := matchPrefix(tc.prefix, candidates); !reflect.DeepEqual(got, tc.out) {
+			t.Errorf("matchPrefix(%q) = %q, want %q", tc.prefix, got, tc.out)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		in  string
+		out bigtable.Filter // nil if parsing should fail
+	}{
+		{in: "latest(1)", out: bigtable.LatestNFilter(1)},
+		{in: " family( cf1 ) ", out: bigtable.FamilyFilter("cf1")},
+		{in: `column("a.*")`, out: bigtable.ColumnFilter("a.*")},
+		{in: "value(`x, y`)", out: bigtable.ValueFilter("x, y")},
+		{in: "row(^r[0-9]+$)", out: bigtable.RowKeyFilter("^r[0-9]+$")},
+		{in: "strip()", out: bigtable.StripValueFilter()},
+		{
+			in: `chain(family(cf1), interleave(column(a), column("b\"c")), latest(2))`,
+			out: bigtable.ChainFilters(
+				bigtable.FamilyFilter("cf1"),
+				bigtable.InterleaveFilters(bigtable.ColumnFilter("a"), bigtable.ColumnFilter(`b"c`)),
+				bigtable.LatestNFilter(2),
+			),
+		},
+
+		{in: ""},
+		{in: "latest"},
+		{in: "latest(0)"},
+		{in: "latest(x)"},
+		{in: "family(cf1"},
+		{in: "family()"},
+		{in: `family("cf1)`},
+		{in: "chain()"},
+		{in: "nonesuch(x)"},
+		{in: "strip() strip()"},
+	}
+	for _, tc := range tests {
+		got, err := parseFilter(tc.in)
+		if tc.out == nil {
+			if err == nil {
+				t.Errorf("parseFilter(%q) did not fail", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parseFilter(%q) unexpectedly failed: %v", tc.in, err)
+			continue
+		}
+		if got.String() != tc.out.String() {
+			t.Errorf("parseFilter(%q) = %s, want %s", tc.in, got, tc.out)
+		}
+	}
+}
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		v      []byte
+		decode string
+		quote  bool
+		out    string
+	}{
+		{[]byte("hi"), "string", false, "hi"},
+		{[]byte("hi"), "string", true, `"hi"`},
+		{bigtable.EncodeInt64(-42), "int64", true, "-42"},
+		{[]byte("short"), "int64", true, `"short"`},
+		{[]byte{0xde, 0xad}, "hex", true, "dead"},
+	}
+	for _, tc := range tests {
+		if got := decodeValue(tc.v, tc.decode, tc.quote); got != tc.out {
+			t.Errorf("decodeValue(%q, %q, %t) = %q, want %q", tc.v, tc.decode, tc.quote, got, tc.out)
+		}
+	}
+}
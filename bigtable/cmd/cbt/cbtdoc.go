@@ -1,6 +1,6 @@
 // DO NOT EDIT. THIS IS AUTOMATICALLY GENERATED.
 // Run "go generate" to regenerate.
-//go:generate go run cbt.go -o cbtdoc.go doc
+//go:generate go run cbt.go dataio.go filterexpr.go rowfmt.go shell.go -o cbtdoc.go doc
 
 /*
 Cbt is a tool for doing basic interactions with Cloud Bigtable.
@@ -13,12 +13,17 @@ The commands are:
 
 	count                     Count rows in a table
 	createfamily              Create a column family
+	createinstance            Create an instance with an initial cluster
 	createtable               Create a table
 	deletefamily              Delete a column family
+	deleteinstance            Delete an instance
 	deleterow                 Delete a row
 	deletetable               Delete a table
 	doc                       Print godoc-suitable documentation for cbt
+	export                    Export rows to a file
 	help                      Print help text
+	import                    Import rows from a file
+	listclusters              List clusters in an instance
 	listinstances             List instances in a project
 	lookup                    Read from a single row
 	ls                        List tables and column families
@@ -26,6 +31,8 @@ The commands are:
 	read                      Read rows
 	set                       Set value of a cell
 	setgcpolicy               Set the GC policy for a column family
+	shell                     Run commands interactively
+	updatecluster             Update a cluster in the configured instance
 
 Use "cbt help <command>" for more information about a command.
 
@@ -37,6 +44,14 @@ The options are:
 		Cloud Bigtable instance
 	-creds string
 		if set, use application credentials in this file
+	-profile string
+		if set, use this named profile from the .cbtrc file (default from $CBT_PROFILE)
+	-emulator string
+		if set, connect to the Bigtable emulator at this host:port
+	-admin-endpoint string
+		if set, use this endpoint for admin operations
+	-data-endpoint string
+		if set, use this endpoint for data operations
 
 
 Count rows in a table
@@ -55,6 +70,21 @@ Usage:
 
 
 
+Create an instance with an initial cluster
+
+Usage:
+	cbt createinstance <instance-id> <display-name> <cluster-id> <zone> <num-nodes> <storage-type>
+	  instance-id		Permanent, unique id for the instance
+	  display-name		Description of the instance
+	  cluster-id		Permanent, unique id for the cluster in the instance
+	  zone			The zone in which to create the cluster
+	  num-nodes		The number of nodes to create
+	  storage-type		SSD or HDD
+
+
+
+
+
 Create a table
 
 Usage:
@@ -71,6 +101,14 @@ Usage:
 
 
 
+Delete an instance
+
+Usage:
+	cbt deleteinstance <instance>
+
+
+
+
 Delete a row
 
 Usage:
@@ -95,6 +133,26 @@ Usage:
 
 
 
+Export rows to a file
+
+Usage:
+	cbt export <table> [start=<row>] [end=<row>] [prefix=<prefix>] [format=<format>]
+		[values=<enc>] [file=<file>]
+	  start=<row>		Start exporting at this row
+	  end=<row>		Stop exporting before this row
+	  prefix=<prefix>	Export rows with this prefix
+	  format=<format>	Output format, csv or jsonl (default jsonl, or from the file extension)
+	  values=<enc>		Encoding of csv values, base64 (default) or text
+	  file=<file>		Write to this file instead of stdout
+
+	  The jsonl format writes one JSON object per row, with base64-encoded values.
+	  The csv format writes a header line, then one row,family:column,timestamp,value
+	  line per cell. values=text writes values unencoded, which suits only textual
+	  values: other bytes, and carriage returns, do not survive import.
+
+
+
+
 Print help text
 
 Usage:
@@ -103,6 +161,25 @@ Usage:
 
 
 
+Import rows from a file
+
+Usage:
+	cbt import <table> <file> [format=<format>] [map=<from>:<to> ...]
+	  <file>			File written by cbt export, or - for stdin
+	  format=<format>	Input format, csv or jsonl (default from the file extension)
+	  map=<from>:<to>	Write cells in family <from> to family <to>; may be repeated
+
+
+
+
+List clusters in an instance
+
+Usage:
+	cbt listclusters
+
+
+
+
 List instances in a project
 
 Usage:
@@ -114,7 +191,16 @@ Usage:
 Read from a single row
 
 Usage:
-	cbt lookup <table> <row>
+	cbt lookup <table> <row> [format=<format>] [decode=<type>] [filter=<expr>]
+	  format=<format>	Output format: table (the default), json, csv or hex
+	  decode=<type>		Show values as string (the default), int64 or hex;
+				int64 values are 8-byte big-endian, and values of
+				other lengths are shown as strings
+	  filter=<expr>		Filter cells with an expression, e.g.
+				  filter='chain(family(cf1), column("a.*"), latest(1))'
+				Functions: chain(f, ...), interleave(f, ...), row(re), family(re),
+				column(re), value(re), latest(n), strip()
+
 
 
 
@@ -140,10 +226,19 @@ Read rows
 
 Usage:
 	cbt read <table> [start=<row>] [end=<row>] [prefix=<prefix>] [count=<n>]
+		[format=<format>] [decode=<type>] [filter=<expr>]
 	  start=<row>		Start reading at this row
 	  end=<row>		Stop reading before this row
 	  prefix=<prefix>	Read rows with this prefix
 	  count=<n>		Read only this many rows
+	  format=<format>	Output format: table (the default), json, csv or hex
+	  decode=<type>		Show values as string (the default), int64 or hex;
+				int64 values are 8-byte big-endian, and values of
+				other lengths are shown as strings
+	  filter=<expr>		Filter cells with an expression, e.g.
+				  filter='chain(family(cf1), column("a.*"), latest(1))'
+				Functions: chain(f, ...), interleave(f, ...), row(re), family(re),
+				column(re), value(re), latest(n), strip()
 
 
 
@@ -173,5 +268,32 @@ Usage:
 
 
 
+Run commands interactively
+
+Usage:
+	cbt shell
+	  Runs cbt commands, without the leading "cbt", reusing one set of clients.
+	  End a line with a tab to list the completions of its last word, which may be
+	  a command, table, family or instance name.
+	  History is saved in ~/.cbt_history.
+
+	  Additional commands:
+	  exit			Leave the shell
+	  history		Print the command history
+	  use <instance>		Switch to another instance in the same project
+
+
+
+
+Update a cluster in the configured instance
+
+Usage:
+	cbt updatecluster <cluster-id> [num-nodes=num-nodes]
+	  cluster-id		Permanent, unique id for the cluster in the instance
+	  num-nodes		The number of nodes to update to
+
+
+
+
 */
 package main
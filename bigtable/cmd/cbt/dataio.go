@@ -0,0 +1,440 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file implements the export and import commands.
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/bigtable"
+	"golang.org/x/net/context"
+)
+
+// A dataRow is a row in an export file.
+// In the jsonl format, each line is the JSON encoding of a dataRow.
+// In the csv format, a header line is followed by one line per cell, as
+//
+//	row,family:column,timestamp,value
+//
+// and the cells of a row are on consecutive lines. The last field of the
+// header is csvTextValue or csvBase64Value, giving the encoding of the values.
+type dataRow struct {
+	Key   string     `json:"key"`
+	Cells []dataCell `json:"cells"`
+}
+
+type dataCell struct {
+	Column    string `json:"column"` // family:column
+	Timestamp int64  `json:"timestamp"`
+	Value     []byte `json:"value"`
+}
+
+func toDataRow(r bigtable.Row) dataRow {
+	dr := dataRow{Key: r.Key()}
+	for _, ri := range sortedCells(r) {
+		dr.Cells = append(dr.Cells, dataCell{
+			Column:    ri.Column,
+			Timestamp: int64(ri.Timestamp),
+			Value:     ri.Value,
+		})
+	}
+	return dr
+}
+
+// A rowWriter writes rows in an export format.
+type rowWriter interface {
+	WriteRow(dataRow) error
+	Flush() error
+}
+
+// A rowReader reads rows in an export format.
+// ReadRow returns io.EOF when there are no more rows.
+type rowReader interface {
+	ReadRow() (dataRow, error)
+}
+
+// The names of the value field in the header of a csv file.
+// Text values are written as they are, which only round-trips valid UTF-8
+// without carriage returns; base64 values round-trip any bytes.
+const (
+	csvTextValue   = "value"
+	csvBase64Value = "value_base64"
+)
+
+// newRowWriter returns a rowWriter for format. If textValues is true,
+// the csv format writes values as text rather than base64.
+func newRowWriter(format string, w io.Writer, textValues bool) (rowWriter, error) {
+	switch format {
+	case "csv":
+		cw := &csvRowWriter{w: csv.NewWriter(w), base64: !textValues}
+		valueField := csvBase64Value
+		if textValues {
+			valueField = csvTextValue
+		}
+		if err := cw.w.Write([]string{"row", "column", "timestamp", valueField}); err != nil {
+			return nil, err
+		}
+		return cw, nil
+	case "jsonl":
+		bw := bufio.NewWriter(w)
+		return jsonRowWriter{bw, json.NewEncoder(bw)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+func newRowReader(format string, r io.Reader) (rowReader, error) {
+	switch format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = 4
+		return &csvRowReader{r: cr}, nil
+	case "jsonl":
+		return jsonRowReader{json.NewDecoder(r)}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+type csvRowWriter struct {
+	w      *csv.Writer
+	base64 bool // encode values in base64
+}
+
+func (w *csvRowWriter) WriteRow(r dataRow) error {
+	for _, c := range r.Cells {
+		v := string(c.Value)
+		if w.base64 {
+			v = base64.StdEncoding.EncodeToString(c.Value)
+		}
+		err := w.w.Write([]string{r.Key, c.Column, strconv.FormatInt(c.Timestamp, 10), v})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *csvRowWriter) Flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+type csvRowReader struct {
+	r          *csv.Reader
+	readHeader bool
+	base64     bool     // values are encoded in base64
+	next       []string // the next record, if already read
+}
+
+func (r *csvRowReader) ReadRow() (dataRow, error) {
+	if !r.readHeader {
+		rec, err := r.r.Read()
+		if err != nil {
+			return dataRow{}, err
+		}
+		if rec[0] != "row" || rec[1] != "column" || rec[2] != "timestamp" ||
+			(rec[3] != csvTextValue && rec[3] != csvBase64Value) {
+			return dataRow{}, fmt.Errorf("bad csv header %q; want row,column,timestamp,%s or %s", rec, csvTextValue, csvBase64Value)
+		}
+		r.readHeader = true
+		r.base64 = rec[3] == csvBase64Value
+	}
+	var dr dataRow
+	for {
+		rec := r.next
+		r.next = nil
+		if rec == nil {
+			var err error
+			rec, err = r.r.Read()
+			if err == io.EOF && dr.Key != "" {
+				return dr, nil
+			}
+			if err != nil {
+				return dataRow{}, err
+			}
+		}
+		if dr.Key != "" && rec[0] != dr.Key {
+			// This record starts the next row.
+			r.next = rec
+			return dr, nil
+		}
+		ts, err := strconv.ParseInt(rec[2], 10, 64)
+		if err != nil {
+			return dataRow{}, fmt.Errorf("bad timestamp %q for row %q", rec[2], rec[0])
+		}
+		v := []byte(rec[3])
+		if r.base64 {
+			if v, err = base64.StdEncoding.DecodeString(rec[3]); err != nil {
+				return dataRow{}, fmt.Errorf("bad value for row %q: %v", rec[0], err)
+			}
+		}
+		dr.Key = rec[0]
+		dr.Cells = append(dr.Cells, dataCell{Column: rec[1], Timestamp: ts, Value: v})
+	}
+}
+
+type jsonRowWriter struct {
+	bw  *bufio.Writer
+	enc *json.Encoder
+}
+
+func (w jsonRowWriter) WriteRow(r dataRow) error { return w.enc.Encode(r) } // Encode adds a newline
+func (w jsonRowWriter) Flush() error             { return w.bw.Flush() }
+
+type jsonRowReader struct {
+	dec *json.Decoder
+}
+
+func (r jsonRowReader) ReadRow() (dataRow, error) {
+	var dr dataRow
+	err := r.dec.Decode(&dr)
+	return dr, err
+}
+
+// formatFromFilename guesses the export format from a filename.
+func formatFromFilename(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".csv"):
+		return "csv"
+	case strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".json"):
+		return "jsonl"
+	}
+	return ""
+}
+
+// parseArgs parses key=value arguments, allowing only the given keys.
+// Keys in multi may be repeated; the values of other keys are returned in single.
+func parseArgs(args []string, keys []string, multi map[string]bool) (single map[string]string, multiple map[string][]string) {
+	single = make(map[string]string)
+	multiple = make(map[string][]string)
+	allowed := make(map[string]bool)
+	for _, k := range keys {
+		allowed[k] = true
+	}
+	for _, arg := range args {
+		i := strings.Index(arg, "=")
+		if i < 0 {
+			fatalf("Bad arg %q", arg)
+		}
+		key, val := arg[:i], arg[i+1:]
+		switch {
+		case multi[key]:
+			multiple[key] = append(multiple[key], val)
+		case allowed[key]:
+			single[key] = val
+		default:
+			fatalf("Unknown arg key %q", key)
+		}
+	}
+	return single, multiple
+}
+
+func doExport(ctx context.Context, args ...string) {
+	if len(args) < 1 {
+		fatal("usage: cbt export <table> [args ...]")
+	}
+	tbl := getClient().Open(args[0])
+	parsed, _ := parseArgs(args[1:], []string{"start", "end", "prefix", "format", "values", "file"}, nil)
+	if (parsed["start"] != "" || parsed["end"] != "") && parsed["prefix"] != "" {
+		fatal(`"start"/"end" may not be mixed with "prefix"`)
+	}
+
+	var rr bigtable.RowRange
+	if start, end := parsed["start"], parsed["end"]; end != "" {
+		rr = bigtable.NewRange(start, end)
+	} else if start != "" {
+		rr = bigtable.InfiniteRange(start)
+	}
+	if prefix := parsed["prefix"]; prefix != "" {
+		rr = bigtable.PrefixRange(prefix)
+	}
+
+	out := os.Stdout
+	format := parsed["format"]
+	if file := parsed["file"]; file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			fatal(err)
+		}
+		defer func() {
+			if err := f.Close(); err != nil {
+				fatal(err)
+			}
+		}()
+		out = f
+		if format == "" {
+			format = formatFromFilename(file)
+		}
+	}
+	if format == "" {
+		format = "jsonl"
+	}
+	var textValues bool
+	switch values := parsed["values"]; {
+	case values == "text" && format == "csv":
+		textValues = true
+	case values == "base64" || values == "":
+	default:
+		fatalf(`Bad values=%s; want values=base64, or values=text with format=csv`, values)
+	}
+	w, err := newRowWriter(format, out, textValues)
+	if err != nil {
+		fatal(err)
+	}
+
+	var (
+		n        int
+		writeErr error
+	)
+	err = tbl.ReadRows(ctx, rr, func(r bigtable.Row) bool {
+		if writeErr = w.WriteRow(toDataRow(r)); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		fatalf("Exporting rows: %v", err)
+	}
+	if writeErr != nil {
+		fatalf("Writing rows: %v", writeErr)
+	}
+	if err := w.Flush(); err != nil {
+		fatalf("Writing rows: %v", err)
+	}
+	log.Printf("Exported %d rows", n)
+}
+
+func doImport(ctx context.Context, args ...string) {
+	if len(args) < 2 {
+		fatal("usage: cbt import <table> <file> [args ...]")
+	}
+	tbl := getClient().Open(args[0])
+	file := args[1]
+	parsed, multi := parseArgs(args[2:], []string{"format"}, map[string]bool{"map": true})
+
+	famMap := make(map[string]string)
+	for _, m := range multi["map"] {
+		i := strings.Index(m, ":")
+		if i <= 0 || i == len(m)-1 {
+			fatalf("Bad family mapping %q; want map=<from>:<to>", m)
+		}
+		famMap[m[:i]] = m[i+1:]
+	}
+
+	in := os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		in = f
+	}
+	format := parsed["format"]
+	if format == "" {
+		format = formatFromFilename(file)
+	}
+	if format == "" {
+		fatalf("Can't tell the format of %q; use format=csv or format=jsonl", file)
+	}
+	r, err := newRowReader(format, in)
+	if err != nil {
+		fatal(err)
+	}
+
+	var (
+		mu     sync.Mutex
+		failed int
+	)
+	w := tbl.NewBatchWriter(ctx, &bigtable.BatchWriterSettings{
+		// OnError runs on the BatchWriter's goroutines, so it counts
+		// failures for doImport to report rather than calling fatalf.
+		OnError: func(rowKey string, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			failed++
+			log.Printf("Importing row %q: %v", rowKey, err)
+		},
+	})
+	n, err := addRows(ctx, w, r, file, famMap)
+	// Close applies the rows added so far. fatal exits without running
+	// deferred calls outside the shell, so close w before checking err.
+	w.Close()
+	if err != nil {
+		fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failed > 0 {
+		fatalf("Failed to import %d of %d rows", failed, n)
+	}
+	log.Printf("Imported %d rows", n)
+}
+
+// addRows adds the rows read from r, which was opened from file, to w,
+// renaming families according to famMap. It returns the number of rows
+// added, and the error that stopped it, if any.
+func addRows(ctx context.Context, w *bigtable.BatchWriter, r rowReader, file string, famMap map[string]string) (int, error) {
+	n := 0
+	for {
+		dr, err := r.ReadRow()
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, fmt.Errorf("Reading %s: %v", file, err)
+		}
+		mut, err := importMutation(dr, famMap)
+		if err != nil {
+			return n, err
+		}
+		if err := w.Add(ctx, dr.Key, mut); err != nil {
+			return n, fmt.Errorf("Importing row %q: %v", dr.Key, err)
+		}
+		n++
+	}
+}
+
+// importMutation returns a mutation that sets the cells of the row,
+// renaming families according to famMap.
+func importMutation(dr dataRow, famMap map[string]string) (*bigtable.Mutation, error) {
+	mut := bigtable.NewMutation()
+	for _, c := range dr.Cells {
+		i := strings.Index(c.Column, ":")
+		if i < 0 {
+			return nil, fmt.Errorf("bad column %q in row %q; want family:column", c.Column, dr.Key)
+		}
+		fam, col := c.Column[:i], c.Column[i+1:]
+		if to, ok := famMap[fam]; ok {
+			fam = to
+		}
+		mut.Set(fam, col, bigtable.Timestamp(c.Timestamp), c.Value)
+	}
+	return mut, nil
+}
@@ -0,0 +1,210 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file implements the filter expressions accepted by read and lookup.
+//
+// A filter expression is a call of one of the functions below,
+// each of which corresponds to a bigtable.Filter constructor:
+//
+//	chain(f, ...)       ChainFilters
+//	interleave(f, ...)  InterleaveFilters
+//	row(re)             RowKeyFilter
+//	family(re)          FamilyFilter
+//	column(re)          ColumnFilter
+//	value(re)           ValueFilter
+//	latest(n)           LatestNFilter
+//	strip()             StripValueFilter
+//
+// Patterns may be bare words or quoted strings, in Go syntax;
+// a pattern containing spaces, commas, parentheses or quotes must be quoted.
+// For example:
+//
+//	chain(family(cf1), column("a.*"), latest(1))
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"cloud.google.com/go/bigtable"
+)
+
+const filterHelp = "  filter=<expr>		Filter cells with an expression, e.g.\n" +
+	`			  filter='chain(family(cf1), column("a.*"), latest(1))'` + "\n" +
+	"			Functions: chain(f, ...), interleave(f, ...), row(re), family(re),\n" +
+	"			column(re), value(re), latest(n), strip()\n"
+
+// parseFilter parses a filter expression.
+func parseFilter(s string) (bigtable.Filter, error) {
+	p := &filterParser{s: s}
+	f, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.next(); tok != "" {
+		return nil, p.errorf("unexpected %q after filter", tok)
+	}
+	return f, nil
+}
+
+type filterParser struct {
+	s   string
+	pos int // offset of the next token in s
+}
+
+func (p *filterParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("bad filter %q at offset %d: %s", p.s, p.pos, fmt.Sprintf(format, args...))
+}
+
+// peek returns the next token without consuming it.
+// A token is one of "(", ")" and ",", a quoted string, or a bare word.
+// At the end of the input, peek returns "".
+func (p *filterParser) peek() string {
+	i := p.pos
+	for i < len(p.s) && unicode.IsSpace(rune(p.s[i])) {
+		i++
+	}
+	p.pos = i
+	if i == len(p.s) {
+		return ""
+	}
+	switch c := p.s[i]; c {
+	case '(', ')', ',':
+		return p.s[i : i+1]
+	case '"', '`':
+		// Find the closing quote, skipping escaped characters in "" strings.
+		for j := i + 1; j < len(p.s); j++ {
+			if c == '"' && p.s[j] == '\\' {
+				j++
+				continue
+			}
+			if p.s[j] == c {
+				return p.s[i : j+1]
+			}
+		}
+		return p.s[i:] // unterminated; reported by the caller
+	}
+	j := i
+	for j < len(p.s) && !unicode.IsSpace(rune(p.s[j])) && !strings.ContainsRune(`(),"`+"`", rune(p.s[j])) {
+		j++
+	}
+	return p.s[i:j]
+}
+
+func (p *filterParser) next() string {
+	tok := p.peek()
+	p.pos += len(tok)
+	return tok
+}
+
+func (p *filterParser) expect(want string) error {
+	if tok := p.peek(); tok != want {
+		if tok == "" {
+			return p.errorf("want %q, got end of filter", want)
+		}
+		return p.errorf("want %q, got %q", want, tok)
+	}
+	p.next()
+	return nil
+}
+
+// word parses a bare word or quoted string.
+func (p *filterParser) word() (string, error) {
+	tok := p.peek()
+	switch {
+	case tok == "", tok == "(", tok == ")", tok == ",":
+		return "", p.errorf("want a pattern or number, got %q", tok)
+	case tok[0] == '"' || tok[0] == '`':
+		s, err := strconv.Unquote(tok)
+		if err != nil {
+			return "", p.errorf("bad string %s", tok)
+		}
+		p.next()
+		return s, nil
+	}
+	return p.next(), nil
+}
+
+// filter parses a function call.
+func (p *filterParser) filter() (bigtable.Filter, error) {
+	name := p.peek()
+	if name == "" || strings.ContainsAny(name[:1], "(),\"`") {
+		return nil, p.errorf("want a filter function, got %q", name)
+	}
+	p.next()
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var f bigtable.Filter
+	switch name {
+	case "chain", "interleave":
+		var sub []bigtable.Filter
+		for {
+			sf, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			sub = append(sub, sf)
+			if p.peek() != "," {
+				break
+			}
+			p.next()
+		}
+		if name == "chain" {
+			f = bigtable.ChainFilters(sub...)
+		} else {
+			f = bigtable.InterleaveFilters(sub...)
+		}
+	case "row", "family", "column", "value":
+		pattern, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		switch name {
+		case "row":
+			f = bigtable.RowKeyFilter(pattern)
+		case "family":
+			f = bigtable.FamilyFilter(pattern)
+		case "column":
+			f = bigtable.ColumnFilter(pattern)
+		case "value":
+			f = bigtable.ValueFilter(pattern)
+		}
+	case "latest":
+		w, err := p.word()
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(w)
+		if err != nil || n < 1 {
+			return nil, p.errorf("bad count %q for latest", w)
+		}
+		f = bigtable.LatestNFilter(n)
+	case "strip":
+		f = bigtable.StripValueFilter()
+	default:
+		return nil, p.errorf("unknown filter function %q", name)
+	}
+
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
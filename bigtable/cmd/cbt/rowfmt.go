@@ -0,0 +1,180 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file implements the output formats of read and lookup.
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigtable"
+)
+
+const formatHelp = "  format=<format>	Output format: table (the default), json, csv or hex\n" +
+	"  decode=<type>		Show values as string (the default), int64 or hex;\n" +
+	"			int64 values are 8-byte big-endian, and values of\n" +
+	"			other lengths are shown as strings\n"
+
+// decodeValue formats a cell value according to decode, which must be
+// "string", "int64" or "hex". If quote is true, strings are quoted.
+func decodeValue(v []byte, decode string, quote bool) string {
+	switch decode {
+	case "int64":
+		if n, err := bigtable.DecodeInt64(v); err == nil {
+			return strconv.FormatInt(n, 10)
+		}
+	case "hex":
+		return hex.EncodeToString(v)
+	}
+	if quote {
+		return strconv.Quote(string(v))
+	}
+	return string(v)
+}
+
+// A rowPrinter prints rows in some format.
+type rowPrinter interface {
+	printRow(r bigtable.Row) error
+	flush() error
+}
+
+// newRowPrinter returns a printer for the named format and value decoding.
+func newRowPrinter(w io.Writer, format, decode string) (rowPrinter, error) {
+	switch decode {
+	case "":
+		decode = "string"
+	case "string", "int64", "hex":
+	default:
+		return nil, fmt.Errorf("unknown decode %q; want string, int64 or hex", decode)
+	}
+	switch format {
+	case "", "table":
+		return &tablePrinter{w: w, decode: decode}, nil
+	case "hex":
+		return &tablePrinter{w: w, hexDump: true}, nil
+	case "json":
+		return &jsonPrinter{enc: json.NewEncoder(w), decode: decode}, nil
+	case "csv":
+		return &csvPrinter{w: csv.NewWriter(w), decode: decode}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q; want table, json, csv or hex", format)
+}
+
+// sortedCells returns the cells of r ordered by column, then by descending timestamp.
+func sortedCells(r bigtable.Row) []bigtable.ReadItem {
+	var fams []string
+	for fam := range r {
+		fams = append(fams, fam)
+	}
+	sort.Strings(fams)
+	var cells []bigtable.ReadItem
+	for _, fam := range fams {
+		ris := r[fam]
+		sort.Stable(byColumn(ris))
+		cells = append(cells, ris...)
+	}
+	return cells
+}
+
+// tablePrinter prints rows in a human-readable format.
+type tablePrinter struct {
+	w       io.Writer
+	decode  string
+	hexDump bool // print values as hex dumps, ignoring decode
+}
+
+func (p *tablePrinter) printRow(r bigtable.Row) error {
+	fmt.Fprintln(p.w, strings.Repeat("-", 40))
+	fmt.Fprintln(p.w, r.Key())
+	for _, ri := range sortedCells(r) {
+		ts := time.Unix(0, int64(ri.Timestamp)*1e3)
+		fmt.Fprintf(p.w, "  %-40s @ %s\n", ri.Column, ts.Format("2006/01/02-15:04:05.000000"))
+		if p.hexDump {
+			fmt.Fprint(p.w, indentLines(strings.TrimSuffix(hex.Dump(ri.Value), "\n"), "    ")+"\n")
+			continue
+		}
+		_, err := fmt.Fprintf(p.w, "    %s\n", decodeValue(ri.Value, p.decode, true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *tablePrinter) flush() error { return nil }
+
+// jsonPrinter prints one JSON object per row.
+type jsonPrinter struct {
+	enc    *json.Encoder
+	decode string
+}
+
+type jsonPrintCell struct {
+	Column    string      `json:"column"`
+	Timestamp int64       `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
+
+func (p *jsonPrinter) printRow(r bigtable.Row) error {
+	row := struct {
+		Key   string          `json:"key"`
+		Cells []jsonPrintCell `json:"cells"`
+	}{Key: r.Key()}
+	for _, ri := range sortedCells(r) {
+		var v interface{} = decodeValue(ri.Value, p.decode, false)
+		if p.decode == "int64" {
+			if n, err := bigtable.DecodeInt64(ri.Value); err == nil {
+				v = n
+			}
+		}
+		row.Cells = append(row.Cells, jsonPrintCell{Column: ri.Column, Timestamp: int64(ri.Timestamp), Value: v})
+	}
+	return p.enc.Encode(row)
+}
+
+func (p *jsonPrinter) flush() error { return nil }
+
+// csvPrinter prints one row,family:column,timestamp,value line per cell,
+// like the csv format of export.
+type csvPrinter struct {
+	w      *csv.Writer
+	decode string
+}
+
+func (p *csvPrinter) printRow(r bigtable.Row) error {
+	for _, ri := range sortedCells(r) {
+		err := p.w.Write([]string{r.Key(), ri.Column, strconv.FormatInt(int64(ri.Timestamp), 10),
+			decodeValue(ri.Value, p.decode, false)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *csvPrinter) flush() error {
+	p.w.Flush()
+	return p.w.Error()
+}
@@ -0,0 +1,366 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file implements the shell command.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/context"
+)
+
+var (
+	// inShell reports whether commands are being run by cbt shell.
+	inShell bool
+
+	errCommandFailed = errors.New("command failed")
+)
+
+// maxHistory is the number of lines of history kept in the history file.
+const maxHistory = 1000
+
+func historyFilename() string {
+	return filepath.Join(os.Getenv("HOME"), ".cbt_history")
+}
+
+// shellBuiltins are the commands that are only available in cbt shell.
+var shellBuiltins = []struct{ Name, Usage string }{
+	{"exit", "exit			Leave the shell"},
+	{"history", "history			Print the command history"},
+	{"use", "use <instance>		Switch to another instance in the same project"},
+}
+
+func doShellReal(ctx context.Context, args ...string) {
+	if len(args) != 0 {
+		fatal("usage: cbt shell")
+	}
+	if inShell {
+		fatal("Already in cbt shell")
+	}
+	inShell = true
+	defer func() { inShell = false }()
+
+	history, err := loadHistory(historyFilename())
+	if err != nil {
+		log.Printf("Reading history: %v", err)
+	}
+
+	sh := &shell{ctx: ctx, history: history}
+	s := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print(sh.prompt())
+		if !s.Scan() {
+			if err := s.Err(); err != nil {
+				fatalf("Reading command: %v", err)
+			}
+			fmt.Println()
+			break
+		}
+		line := s.Text()
+		if strings.HasSuffix(line, "\t") {
+			sh.complete(strings.TrimSuffix(line, "\t"))
+			continue
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		sh.history = append(sh.history, line)
+		if !sh.run(line) {
+			break
+		}
+	}
+
+	if err := saveHistory(historyFilename(), sh.history); err != nil {
+		log.Printf("Saving history: %v", err)
+	}
+}
+
+type shell struct {
+	ctx     context.Context
+	history []string
+
+	tables []string // cached table names for completion; nil if not yet fetched
+}
+
+func (sh *shell) prompt() string {
+	return fmt.Sprintf("cbt:%s/%s> ", config.Project, config.Instance)
+}
+
+// run runs a line of input, and reports whether the shell should continue.
+func (sh *shell) run(line string) (cont bool) {
+	args, err := splitArgs(line)
+	if err != nil {
+		log.Print(err)
+		return true
+	}
+	if len(args) == 0 {
+		return true
+	}
+	// A failed command aborts with errCommandFailed; report it and carry on.
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errCommandFailed {
+				panic(r)
+			}
+			cont = true
+		}
+	}()
+	// Any command may change the set of tables.
+	sh.tables = nil
+
+	switch args[0] {
+	case "exit", "quit":
+		return false
+	case "history":
+		for i, h := range sh.history {
+			fmt.Printf("%5d  %s\n", i+1, h)
+		}
+		return true
+	case "use":
+		if len(args) != 2 {
+			fatal("usage: use <instance>")
+		}
+		switchInstance(args[1])
+		return true
+	case "help":
+		if len(args) == 1 {
+			fmt.Println("Commands are those of cbt, without the leading \"cbt\", and these:")
+			for _, b := range shellBuiltins {
+				fmt.Printf("  %s\n", b.Usage)
+			}
+			fmt.Println()
+		}
+	}
+	for _, cmd := range commands {
+		if cmd.Name == args[0] {
+			cmd.do(sh.ctx, args[1:]...)
+			return true
+		}
+	}
+	log.Printf("Unknown command %q", args[0])
+	return true
+}
+
+// switchInstance closes the open clients and makes later commands use the named instance.
+func switchInstance(instance string) {
+	if client != nil {
+		client.Close()
+		client = nil
+	}
+	if adminClient != nil {
+		adminClient.Close()
+		adminClient = nil
+	}
+	config.Instance = instance
+}
+
+// splitArgs splits a line into words separated by spaces.
+// Single or double quotes may be used to include spaces in a word.
+func splitArgs(line string) ([]string, error) {
+	var (
+		args  []string
+		cur   []rune
+		quote rune // the open quote character, or 0
+		inArg bool
+	)
+	for _, r := range line {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			cur = append(cur, r)
+		case r == '"' || r == '\'':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, string(cur))
+				cur, inArg = cur[:0], false
+			}
+		default:
+			cur, inArg = append(cur, r), true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, string(cur))
+	}
+	return args, nil
+}
+
+// complete prints the lines that complete the last word of line, which
+// the user ended with a tab. Input is read a line at a time, so the tab
+// only takes effect when the line is entered.
+func (sh *shell) complete(line string) {
+	start := strings.LastIndexAny(line, " \t") + 1
+	words, prefix := strings.Fields(line[:start]), line[start:]
+	matches := matchPrefix(prefix, sh.candidates(words, prefix))
+	if len(matches) == 0 {
+		log.Printf("No completions for %q", prefix)
+		return
+	}
+	for _, m := range matches {
+		fmt.Println(line[:start] + m)
+	}
+}
+
+// candidates returns the possible completions of a word that follows words.
+func (sh *shell) candidates(words []string, prefix string) []string {
+	if len(words) == 0 {
+		var names []string
+		for _, cmd := range commands {
+			names = append(names, cmd.Name)
+		}
+		for _, b := range shellBuiltins {
+			names = append(names, b.Name)
+		}
+		return names
+	}
+	cmd, n := words[0], len(words)
+	switch {
+	case cmd == "help" && n == 1:
+		return sh.candidates(nil, prefix)
+	case cmd == "use" && n == 1:
+		return instanceNames(sh.ctx)
+	case n == 1 && takesTable(cmd):
+		return sh.tableNames()
+	case n == 2 && (cmd == "deletefamily" || cmd == "setgcpolicy"):
+		return familyNames(sh.ctx, words[1], "")
+	case n >= 3 && cmd == "set" && !strings.Contains(prefix, ":"):
+		return familyNames(sh.ctx, words[1], ":")
+	}
+	return nil
+}
+
+// takesTable reports whether the first argument of the named command is a table.
+func takesTable(cmd string) bool {
+	for _, c := range commands {
+		if c.Name == cmd {
+			return strings.HasPrefix(c.Usage, "cbt "+cmd+" <table>")
+		}
+	}
+	return false
+}
+
+// The completion helpers below swallow errors, which would otherwise
+// abort the shell while the user is typing.
+
+func (sh *shell) tableNames() (names []string) {
+	if sh.tables != nil {
+		return sh.tables
+	}
+	defer func() {
+		if r := recover(); r != nil && r != errCommandFailed {
+			panic(r)
+		}
+	}()
+	tables, err := getAdminClient().Tables(sh.ctx)
+	if err != nil {
+		return nil
+	}
+	sh.tables = tables
+	return tables
+}
+
+func familyNames(ctx context.Context, table, suffix string) (names []string) {
+	defer func() {
+		if r := recover(); r != nil && r != errCommandFailed {
+			panic(r)
+		}
+	}()
+	ti, err := getAdminClient().TableInfo(ctx, table)
+	if err != nil {
+		return nil
+	}
+	for _, fam := range ti.Families {
+		names = append(names, fam+suffix)
+	}
+	return names
+}
+
+func instanceNames(ctx context.Context) (names []string) {
+	defer func() {
+		if r := recover(); r != nil && r != errCommandFailed {
+			panic(r)
+		}
+	}()
+	is, err := getInstanceAdminClient().Instances(ctx)
+	if err != nil {
+		return nil
+	}
+	for _, i := range is {
+		names = append(names, i.Name)
+	}
+	return names
+}
+
+// matchPrefix returns the sorted, distinct candidates that start with prefix.
+func matchPrefix(prefix string, candidates []string) []string {
+	var matches []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	n := 0
+	for i, m := range matches {
+		if i == 0 || m != matches[n-1] {
+			matches[n] = m
+			n++
+		}
+	}
+	return matches[:n]
+}
+
+func loadHistory(filename string) ([]string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func saveHistory(filename string, lines []string) error {
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return ioutil.WriteFile(filename, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+}
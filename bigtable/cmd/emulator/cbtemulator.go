@@ -14,20 +14,31 @@
 
 /*
 cbtemulator launches the in-memory Cloud Bigtable server on the given address.
+
+With -restore, the server starts with the tables held in a snapshot file.
+With -snapshot, the server writes its tables to a snapshot file when it is
+interrupted or terminated.
 */
 package main
 
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"cloud.google.com/go/bigtable/bttest"
 )
 
 var (
-	host = flag.String("host", "localhost", "the address to bind to on the local machine")
-	port = flag.Int("port", 9000, "the port number to bind to on the local machine")
+	host     = flag.String("host", "localhost", "the address to bind to on the local machine")
+	port     = flag.Int("port", 9000, "the port number to bind to on the local machine")
+	snapshot = flag.String("snapshot", "", "if set, the file to write the server's tables to on exit")
+	restore  = flag.String("restore", "", "if set, a snapshot file to load tables from on startup")
 )
 
 func main() {
@@ -37,6 +48,49 @@ func main() {
 		log.Fatalf("failed to start emulator: %v", err)
 	}
 
+	if *restore != "" {
+		f, err := os.Open(*restore)
+		if err != nil {
+			log.Fatalf("failed to open snapshot: %v", err)
+		}
+		err = srv.Restore(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("failed to restore snapshot %s: %v", *restore, err)
+		}
+	}
+
 	fmt.Printf("Cloud Bigtable emulator running on %s\n", srv.Addr)
-	select {}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+
+	if *snapshot != "" {
+		if err := writeSnapshot(srv, *snapshot); err != nil {
+			log.Fatalf("failed to write snapshot: %v", err)
+		}
+		fmt.Printf("Wrote snapshot to %s\n", *snapshot)
+	}
+	srv.Close()
+}
+
+// writeSnapshot writes a snapshot of srv to the named file.
+// It writes to a temporary file first, so an existing snapshot
+// is only replaced by a complete one.
+func writeSnapshot(srv *bttest.Server, name string) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	if err := srv.Snapshot(f); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), name)
 }
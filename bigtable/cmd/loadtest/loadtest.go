@@ -16,6 +16,10 @@ limitations under the License.
 
 /*
 Loadtest does some load testing through the Go client library for Cloud Bigtable.
+
+The mix of reads, writes and scans, the distribution of row keys and value
+sizes, and the target rate of operations are set by flags. Latencies for each
+kind of operation are recorded in histograms that may be written out as CSV or JSON.
 */
 package main
 
@@ -24,8 +28,8 @@ import (
 	"flag"
 	"fmt"
 	"log"
-	"math/rand"
 	"os"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -45,6 +49,20 @@ var (
 	poolSize = flag.Int("pool_size", 1, "size of the gRPC connection pool to use for the data client")
 	reqCount = flag.Int("req_count", 100, "number of concurrent requests")
 
+	readRatio     = flag.Float64("read_ratio", 0.5, "relative frequency of single-row reads")
+	writeRatio    = flag.Float64("write_ratio", 0.5, "relative frequency of single-row writes")
+	scanRatio     = flag.Float64("scan_ratio", 0, "relative frequency of scans")
+	scanRows      = flag.Int("scan_rows", 100, "number of rows to read in each scan")
+	keyDist       = flag.String("key_dist", "uniform", "distribution of row keys: uniform, zipfian or sequential")
+	numKeys       = flag.Int64("num_keys", 100, "number of distinct row keys")
+	zipfS         = flag.Float64("zipf_s", 1.1, "exponent of the zipfian key distribution; must be > 1")
+	valueSize     = flag.Int("value_size", 1<<10, "mean size in bytes of written values")
+	valueSizeDist = flag.String("value_size_dist", "constant", "distribution of value sizes: constant, uniform or exponential")
+	qps           = flag.Float64("qps", 0,
+		"target operations per second; if zero, run closed-loop with req_count concurrent requests")
+	histOutput = flag.String("hist_output", "",
+		"output path for latency histograms, in JSON if the path ends in .json and in .csv format otherwise")
+
 	config      *cbtrc.Config
 	client      *bigtable.Client
 	adminClient *bigtable.AdminClient
@@ -65,12 +83,21 @@ func main() {
 	if config.Creds != "" {
 		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", config.Creds)
 	}
+	if config.Emulator != "" {
+		os.Setenv("BIGTABLE_EMULATOR_HOST", config.Emulator)
+	}
 	if flag.NArg() != 0 {
 		flag.Usage()
 		os.Exit(1)
 	}
 
-	var options []option.ClientOption
+	wl, err := newWorkload([numOpKinds]float64{*readRatio, *writeRatio, *scanRatio},
+		*keyDist, *numKeys, *zipfS, *valueSizeDist, *valueSize)
+	if err != nil {
+		log.Fatalf("Bad workload: %v", err)
+	}
+
+	options := config.DataOptions()
 	if *poolSize > 1 {
 		options = append(options, option.WithGRPCConnectionPool(*poolSize))
 	}
@@ -91,7 +118,7 @@ func main() {
 		log.Fatalf("Making bigtable.Client: %v", err)
 	}
 	defer client.Close()
-	adminClient, err = bigtable.NewAdminClient(context.Background(), config.Project, config.Instance)
+	adminClient, err = bigtable.NewAdminClient(context.Background(), config.Project, config.Instance, config.AdminOptions()...)
 	if err != nil {
 		log.Fatalf("Making bigtable.AdminClient: %v", err)
 	}
@@ -111,64 +138,112 @@ func main() {
 	log.Printf("Starting load test... (run for %v)", *runFor)
 	tbl := client.Open(*scratchTable)
 	sem := make(chan int, *reqCount) // limit the number of requests happening at once
-	var reads, writes stats
+	var allStats [numOpKinds]stats
+	for i := range allStats {
+		allStats[i].hist = stat.NewHistogram(opNames[i])
+	}
 	stopTime := time.Now().Add(*runFor)
 	var wg sync.WaitGroup
-	for time.Now().Before(stopTime) {
+
+	// issue starts an operation that was scheduled to start at the given time.
+	// Latency is measured from the scheduled time, so that when running at
+	// a target QPS, time spent waiting for a free request slot is included.
+	issue := func(scheduled time.Time) {
 		sem <- 1
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer func() { <-sem }()
 
-			ok := true
-			opStart := time.Now()
-			var stats *stats
-			defer func() {
-				stats.Record(ok, time.Since(opStart))
-			}()
-
-			row := fmt.Sprintf("row%d", rand.Intn(100)) // operate on 1 of 100 rows
-
-			switch rand.Intn(10) {
-			default:
-				// read
-				stats = &reads
-				_, err := tbl.ReadRow(context.Background(), row, bigtable.RowFilter(bigtable.LatestNFilter(1)))
-				if err != nil {
-					log.Printf("Error doing read: %v", err)
-					ok = false
-				}
-			case 0, 1, 2, 3, 4:
-				// write
-				stats = &writes
-				mut := bigtable.NewMutation()
-				mut.Set("f", "col", bigtable.Now(), bytes.Repeat([]byte("0"), 1<<10)) // 1 KB write
-				if err := tbl.Apply(context.Background(), row, mut); err != nil {
-					log.Printf("Error doing mutation: %v", err)
-					ok = false
-				}
+			op := wl.nextOp()
+			err := doOp(tbl, wl, op)
+			if err != nil {
+				log.Printf("Error doing %s: %v", opNames[op], err)
 			}
+			allStats[op].Record(err == nil, time.Since(scheduled))
 		}()
 	}
+
+	if *qps > 0 {
+		interval := time.Duration(float64(time.Second) / *qps)
+		for next := time.Now(); next.Before(stopTime); next = next.Add(interval) {
+			time.Sleep(next.Sub(time.Now()))
+			issue(next)
+		}
+	} else {
+		for time.Now().Before(stopTime) {
+			issue(time.Now())
+		}
+	}
 	wg.Wait()
 
-	readsAgg := stat.NewAggregate("reads", reads.ds, reads.tries-reads.ok)
-	writesAgg := stat.NewAggregate("writes", writes.ds, writes.tries-writes.ok)
-	log.Printf("Reads (%d ok / %d tries):\n%v", reads.ok, reads.tries, readsAgg)
-	log.Printf("Writes (%d ok / %d tries):\n%v", writes.ok, writes.tries, writesAgg)
+	var aggs []*stat.Aggregate
+	var hists []*stat.Histogram
+	for i := range allStats {
+		s := &allStats[i]
+		if s.tries == 0 {
+			continue
+		}
+		agg := s.hist.Aggregate(s.tries - s.ok)
+		log.Printf("%s (%d ok / %d tries):\n%v", strings.Title(opNames[i]), s.ok, s.tries, agg)
+		aggs = append(aggs, agg)
+		hists = append(hists, s.hist)
+	}
 
 	if csvFile != nil {
-		stat.WriteCSV([]*stat.Aggregate{readsAgg, writesAgg}, csvFile)
+		if err := stat.WriteCSV(aggs, csvFile); err != nil {
+			log.Fatalf("Writing statistics: %v", err)
+		}
+	}
+	if *histOutput != "" {
+		if err := writeHistograms(*histOutput, hists); err != nil {
+			log.Fatalf("Writing histograms: %v", err)
+		}
+		log.Printf("Wrote latency histograms to %q", *histOutput)
+	}
+}
+
+// doOp performs a single operation of the given kind.
+func doOp(tbl *bigtable.Table, wl *workload, op opKind) error {
+	ctx := context.Background()
+	row := wl.nextKey()
+	switch op {
+	case opRead:
+		_, err := tbl.ReadRow(ctx, row, bigtable.RowFilter(bigtable.LatestNFilter(1)))
+		return err
+	case opWrite:
+		mut := bigtable.NewMutation()
+		mut.Set("f", "col", bigtable.Now(), bytes.Repeat([]byte("0"), wl.nextValueSize()))
+		return tbl.Apply(ctx, row, mut)
+	case opScan:
+		return tbl.ReadRows(ctx, bigtable.InfiniteRange(row), func(bigtable.Row) bool { return true },
+			bigtable.RowFilter(bigtable.LatestNFilter(1)), bigtable.LimitRows(int64(*scanRows)))
+	}
+	panic(fmt.Sprintf("unknown op kind %d", op))
+}
+
+func writeHistograms(filename string, hists []*stat.Histogram) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(filename, ".json") {
+		err = stat.WriteHistogramsJSON(hists, f)
+	} else {
+		err = stat.WriteHistogramsCSV(hists, f)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
 	}
+	return err
 }
 
-var allStats int64 // atomic
+var allOps int64 // atomic
 
 type stats struct {
 	mu        sync.Mutex
 	tries, ok int
-	ds        []time.Duration
+	hist      *stat.Histogram
 }
 
 func (s *stats) Record(ok bool, d time.Duration) {
@@ -177,10 +252,10 @@ func (s *stats) Record(ok bool, d time.Duration) {
 	if ok {
 		s.ok++
 	}
-	s.ds = append(s.ds, d)
 	s.mu.Unlock()
+	s.hist.Record(d)
 
-	if n := atomic.AddInt64(&allStats, 1); n%1000 == 0 {
+	if n := atomic.AddInt64(&allOps, 1); n%1000 == 0 {
 		log.Printf("Progress: done %d ops", n)
 	}
 }
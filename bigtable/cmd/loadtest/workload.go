@@ -0,0 +1,191 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type opKind int
+
+const (
+	opRead opKind = iota
+	opWrite
+	opScan
+	numOpKinds
+)
+
+var opNames = [numOpKinds]string{"reads", "writes", "scans"}
+
+// A workload describes the mix of operations issued by the load test.
+type workload struct {
+	rnd       *rand.Rand
+	cum       [numOpKinds]float64 // cumulative operation probabilities
+	keys      keyGenerator
+	keyWidth  int
+	valueSize sizeGenerator
+}
+
+// newWorkload returns a workload with the given operation ratios, which need not sum to 1.
+func newWorkload(ratios [numOpKinds]float64, keyDist string, numKeys int64, zipfS float64,
+	valueSizeDist string, valueSize int) (*workload, error) {
+	w := &workload{
+		rnd:      rand.New(&lockedSource{src: rand.NewSource(time.Now().UnixNano())}),
+		keyWidth: len(strconv.FormatInt(numKeys-1, 10)),
+	}
+
+	var total float64
+	for i, r := range ratios {
+		if r < 0 {
+			return nil, fmt.Errorf("negative ratio %v for %s", r, opNames[i])
+		}
+		total += r
+		w.cum[i] = total
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("all operation ratios are zero")
+	}
+	for i := range w.cum {
+		w.cum[i] /= total
+	}
+
+	if numKeys < 1 {
+		return nil, fmt.Errorf("number of keys must be positive, got %d", numKeys)
+	}
+	switch keyDist {
+	case "uniform":
+		w.keys = uniformKeys{w.rnd, numKeys}
+	case "zipfian":
+		if zipfS <= 1 {
+			return nil, fmt.Errorf("zipfian exponent must be > 1, got %v", zipfS)
+		}
+		w.keys = zipfKeys{rand.NewZipf(w.rnd, zipfS, 1, uint64(numKeys-1))}
+	case "sequential":
+		w.keys = &sequentialKeys{n: numKeys}
+	default:
+		return nil, fmt.Errorf("unknown key distribution %q", keyDist)
+	}
+
+	if valueSize < 0 {
+		return nil, fmt.Errorf("value size must not be negative, got %d", valueSize)
+	}
+	switch valueSizeDist {
+	case "constant":
+		w.valueSize = constantSize(valueSize)
+	case "uniform":
+		w.valueSize = uniformSize{w.rnd, valueSize}
+	case "exponential":
+		w.valueSize = exponentialSize{w.rnd, valueSize}
+	default:
+		return nil, fmt.Errorf("unknown value size distribution %q", valueSizeDist)
+	}
+	return w, nil
+}
+
+// nextOp picks the kind of the next operation.
+func (w *workload) nextOp() opKind {
+	f := w.rnd.Float64()
+	for i, c := range w.cum {
+		if f < c {
+			return opKind(i)
+		}
+	}
+	return numOpKinds - 1
+}
+
+// nextKey picks the row key for the next operation.
+// Keys are zero-padded so that they sort in numeric order, which makes scans meaningful.
+func (w *workload) nextKey() string {
+	return fmt.Sprintf("row%0*d", w.keyWidth, w.keys.next())
+}
+
+// nextValueSize picks the size of the next value written.
+func (w *workload) nextValueSize() int {
+	return w.valueSize.next()
+}
+
+// lockedSource is a rand.Source that is safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.src.Seed(seed)
+}
+
+// A keyGenerator generates key indexes in [0, numKeys).
+type keyGenerator interface {
+	next() int64
+}
+
+type uniformKeys struct {
+	rnd *rand.Rand
+	n   int64
+}
+
+func (k uniformKeys) next() int64 { return k.rnd.Int63n(k.n) }
+
+type zipfKeys struct {
+	z *rand.Zipf
+}
+
+func (k zipfKeys) next() int64 { return int64(k.z.Uint64()) }
+
+type sequentialKeys struct {
+	n   int64
+	cur int64 // atomic
+}
+
+func (k *sequentialKeys) next() int64 { return (atomic.AddInt64(&k.cur, 1) - 1) % k.n }
+
+// A sizeGenerator generates value sizes in bytes.
+type sizeGenerator interface {
+	next() int
+}
+
+type constantSize int
+
+func (s constantSize) next() int { return int(s) }
+
+// uniformSize generates sizes uniformly distributed in [0, 2*mean].
+type uniformSize struct {
+	rnd  *rand.Rand
+	mean int
+}
+
+func (s uniformSize) next() int { return s.rnd.Intn(2*s.mean + 1) }
+
+type exponentialSize struct {
+	rnd  *rand.Rand
+	mean int
+}
+
+func (s exponentialSize) next() int { return int(s.rnd.ExpFloat64() * float64(s.mean)) }
@@ -67,6 +67,9 @@ func main() {
 	if config.Creds != "" {
 		os.Setenv("GOOGLE_APPLICATION_CREDENTIALS", config.Creds)
 	}
+	if config.Emulator != "" {
+		os.Setenv("BIGTABLE_EMULATOR_HOST", config.Emulator)
+	}
 	if flag.NArg() != 1 {
 		flag.Usage()
 		os.Exit(1)
@@ -75,7 +78,7 @@ func main() {
 	table := flag.Arg(0)
 
 	log.Printf("Dialing connections...")
-	client, err = bigtable.NewClient(context.Background(), config.Project, config.Instance)
+	client, err = bigtable.NewClient(context.Background(), config.Project, config.Instance, config.DataOptions()...)
 	if err != nil {
 		log.Fatalf("Making bigtable.Client: %v", err)
 	}
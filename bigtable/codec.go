@@ -0,0 +1,305 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// This file implements an optional layer for storing Go structs in rows.
+//
+// A struct field is stored in the column named by its "bigtable" tag,
+// written as "family:column". If the column is omitted, as in "family:",
+// the field name is used. Fields without a tag, or with the tag "-",
+// are ignored. The option ",omitempty" skips zero values when writing.
+// For example:
+//
+//	type User struct {
+//		Name   string `bigtable:"info:name"`
+//		Visits int64  `bigtable:"stats:visits"`
+//		Avatar []byte `bigtable:"info:,omitempty"` // stored in info:Avatar
+//	}
+//
+// Values are encoded as follows:
+//	- []byte is stored as is.
+//	- string is stored as its bytes.
+//	- bool is stored as a single byte, 0 or 1.
+//	- Signed and unsigned integers are stored as 8-byte big-endian values,
+//	  so integer columns work with ReadModifyWrite.Increment.
+//	- float32 and float64 are stored as the 8-byte big-endian IEEE 754
+//	  representation of a float64.
+//	- Types implementing proto.Message are stored in the protocol buffer
+//	  binary format.
+//	- Types implementing encoding.BinaryMarshaler and
+//	  encoding.BinaryUnmarshaler use those methods. This includes pointers
+//	  to such types, such as *time.Time; a nil pointer is stored as an empty
+//	  value, and an empty value is decoded as a nil pointer.
+
+// StructMutation returns a Mutation that sets the tagged fields of the struct
+// src, which must be a struct or a pointer to one, with the given timestamp.
+func StructMutation(src interface{}, ts Timestamp) (*Mutation, error) {
+	v := reflect.ValueOf(src)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("bigtable: StructMutation of non-struct type %T", src)
+	}
+	fields, err := structColumns(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	m := NewMutation()
+	for _, f := range fields {
+		fv := v.Field(f.index)
+		if f.omitEmpty && isZero(fv) {
+			continue
+		}
+		b, err := encodeValue(fv)
+		if err != nil {
+			return nil, fmt.Errorf("bigtable: field %s: %v", f.name, err)
+		}
+		m.Set(f.family, f.column, ts, b)
+	}
+	return m, nil
+}
+
+// DecodeRow sets the tagged fields of the struct pointed to by dst from the
+// cells of the row. Each field is set from the latest cell in its column.
+// Fields whose columns are not in the row are left unchanged.
+func DecodeRow(r Row, dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bigtable: DecodeRow into %T, want non-nil pointer to struct", dst)
+	}
+	v = v.Elem()
+	fields, err := structColumns(v.Type())
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		var latest *ReadItem
+		col := f.family + ":" + f.column
+		for i, item := range r[f.family] {
+			if item.Column == col && (latest == nil || item.Timestamp > latest.Timestamp) {
+				latest = &r[f.family][i]
+			}
+		}
+		if latest == nil {
+			continue
+		}
+		if err := decodeValue(latest.Value, v.Field(f.index)); err != nil {
+			return fmt.Errorf("bigtable: column %s: %v", col, err)
+		}
+	}
+	return nil
+}
+
+// EncodeInt64 returns the 8-byte big-endian encoding of v, which is the
+// encoding used by ReadModifyWrite.Increment. Non-negative values sort
+// in numeric order, so EncodeInt64 can also be used to build row keys.
+func EncodeInt64(v int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	return b
+}
+
+// DecodeInt64 decodes a value encoded by EncodeInt64.
+func DecodeInt64(b []byte) (int64, error) {
+	if len(b) != 8 {
+		return 0, fmt.Errorf("bigtable: int64 value has %d bytes, want 8", len(b))
+	}
+	return int64(binary.BigEndian.Uint64(b)), nil
+}
+
+// A structColumn describes a struct field stored in a column.
+type structColumn struct {
+	index          int
+	name           string // field name
+	family, column string
+	omitEmpty      bool
+}
+
+// structColumns returns the tagged fields of the struct type t.
+func structColumns(t reflect.Type) ([]structColumn, error) {
+	var cols []structColumn
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("bigtable")
+		if tag == "" || tag == "-" {
+			continue
+		}
+		if sf.PkgPath != "" {
+			return nil, fmt.Errorf("bigtable: tagged field %s of %v is unexported", sf.Name, t)
+		}
+		opts := strings.Split(tag, ",")
+		colon := strings.Index(opts[0], ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("bigtable: field %s of %v has tag %q, want \"family:column\"", sf.Name, t, tag)
+		}
+		c := structColumn{
+			index:  sf.Index[0],
+			name:   sf.Name,
+			family: opts[0][:colon],
+			column: opts[0][colon+1:],
+		}
+		if c.column == "" {
+			c.column = sf.Name
+		}
+		for _, opt := range opts[1:] {
+			switch opt {
+			case "omitempty":
+				c.omitEmpty = true
+			default:
+				return nil, fmt.Errorf("bigtable: field %s of %v has unknown tag option %q", sf.Name, t, opt)
+			}
+		}
+		cols = append(cols, c)
+	}
+	return cols, nil
+}
+
+var (
+	protoMessageType      = reflect.TypeOf((*proto.Message)(nil)).Elem()
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+func encodeValue(v reflect.Value) ([]byte, error) {
+	t := v.Type()
+	switch {
+	case t.Implements(protoMessageType):
+		if v.IsNil() {
+			return nil, nil
+		}
+		return proto.Marshal(v.Interface().(proto.Message))
+	case t.Implements(binaryMarshalerType):
+		if t.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		return v.Interface().(encoding.BinaryMarshaler).MarshalBinary()
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		return v.Bytes(), nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return []byte(v.String()), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return EncodeInt64(v.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return EncodeInt64(int64(v.Uint())), nil
+	case reflect.Float32, reflect.Float64:
+		return EncodeInt64(int64(math.Float64bits(v.Float()))), nil
+	}
+	return nil, fmt.Errorf("unsupported type %v", t)
+}
+
+func decodeValue(b []byte, v reflect.Value) error {
+	t := v.Type()
+	switch {
+	case t.Implements(protoMessageType):
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return proto.Unmarshal(b, v.Interface().(proto.Message))
+	case t.Kind() == reflect.Ptr && t.Implements(binaryUnmarshalerType):
+		if len(b) == 0 {
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return v.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	case reflect.PtrTo(t).Implements(binaryUnmarshalerType):
+		return v.Addr().Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(b)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		v.SetBytes(append([]byte(nil), b...))
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(string(b))
+	case reflect.Bool:
+		if len(b) != 1 {
+			return fmt.Errorf("bool value has %d bytes, want 1", len(b))
+		}
+		v.SetBool(b[0] != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := DecodeInt64(b)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(n) {
+			return fmt.Errorf("value %d overflows %v", n, t)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := DecodeInt64(b)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(uint64(n)) {
+			return fmt.Errorf("value %d overflows %v", uint64(n), t)
+		}
+		v.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, err := DecodeInt64(b)
+		if err != nil {
+			return err
+		}
+		f := math.Float64frombits(uint64(n))
+		if v.OverflowFloat(f) {
+			return fmt.Errorf("value %g overflows %v", f, t)
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported type %v", t)
+	}
+	return nil
+}
+
+// isZero reports whether v is the zero value for its type.
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return reflect.DeepEqual(v.Interface(), reflect.Zero(v.Type()).Interface())
+}
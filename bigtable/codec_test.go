@@ -0,0 +1,138 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+)
+
+type codecTestStruct struct {
+	Name    string                `bigtable:"fam:name"`
+	Count   int64                 `bigtable:"fam:count"`
+	Small   int8                  `bigtable:"fam:small"`
+	Ratio   float64               `bigtable:"fam:ratio"`
+	OK      bool                  `bigtable:"fam:ok"`
+	Data    []byte                `bigtable:"fam:,omitempty"`
+	When    time.Time             `bigtable:"fam:when"`
+	WhenPtr *time.Time            `bigtable:"fam:whenptr"`
+	NilPtr  *time.Time            `bigtable:"fam:nilptr"`
+	Proto   *wrappers.StringValue `bigtable:"fam:proto"`
+	Ignored string
+	Skipped string `bigtable:"-"`
+}
+
+func TestStructRoundTrip(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tbl, cleanup := setupTestTable(ctx, t)
+	defer cleanup()
+
+	when := time.Unix(5678, 1234).UTC()
+	in := codecTestStruct{
+		Name:    "gopher",
+		Count:   -3,
+		Small:   7,
+		Ratio:   0.25,
+		OK:      true,
+		When:    time.Unix(1234, 5678).UTC(),
+		WhenPtr: &when,
+		Proto:   &wrappers.StringValue{Value: "wrapped"},
+		Ignored: "ignored",
+		Skipped: "skipped",
+	}
+	m, err := StructMutation(&in, 1000)
+	if err != nil {
+		t.Fatalf("StructMutation: %v", err)
+	}
+	if got, want := len(m.ops), 9; got != want {
+		t.Errorf("StructMutation made %d mutations, want %d", got, want)
+	}
+	if err := tbl.Apply(ctx, "row", m); err != nil {
+		t.Fatalf("Apply: %v", err)
+	}
+
+	// Integer columns work with Increment.
+	rmw := NewReadModifyWrite()
+	rmw.Increment("fam", "count", 5)
+	if _, err := tbl.ApplyReadModifyWrite(ctx, "row", rmw); err != nil {
+		t.Fatalf("ApplyReadModifyWrite: %v", err)
+	}
+
+	row, err := tbl.ReadRow(ctx, "row")
+	if err != nil {
+		t.Fatalf("ReadRow: %v", err)
+	}
+	var out codecTestStruct
+	if err := DecodeRow(row, &out); err != nil {
+		t.Fatalf("DecodeRow: %v", err)
+	}
+	// Marshaling may cache state in the message, so compare protos with proto.Equal.
+	if !proto.Equal(out.Proto, in.Proto) {
+		t.Errorf("DecodeRow: got Proto %v, want %v", out.Proto, in.Proto)
+	}
+	want := in
+	want.Count = 2
+	want.Ignored, want.Skipped = "", ""
+	out.Proto, want.Proto = nil, nil
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("DecodeRow: got %+v, want %+v", out, want)
+	}
+}
+
+func TestStructErrors(t *testing.T) {
+	type badTag struct {
+		F string `bigtable:"nocolon"`
+	}
+	type badType struct {
+		F map[string]int `bigtable:"fam:f"`
+	}
+	for _, v := range []interface{}{"not a struct", badTag{}, badType{}} {
+		if _, err := StructMutation(v, 0); err == nil {
+			t.Errorf("StructMutation(%#v): got nil error, want error", v)
+		}
+	}
+
+	row := Row{"fam": {{Row: "row", Column: "fam:small", Value: EncodeInt64(1000)}}}
+	var s codecTestStruct
+	if err := DecodeRow(row, &s); err == nil {
+		t.Error("DecodeRow of overflowing int8: got nil error, want error")
+	}
+	if err := DecodeRow(row, s); err == nil {
+		t.Error("DecodeRow into non-pointer: got nil error, want error")
+	}
+}
+
+func TestDecodeRowLatest(t *testing.T) {
+	row := Row{"fam": {
+		{Row: "row", Column: "fam:name", Timestamp: 1000, Value: []byte("old")},
+		{Row: "row", Column: "fam:name", Timestamp: 3000, Value: []byte("new")},
+		{Row: "row", Column: "fam:name", Timestamp: 2000, Value: []byte("middle")},
+	}}
+	var s codecTestStruct
+	if err := DecodeRow(row, &s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "new" {
+		t.Errorf("Name = %q, want %q", s.Name, "new")
+	}
+}
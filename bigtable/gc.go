@@ -129,3 +129,43 @@ func (ma maxAgePolicy) proto() *bttdpb.GcRule {
 		}},
 	}
 }
+
+// NoGCPolicy returns a GC policy that never applies, so cells are kept forever.
+func NoGCPolicy() GCPolicy { return noGCPolicy{} }
+
+type noGCPolicy struct{}
+
+func (noGCPolicy) String() string { return "" }
+
+func (noGCPolicy) proto() *bttdpb.GcRule { return &bttdpb.GcRule{} }
+
+// gcRuleToPolicy converts a GcRule proto to the equivalent GCPolicy.
+// A nil or empty rule yields NoGCPolicy.
+func gcRuleToPolicy(rule *bttdpb.GcRule) GCPolicy {
+	if rule == nil {
+		return NoGCPolicy()
+	}
+	switch r := rule.Rule.(type) {
+	case *bttdpb.GcRule_MaxNumVersions:
+		return MaxVersionsPolicy(int(r.MaxNumVersions))
+	case *bttdpb.GcRule_MaxAge:
+		var d time.Duration
+		if r.MaxAge != nil {
+			d = time.Duration(r.MaxAge.Seconds)*time.Second + time.Duration(r.MaxAge.Nanos)
+		}
+		return MaxAgePolicy(d)
+	case *bttdpb.GcRule_Intersection_:
+		return IntersectionPolicy(gcRulesToPolicies(r.Intersection.Rules)...)
+	case *bttdpb.GcRule_Union_:
+		return UnionPolicy(gcRulesToPolicies(r.Union.Rules)...)
+	}
+	return NoGCPolicy()
+}
+
+func gcRulesToPolicies(rules []*bttdpb.GcRule) []GCPolicy {
+	var ps []GCPolicy
+	for _, r := range rules {
+		ps = append(ps, gcRuleToPolicy(r))
+	}
+	return ps
+}
@@ -15,6 +15,10 @@ limitations under the License.
 */
 
 // Package cbtrc encapsulates common code for reading .cbtrc files.
+//
+// A .cbtrc file holds key = value lines. Lines before the first
+// [name] line set default values; the lines in a [name] section
+// form a named profile that overrides the defaults when selected.
 package cbtrc
 
 import (
@@ -26,12 +30,26 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+
+	"google.golang.org/api/option"
 )
 
+// ProfileEnv is the environment variable that selects a profile
+// when the -profile flag is not given.
+const ProfileEnv = "CBT_PROFILE"
+
 // Config represents a configuration.
 type Config struct {
 	Project, Instance string // required
 	Creds             string // optional
+	AdminEndpoint     string // optional
+	DataEndpoint      string // optional
+	Emulator          string // optional; host:port of a Bigtable emulator
+
+	// Profile is the name of the selected profile, if any.
+	Profile string
+
+	profiles map[string]*Config
 }
 
 // RegisterFlags registers a set of standard flags for this config.
@@ -40,10 +58,19 @@ func (c *Config) RegisterFlags() {
 	flag.StringVar(&c.Project, "project", c.Project, "project ID")
 	flag.StringVar(&c.Instance, "instance", c.Instance, "Cloud Bigtable instance")
 	flag.StringVar(&c.Creds, "creds", c.Creds, "if set, use application credentials in this file")
+	flag.StringVar(&c.AdminEndpoint, "admin-endpoint", c.AdminEndpoint, "if set, use this endpoint for admin operations")
+	flag.StringVar(&c.DataEndpoint, "data-endpoint", c.DataEndpoint, "if set, use this endpoint for data operations")
+	flag.StringVar(&c.Emulator, "emulator", c.Emulator, "if set, connect to the Bigtable emulator at this host:port")
+	flag.StringVar(&c.Profile, "profile", os.Getenv(ProfileEnv), "if set, use this named profile from the .cbtrc file (default from $"+ProfileEnv+")")
 }
 
-// CheckFlags checks that the required config values are set.
+// CheckFlags applies the selected profile and checks that the required
+// config values are set. It should be called after flag.Parse.
+// Values given as flags take precedence over those in the profile.
 func (c *Config) CheckFlags() error {
+	if err := c.applyProfile(setFlags()); err != nil {
+		return err
+	}
 	var missing []string
 	if c.Project == "" {
 		missing = append(missing, "-project")
@@ -57,6 +84,58 @@ func (c *Config) CheckFlags() error {
 	return nil
 }
 
+// setFlags returns the names of the flags set on the command line.
+func setFlags() map[string]bool {
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	return set
+}
+
+// applyProfile overrides c's values with the non-empty values of the
+// selected profile, except for those named in set.
+func (c *Config) applyProfile(set map[string]bool) error {
+	if c.Profile == "" {
+		return nil
+	}
+	p, ok := c.profiles[c.Profile]
+	if !ok {
+		return fmt.Errorf("Unknown profile %q in %s", c.Profile, Filename())
+	}
+	for _, f := range []struct {
+		name     string
+		dst, src *string
+	}{
+		{"project", &c.Project, &p.Project},
+		{"instance", &c.Instance, &p.Instance},
+		{"creds", &c.Creds, &p.Creds},
+		{"admin-endpoint", &c.AdminEndpoint, &p.AdminEndpoint},
+		{"data-endpoint", &c.DataEndpoint, &p.DataEndpoint},
+		{"emulator", &c.Emulator, &p.Emulator},
+	} {
+		if !set[f.name] && *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	return nil
+}
+
+// DataOptions returns the client options for a bigtable.Client.
+func (c *Config) DataOptions() []option.ClientOption {
+	if c.DataEndpoint == "" {
+		return nil
+	}
+	return []option.ClientOption{option.WithEndpoint(c.DataEndpoint)}
+}
+
+// AdminOptions returns the client options for a bigtable.AdminClient
+// or bigtable.InstanceAdminClient.
+func (c *Config) AdminOptions() []option.ClientOption {
+	if c.AdminEndpoint == "" {
+		return nil
+	}
+	return []option.ClientOption{option.WithEndpoint(c.AdminEndpoint)}
+}
+
 // Filename returns the filename consulted for standard configuration.
 func Filename() string {
 	// TODO(dsymonds): Might need tweaking for Windows.
@@ -75,10 +154,30 @@ func Load() (*Config, error) {
 		}
 		return nil, fmt.Errorf("Reading %s: %v", filename, err)
 	}
-	c := new(Config)
+	return parse(filename, data)
+}
+
+func parse(filename string, data []byte) (*Config, error) {
+	c := &Config{profiles: make(map[string]*Config)}
+	cur := c // the config being filled in
 	s := bufio.NewScanner(bytes.NewReader(data))
 	for s.Scan() {
-		line := s.Text()
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if name == "" {
+				return nil, fmt.Errorf("Bad line in %s: %q", filename, line)
+			}
+			if _, ok := c.profiles[name]; ok {
+				return nil, fmt.Errorf("Duplicate profile in %s: %q", filename, name)
+			}
+			cur = new(Config)
+			c.profiles[name] = cur
+			continue
+		}
 		i := strings.Index(line, "=")
 		if i < 0 {
 			return nil, fmt.Errorf("Bad line in %s: %q", filename, line)
@@ -88,11 +187,17 @@ func Load() (*Config, error) {
 		default:
 			return nil, fmt.Errorf("Unknown key in %s: %q", filename, key)
 		case "project":
-			c.Project = val
+			cur.Project = val
 		case "instance":
-			c.Instance = val
+			cur.Instance = val
 		case "creds":
-			c.Creds = val
+			cur.Creds = val
+		case "admin-endpoint":
+			cur.AdminEndpoint = val
+		case "data-endpoint":
+			cur.DataEndpoint = val
+		case "emulator":
+			cur.Emulator = val
 		}
 	}
 	return c, s.Err()
@@ -0,0 +1,82 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cbtrc
+
+import "testing"
+
+const testFile = `
+# defaults
+project = my-project
+instance = prod
+creds = /path/to/creds.json
+
+[staging]
+instance = staging
+data-endpoint = staging-bigtable.example.com:443
+admin-endpoint = staging-bigtableadmin.example.com:443
+
+[local]
+emulator = localhost:9000
+`
+
+func TestParse(t *testing.T) {
+	c, err := parse("test", []byte(testFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Project != "my-project" || c.Instance != "prod" || c.Creds != "/path/to/creds.json" {
+		t.Errorf("defaults: got %+v", c)
+	}
+	if got := len(c.profiles); got != 2 {
+		t.Fatalf("got %d profiles, want 2", got)
+	}
+
+	c.Profile = "staging"
+	if err := c.applyProfile(map[string]bool{"admin-endpoint": true}); err != nil {
+		t.Fatal(err)
+	}
+	if c.Project != "my-project" {
+		t.Errorf("Project = %q, want the default", c.Project)
+	}
+	if c.Instance != "staging" {
+		t.Errorf("Instance = %q, want %q", c.Instance, "staging")
+	}
+	if c.DataEndpoint != "staging-bigtable.example.com:443" {
+		t.Errorf("DataEndpoint = %q", c.DataEndpoint)
+	}
+	if c.AdminEndpoint != "" {
+		t.Errorf("AdminEndpoint = %q, want the flag value to be kept", c.AdminEndpoint)
+	}
+
+	c.Profile = "nonesuch"
+	if err := c.applyProfile(nil); err == nil {
+		t.Error("applyProfile with an unknown profile did not fail")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		"project",
+		"color = blue",
+		"[]",
+		"[a]\n[a]",
+	} {
+		if _, err := parse("test", []byte(data)); err == nil {
+			t.Errorf("parse(%q) did not fail", data)
+		}
+	}
+}
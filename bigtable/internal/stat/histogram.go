@@ -0,0 +1,321 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// subBucketBits determines the precision of a Histogram.
+// Each power-of-two range of values is split into 1<<(subBucketBits-1)
+// linear sub-buckets, so recorded values are accurate to within 1/64 (about 1.6%).
+const (
+	subBucketBits  = 7
+	subBucketCount = 1 << subBucketBits
+	subBucketHalf  = subBucketCount / 2
+)
+
+// A Histogram records a distribution of latencies in the manner of an
+// HDR histogram: buckets are linear within each power of two, so the
+// relative error of any reported value is bounded regardless of magnitude,
+// and memory use is independent of the number of recorded values.
+// Values are recorded with microsecond resolution.
+//
+// A Histogram is safe for concurrent use.
+type Histogram struct {
+	Name string
+
+	mu       sync.Mutex
+	counts   []int64
+	count    int64
+	sum      int64 // in microseconds
+	min, max int64 // in microseconds
+}
+
+// NewHistogram returns an empty histogram with the given name.
+func NewHistogram(name string) *Histogram {
+	return &Histogram{Name: name}
+}
+
+// bitLen returns the number of bits needed to represent v.
+func bitLen(v int64) int {
+	n := 0
+	for ; v != 0; v >>= 1 {
+		n++
+	}
+	return n
+}
+
+// bucketIndex returns the index of the bucket holding v, which must be non-negative.
+func bucketIndex(v int64) int {
+	if v < subBucketCount {
+		return int(v)
+	}
+	shift := uint(bitLen(v) - subBucketBits)
+	return subBucketCount + int(shift-1)*subBucketHalf + int(v>>shift) - subBucketHalf
+}
+
+// bucketRange returns the lowest and highest values held by bucket i.
+func bucketRange(i int) (lo, hi int64) {
+	if i < subBucketCount {
+		return int64(i), int64(i)
+	}
+	shift := uint((i-subBucketCount)/subBucketHalf + 1)
+	m := int64((i-subBucketCount)%subBucketHalf + subBucketHalf)
+	return m << shift, (m+1)<<shift - 1
+}
+
+// Record adds d to the histogram. Negative durations are recorded as zero.
+func (h *Histogram) Record(d time.Duration) {
+	v := int64(d / time.Microsecond)
+	if v < 0 {
+		v = 0
+	}
+	i := bucketIndex(v)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i >= len(h.counts) {
+		counts := make([]int64, i+1)
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+	h.counts[i]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+// Merge adds the values recorded in o to h.
+func (h *Histogram) Merge(o *Histogram) {
+	o.mu.Lock()
+	counts := append([]int64(nil), o.counts...)
+	count, sum, min, max := o.count, o.sum, o.min, o.max
+	o.mu.Unlock()
+	if count == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(counts) > len(h.counts) {
+		c := make([]int64, len(counts))
+		copy(c, h.counts)
+		h.counts = c
+	}
+	for i, n := range counts {
+		h.counts[i] += n
+	}
+	if h.count == 0 || min < h.min {
+		h.min = min
+	}
+	if max > h.max {
+		h.max = max
+	}
+	h.count += count
+	h.sum += sum
+}
+
+// Count returns the number of recorded values.
+func (h *Histogram) Count() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.count
+}
+
+// Min returns the smallest recorded value.
+func (h *Histogram) Min() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.min) * time.Microsecond
+}
+
+// Max returns the largest recorded value.
+func (h *Histogram) Max() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.max) * time.Microsecond
+}
+
+// Mean returns the mean of the recorded values.
+func (h *Histogram) Mean() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return 0
+	}
+	return time.Duration(h.sum/h.count) * time.Microsecond
+}
+
+// Quantile returns the value at quantile q, for 0 <= q <= 1.
+// It returns 0 if the histogram is empty.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return time.Duration(h.quantile(q)) * time.Microsecond
+}
+
+// quantile returns the value at quantile q in microseconds. h.mu must be held.
+func (h *Histogram) quantile(q float64) int64 {
+	if h.count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return h.min
+	}
+	if q >= 1 {
+		return h.max
+	}
+	target := int64(math.Ceil(q * float64(h.count)))
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= target {
+			_, hi := bucketRange(i)
+			if hi > h.max {
+				hi = h.max
+			}
+			if hi < h.min {
+				hi = h.min
+			}
+			return hi
+		}
+	}
+	return h.max
+}
+
+// Aggregate summarizes the histogram as an Aggregate with the given error count.
+// It returns nil if the histogram is empty.
+func (h *Histogram) Aggregate(errorCount int) *Aggregate {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.count == 0 {
+		return nil
+	}
+	us := func(q float64) time.Duration { return time.Duration(h.quantile(q)) * time.Microsecond }
+	return &Aggregate{
+		Name:   h.Name,
+		Count:  int(h.count),
+		Errors: errorCount,
+		Min:    us(0),
+		Median: us(0.5),
+		Max:    us(1),
+		P75:    us(0.75),
+		P90:    us(0.90),
+		P95:    us(0.95),
+		P99:    us(0.99),
+	}
+}
+
+// A HistogramBucket is a non-empty bucket of a HistogramSnapshot.
+type HistogramBucket struct {
+	LowMicros  int64 `json:"low_us"`
+	HighMicros int64 `json:"high_us"`
+	Count      int64 `json:"count"`
+}
+
+// A HistogramSnapshot is an exportable summary of a Histogram.
+type HistogramSnapshot struct {
+	Name        string            `json:"name"`
+	Count       int64             `json:"count"`
+	MinMicros   int64             `json:"min_us"`
+	MaxMicros   int64             `json:"max_us"`
+	MeanMicros  int64             `json:"mean_us"`
+	Percentiles map[string]int64  `json:"percentiles_us"` // keyed by "p50", "p99.9" etc.
+	Buckets     []HistogramBucket `json:"buckets"`
+}
+
+// snapshotPercentiles are the percentiles reported in a HistogramSnapshot.
+var snapshotPercentiles = []float64{50, 75, 90, 95, 99, 99.9, 99.99}
+
+// Snapshot returns a summary of the histogram's current contents.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := HistogramSnapshot{
+		Name:        h.Name,
+		Count:       h.count,
+		MinMicros:   h.min,
+		MaxMicros:   h.max,
+		Percentiles: make(map[string]int64),
+	}
+	if h.count > 0 {
+		s.MeanMicros = h.sum / h.count
+	}
+	for _, p := range snapshotPercentiles {
+		s.Percentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = h.quantile(p / 100)
+	}
+	for i, n := range h.counts {
+		if n == 0 {
+			continue
+		}
+		lo, hi := bucketRange(i)
+		s.Buckets = append(s.Buckets, HistogramBucket{LowMicros: lo, HighMicros: hi, Count: n})
+	}
+	return s
+}
+
+// WriteHistogramsCSV writes the percentile distribution of each histogram
+// to w in csv format, with a header row and one row per non-empty bucket.
+func WriteHistogramsCSV(hs []*Histogram, iow io.Writer) error {
+	w := csv.NewWriter(iow)
+	err := w.Write([]string{"name", "low_us", "high_us", "count", "cumulative_count", "percentile"})
+	if err != nil {
+		return err
+	}
+	for _, h := range hs {
+		s := h.Snapshot()
+		var cum int64
+		for _, b := range s.Buckets {
+			cum += b.Count
+			err = w.Write([]string{
+				s.Name,
+				strconv.FormatInt(b.LowMicros, 10), strconv.FormatInt(b.HighMicros, 10),
+				strconv.FormatInt(b.Count, 10), strconv.FormatInt(cum, 10),
+				strconv.FormatFloat(100*float64(cum)/float64(s.Count), 'f', 4, 64),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// WriteHistogramsJSON writes snapshots of the histograms to w as a JSON array.
+func WriteHistogramsJSON(hs []*Histogram, w io.Writer) error {
+	ss := make([]HistogramSnapshot, len(hs))
+	for i, h := range hs {
+		ss[i] = h.Snapshot()
+	}
+	b, err := json.MarshalIndent(ss, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
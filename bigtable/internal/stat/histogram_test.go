@@ -0,0 +1,121 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stat
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBucketIndex(t *testing.T) {
+	for _, v := range []int64{0, 1, 127, 128, 129, 255, 256, 1000, 123456, 1 << 40} {
+		lo, hi := bucketRange(bucketIndex(v))
+		if v < lo || v > hi {
+			t.Errorf("value %d: bucket range [%d, %d] does not contain it", v, lo, hi)
+		}
+		if err := float64(hi-lo) / float64(lo+1); err > 1.0/subBucketHalf {
+			t.Errorf("value %d: bucket range [%d, %d] too wide", v, lo, hi)
+		}
+	}
+	// Buckets must be contiguous.
+	for i := 1; i < 1000; i++ {
+		_, prevHi := bucketRange(i - 1)
+		if lo, _ := bucketRange(i); lo != prevHi+1 {
+			t.Fatalf("bucket %d starts at %d, want %d", i, lo, prevHi+1)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("test")
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("empty Quantile(0.5) = %v, want 0", got)
+	}
+	if agg := h.Aggregate(0); agg != nil {
+		t.Errorf("empty Aggregate = %v, want nil", agg)
+	}
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	if got := h.Count(); got != 10000 {
+		t.Errorf("Count = %d, want 10000", got)
+	}
+	if got, want := h.Min(), time.Microsecond; got != want {
+		t.Errorf("Min = %v, want %v", got, want)
+	}
+	if got, want := h.Max(), 10*time.Millisecond; got != want {
+		t.Errorf("Max = %v, want %v", got, want)
+	}
+	for _, tc := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{0.5, 5 * time.Millisecond},
+		{0.9, 9 * time.Millisecond},
+		{0.99, 9900 * time.Microsecond},
+	} {
+		got := h.Quantile(tc.q)
+		if d := got - tc.want; d < 0 || float64(d) > float64(tc.want)/subBucketHalf {
+			t.Errorf("Quantile(%v) = %v, want within 1/%d above %v", tc.q, got, subBucketHalf, tc.want)
+		}
+	}
+
+	o := NewHistogram("other")
+	o.Record(time.Second)
+	h.Merge(o)
+	if got := h.Count(); got != 10001 {
+		t.Errorf("after Merge, Count = %d, want 10001", got)
+	}
+	if got := h.Max(); got != time.Second {
+		t.Errorf("after Merge, Max = %v, want 1s", got)
+	}
+}
+
+func TestWriteHistograms(t *testing.T) {
+	h := NewHistogram("reads")
+	h.Record(10 * time.Microsecond)
+	h.Record(10 * time.Microsecond)
+	h.Record(time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := WriteHistogramsCSV([]*Histogram{h}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d csv lines, want 3:\n%s", len(lines), buf.String())
+	}
+	if want := "reads,10,10,2,2,66.6667"; lines[1] != want {
+		t.Errorf("csv line 1 = %q, want %q", lines[1], want)
+	}
+
+	buf.Reset()
+	if err := WriteHistogramsJSON([]*Histogram{h}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	var ss []HistogramSnapshot
+	if err := json.Unmarshal(buf.Bytes(), &ss); err != nil {
+		t.Fatalf("bad JSON: %v", err)
+	}
+	if len(ss) != 1 || ss[0].Name != "reads" || ss[0].Count != 3 || len(ss[0].Buckets) != 2 {
+		t.Errorf("got snapshots %+v", ss)
+	}
+	if got := ss[0].Percentiles["p50"]; got != 10 {
+		t.Errorf("p50 = %d, want 10", got)
+	}
+}
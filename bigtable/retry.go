@@ -0,0 +1,96 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// isRetryable reports whether an RPC that failed with err may be retried,
+// provided the RPC is idempotent.
+func isRetryable(err error) bool {
+	switch grpc.Code(err) {
+	case codes.DeadlineExceeded, codes.Unavailable, codes.Aborted:
+		return true
+	}
+	return false
+}
+
+// backoff implements exponential backoff with jitter.
+// The zero value is ready to use.
+type backoff struct {
+	cur     time.Duration
+	retries int // calls to retry
+}
+
+const (
+	initialBackoff = 100 * time.Millisecond
+	maxBackoff     = 10 * time.Second
+	backoffFactor  = 1.5
+)
+
+// maxRetries is the number of times retry lets an operation be retried
+// before giving up, so that an operation that keeps failing ends even if
+// its context has no deadline. It is a variable for testing.
+var maxRetries = 20
+
+var errTooManyRetries = errors.New("bigtable: too many retries")
+
+// pause returns the next time to wait before retrying.
+func (b *backoff) pause() time.Duration {
+	if b.cur == 0 {
+		b.cur = initialBackoff
+	}
+	// Pick a random duration in [cur/2, cur) so that retrying clients spread out.
+	d := b.cur/2 + time.Duration(rand.Int63n(int64(b.cur/2)))
+	b.cur = time.Duration(float64(b.cur) * backoffFactor)
+	if b.cur > maxBackoff {
+		b.cur = maxBackoff
+	}
+	return d
+}
+
+// sleep waits for the next backoff interval.
+// It returns ctx.Err() if ctx is done first.
+func (b *backoff) sleep(ctx context.Context) error {
+	t := time.NewTimer(b.pause())
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retry waits for the next backoff interval before an operation is retried,
+// like sleep. It returns errTooManyRetries, without waiting, once it has
+// been called maxRetries times; reset b to allow more retries after the
+// operation makes progress.
+func (b *backoff) retry(ctx context.Context) error {
+	if b.retries >= maxRetries {
+		return errTooManyRetries
+	}
+	b.retries++
+	return b.sleep(ctx)
+}
@@ -0,0 +1,623 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable/bttest"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	btpb "google.golang.org/genproto/googleapis/bigtable/v2"
+	statpb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// failingServer is a fake Bigtable server whose RPCs fail partway through,
+// according to a script.
+type failingServer struct {
+	btpb.BigtableServer // unimplemented methods panic
+
+	rows []string // sorted row keys in the table
+
+	mu       sync.Mutex
+	failures []failure // one for each ReadRows attempt; attempts beyond these succeed
+	reqs     []*btpb.ReadRowsRequest
+
+	// For each MutateRows attempt, the codes to fail entries with, keyed by row key.
+	// Attempts beyond these succeed.
+	mutateFailures []map[string]codes.Code
+	mutateNoStatus map[string]bool // row keys whose status MutateRows never sends
+	mutateReqs     []*btpb.MutateRowsRequest
+}
+
+// A failure describes how one RPC fails.
+type failure struct {
+	after int        // number of rows sent before failing
+	code  codes.Code // code of the returned error
+}
+
+func (s *failingServer) nextFailure() (failure, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.failures) == 0 {
+		return failure{}, false
+	}
+	f := s.failures[0]
+	s.failures = s.failures[1:]
+	return f, true
+}
+
+func (s *failingServer) ReadRows(req *btpb.ReadRowsRequest, stream btpb.Bigtable_ReadRowsServer) error {
+	s.mu.Lock()
+	s.reqs = append(s.reqs, req)
+	s.mu.Unlock()
+
+	fail, ok := s.nextFailure()
+	sent := 0
+	for _, key := range s.rows {
+		if !rowSetContains(req.Rows, key) {
+			continue
+		}
+		if req.RowsLimit > 0 && int64(sent) >= req.RowsLimit {
+			break
+		}
+		if ok && sent == fail.after {
+			return grpc.Errorf(fail.code, "injected failure")
+		}
+		err := stream.Send(&btpb.ReadRowsResponse{Chunks: []*btpb.ReadRowsResponse_CellChunk{{
+			RowKey:     []byte(key),
+			FamilyName: &wrappers.StringValue{Value: "fam"},
+			Qualifier:  &wrappers.BytesValue{Value: []byte("col")},
+			Value:      []byte(key),
+			RowStatus:  &btpb.ReadRowsResponse_CellChunk_CommitRow{CommitRow: true},
+		}}})
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+	if ok && sent == fail.after {
+		return grpc.Errorf(fail.code, "injected failure")
+	}
+	return nil
+}
+
+func (s *failingServer) MutateRows(req *btpb.MutateRowsRequest, stream btpb.Bigtable_MutateRowsServer) error {
+	s.mu.Lock()
+	s.mutateReqs = append(s.mutateReqs, req)
+	var fails map[string]codes.Code
+	if len(s.mutateFailures) > 0 {
+		fails = s.mutateFailures[0]
+		s.mutateFailures = s.mutateFailures[1:]
+	}
+	s.mu.Unlock()
+
+	res := &btpb.MutateRowsResponse{}
+	for i, entry := range req.Entries {
+		if s.mutateNoStatus[string(entry.RowKey)] {
+			continue
+		}
+		code := fails[string(entry.RowKey)]
+		res.Entries = append(res.Entries, &btpb.MutateRowsResponse_Entry{
+			Index:  int64(i),
+			Status: &statpb.Status{Code: int32(code), Message: code.String() + " (100%)"},
+		})
+	}
+	return stream.Send(res)
+}
+
+func rowSetContains(rs *btpb.RowSet, key string) bool {
+	if len(rs.RowKeys) == 0 && len(rs.RowRanges) == 0 {
+		return true
+	}
+	for _, k := range rs.RowKeys {
+		if string(k) == key {
+			return true
+		}
+	}
+	for _, rr := range rs.RowRanges {
+		switch sk := rr.StartKey.(type) {
+		case *btpb.RowRange_StartKeyClosed:
+			if key < string(sk.StartKeyClosed) {
+				continue
+			}
+		case *btpb.RowRange_StartKeyOpen:
+			if key <= string(sk.StartKeyOpen) {
+				continue
+			}
+		}
+		switch ek := rr.EndKey.(type) {
+		case *btpb.RowRange_EndKeyClosed:
+			if key > string(ek.EndKeyClosed) {
+				continue
+			}
+		case *btpb.RowRange_EndKeyOpen:
+			if key >= string(ek.EndKeyOpen) {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// setupFailingServer starts srv and returns a Table connected to it,
+// and a function to clean up.
+func setupFailingServer(t *testing.T, srv btpb.BigtableServer) (*Table, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gsrv := grpc.NewServer()
+	btpb.RegisterBigtableServer(gsrv, srv)
+	go gsrv.Serve(l)
+
+	conn, err := grpc.Dial(l.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(context.Background(), "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client.Open("table"), func() {
+		client.Close()
+		gsrv.Stop()
+	}
+}
+
+func TestReadRowsRetry(t *testing.T) {
+	unavailable := func(after int) failure { return failure{after, codes.Unavailable} }
+	for _, test := range []struct {
+		desc     string
+		arg      RowSet
+		opts     []ReadOption
+		failures []failure
+		want     string // rows passed to the callback
+		wantErr  bool
+		wantReqs []*btpb.RowSet // RowSet of each request
+		wantLims []int64        // RowsLimit of each request, if opts is set
+	}{
+		{
+			desc:     "range",
+			arg:      InfiniteRange(""),
+			failures: []failure{unavailable(2), unavailable(0)},
+			want:     "a,b,c,d,e",
+			wantReqs: []*btpb.RowSet{
+				InfiniteRange("").proto(),
+				{RowRanges: []*btpb.RowRange{{StartKey: &btpb.RowRange_StartKeyOpen{StartKeyOpen: []byte("b")}}}},
+				{RowRanges: []*btpb.RowRange{{StartKey: &btpb.RowRange_StartKeyOpen{StartKeyOpen: []byte("b")}}}},
+			},
+		},
+		{
+			desc:     "row list",
+			arg:      RowList{"e", "a", "c"},
+			failures: []failure{unavailable(1)},
+			want:     "a,c,e",
+			wantReqs: []*btpb.RowSet{
+				RowList{"e", "a", "c"}.proto(),
+				RowList{"e", "c"}.proto(),
+			},
+		},
+		{
+			desc:     "range list",
+			arg:      RowRangeList{NewRange("a", "c"), NewClosedRange("d", "e")},
+			failures: []failure{unavailable(2)},
+			want:     "a,b,d,e",
+			wantReqs: []*btpb.RowSet{
+				RowRangeList{NewRange("a", "c"), NewClosedRange("d", "e")}.proto(),
+				RowRangeList{NewOpenRange("b", "c"), NewClosedRange("d", "e")}.proto(),
+			},
+		},
+		{
+			desc:     "limit",
+			arg:      InfiniteRange(""),
+			opts:     []ReadOption{LimitRows(4)},
+			failures: []failure{unavailable(1)},
+			want:     "a,b,c,d",
+			wantLims: []int64{4, 3},
+		},
+		{
+			desc:     "failure after the last row",
+			arg:      RowList{"a", "b"},
+			failures: []failure{unavailable(2)},
+			want:     "a,b",
+			wantReqs: []*btpb.RowSet{RowList{"a", "b"}.proto()},
+		},
+		{
+			desc:     "non-retryable error",
+			arg:      InfiniteRange(""),
+			failures: []failure{{1, codes.InvalidArgument}},
+			want:     "a",
+			wantErr:  true,
+		},
+		{
+			desc:     "empty row list",
+			arg:      RowList{},
+			wantReqs: []*btpb.RowSet{},
+		},
+		{
+			desc:     "empty row set list",
+			arg:      RowSetList{},
+			wantReqs: []*btpb.RowSet{},
+		},
+		{
+			desc:     "empty range",
+			arg:      NewRange("c", "c"),
+			wantReqs: []*btpb.RowSet{},
+		},
+	} {
+		srv := &failingServer{
+			rows:     []string{"a", "b", "c", "d", "e"},
+			failures: test.failures,
+		}
+		tbl, cleanup := setupFailingServer(t, srv)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+		var got []string
+		err := tbl.ReadRows(ctx, test.arg, func(r Row) bool {
+			got = append(got, r.Key())
+			return true
+		}, test.opts...)
+		cancel()
+		cleanup()
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: got error %v, want error: %t", test.desc, err, test.wantErr)
+		}
+		if g := strings.Join(got, ","); g != test.want {
+			t.Errorf("%s: read rows %q, want %q", test.desc, g, test.want)
+		}
+		if test.wantReqs != nil {
+			var gotReqs []*btpb.RowSet
+			for _, req := range srv.reqs {
+				gotReqs = append(gotReqs, req.Rows)
+			}
+			if len(gotReqs) != len(test.wantReqs) {
+				t.Errorf("%s: got %d requests, want %d", test.desc, len(gotReqs), len(test.wantReqs))
+				continue
+			}
+			for i := range gotReqs {
+				if !proto.Equal(gotReqs[i], test.wantReqs[i]) {
+					t.Errorf("%s: request %d: got RowSet %v, want %v", test.desc, i, gotReqs[i], test.wantReqs[i])
+				}
+			}
+		}
+		if test.wantLims != nil {
+			var gotLims []int64
+			for _, req := range srv.reqs {
+				gotLims = append(gotLims, req.RowsLimit)
+			}
+			if !reflect.DeepEqual(gotLims, test.wantLims) {
+				t.Errorf("%s: got RowsLimits %v, want %v", test.desc, gotLims, test.wantLims)
+			}
+		}
+	}
+}
+
+func TestReadRowsRetryLimit(t *testing.T) {
+	defer func(n int) { maxRetries = n }(maxRetries)
+	maxRetries = 2
+	unavailable := func(after int) failure { return failure{after, codes.Unavailable} }
+
+	for _, test := range []struct {
+		desc     string
+		failures []failure
+		want     string
+		wantErr  bool
+		wantReqs int
+	}{
+		{
+			desc:     "no progress",
+			failures: []failure{unavailable(0), unavailable(0), unavailable(0), unavailable(0)},
+			wantErr:  true,
+			wantReqs: 3,
+		},
+		{
+			// Each attempt reads a row, so retries are not exhausted.
+			desc:     "progress",
+			failures: []failure{unavailable(1), unavailable(1), unavailable(1), unavailable(1)},
+			want:     "a,b,c,d,e",
+			wantReqs: 5,
+		},
+	} {
+		srv := &failingServer{
+			rows:     []string{"a", "b", "c", "d", "e"},
+			failures: test.failures,
+		}
+		tbl, cleanup := setupFailingServer(t, srv)
+		// No deadline, so that only the retry limit ends the read.
+		var got []string
+		err := tbl.ReadRows(context.Background(), InfiniteRange(""), func(r Row) bool {
+			got = append(got, r.Key())
+			return true
+		})
+		cleanup()
+
+		if test.wantErr {
+			if grpc.Code(err) != codes.Unavailable {
+				t.Errorf("%s: got error %v, want code %v", test.desc, err, codes.Unavailable)
+			}
+		} else if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+		}
+		if g := strings.Join(got, ","); g != test.want {
+			t.Errorf("%s: read rows %q, want %q", test.desc, g, test.want)
+		}
+		if len(srv.reqs) != test.wantReqs {
+			t.Errorf("%s: got %d requests, want %d", test.desc, len(srv.reqs), test.wantReqs)
+		}
+	}
+}
+
+// flakyProxy forwards ReadRows to another server, such as bttest, failing the
+// first request with a transient error after forwarding failAfter rows.
+type flakyProxy struct {
+	btpb.BigtableServer // unimplemented methods panic
+
+	client    btpb.BigtableClient
+	failAfter int
+
+	mu   sync.Mutex
+	reqs []*btpb.ReadRowsRequest
+}
+
+func (p *flakyProxy) ReadRows(req *btpb.ReadRowsRequest, stream btpb.Bigtable_ReadRowsServer) error {
+	p.mu.Lock()
+	p.reqs = append(p.reqs, req)
+	first := len(p.reqs) == 1
+	p.mu.Unlock()
+
+	rs, err := p.client.ReadRows(stream.Context(), req)
+	if err != nil {
+		return err
+	}
+	for sent := 0; ; sent++ {
+		res, err := rs.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if first && sent == p.failAfter {
+			return grpc.Errorf(codes.Unavailable, "injected failure")
+		}
+		if err := stream.Send(res); err != nil {
+			return err
+		}
+	}
+}
+
+func TestReadRowsRetryLimitRowsBttest(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv, err := bttest.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	adminClient, err := NewAdminClient(ctx, "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer adminClient.Close()
+	if err := adminClient.CreateTable(ctx, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if err := adminClient.CreateColumnFamily(ctx, "table", "fam"); err != nil {
+		t.Fatal(err)
+	}
+
+	proxy := &flakyProxy{client: btpb.NewBigtableClient(conn), failAfter: 2}
+	tbl, cleanup := setupFailingServer(t, proxy)
+	defer cleanup()
+	keys := []string{"a", "b", "c", "d", "e", "f"}
+	var muts []*Mutation
+	for _, key := range keys {
+		m := NewMutation()
+		m.Set("fam", "col", 1000, []byte(key))
+		muts = append(muts, m)
+	}
+	client, err := NewClient(ctx, "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if errs, err := client.Open("table").ApplyBulk(ctx, keys, muts); err != nil || errs != nil {
+		t.Fatalf("ApplyBulk: %v, %v", errs, err)
+	}
+
+	// The first attempt fails after two rows; the retry must ask bttest for
+	// the two rows that remain under the limit, after the last row read.
+	var got []string
+	err = tbl.ReadRows(ctx, InfiniteRange(""), func(r Row) bool {
+		got = append(got, r.Key())
+		return true
+	}, LimitRows(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, want := strings.Join(got, ","), "a,b,c,d"; g != want {
+		t.Errorf("read rows %q, want %q", g, want)
+	}
+	var gotLims []int64
+	for _, req := range proxy.reqs {
+		gotLims = append(gotLims, req.RowsLimit)
+	}
+	if want := []int64{4, 2}; !reflect.DeepEqual(gotLims, want) {
+		t.Errorf("got RowsLimits %v, want %v", gotLims, want)
+	}
+}
+
+func TestApplyBulkRetry(t *testing.T) {
+	newMut := func(ts Timestamp) *Mutation {
+		m := NewMutation()
+		m.Set("fam", "col", ts, []byte("v"))
+		return m
+	}
+	for _, test := range []struct {
+		desc     string
+		muts     []*Mutation
+		failures []map[string]codes.Code
+		noStatus map[string]bool
+		wantErrs []codes.Code // nil if no errors are expected
+		wantReqs [][]string   // row keys of each request
+		wantStat BulkStats
+	}{
+		{
+			desc: "all succeed",
+			muts: []*Mutation{newMut(1000), newMut(1000), newMut(1000)},
+			wantReqs: [][]string{
+				{"a", "b", "c"},
+			},
+			wantStat: BulkStats{Attempts: 1, Retries: []int{0, 0, 0}},
+		},
+		{
+			desc: "retry transient failures only",
+			muts: []*Mutation{newMut(1000), newMut(1000), newMut(1000)},
+			failures: []map[string]codes.Code{
+				{"b": codes.Unavailable, "c": codes.InvalidArgument},
+				{"b": codes.DeadlineExceeded},
+			},
+			wantErrs: []codes.Code{codes.OK, codes.OK, codes.InvalidArgument},
+			wantReqs: [][]string{
+				{"a", "b", "c"},
+				{"b"},
+				{"b"},
+			},
+			wantStat: BulkStats{Attempts: 3, Retries: []int{0, 2, 0}},
+		},
+		{
+			desc: "no retry of non-idempotent mutations",
+			muts: []*Mutation{newMut(1000), newMut(ServerTime), newMut(1000)},
+			failures: []map[string]codes.Code{
+				{"a": codes.Unavailable, "b": codes.Unavailable},
+			},
+			wantErrs: []codes.Code{codes.OK, codes.Unavailable, codes.OK},
+			wantReqs: [][]string{
+				{"a", "b", "c"},
+				{"a"},
+			},
+			wantStat: BulkStats{Attempts: 2, Retries: []int{1, 0, 0}},
+		},
+		{
+			desc:     "missing status",
+			muts:     []*Mutation{newMut(1000), newMut(1000), newMut(1000)},
+			noStatus: map[string]bool{"b": true},
+			wantErrs: []codes.Code{codes.OK, codes.Internal, codes.OK},
+			wantReqs: [][]string{
+				{"a", "b", "c"},
+			},
+			wantStat: BulkStats{Attempts: 1, Retries: []int{0, 0, 0}},
+		},
+	} {
+		srv := &failingServer{mutateFailures: test.failures, mutateNoStatus: test.noStatus}
+		tbl, cleanup := setupFailingServer(t, srv)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+
+		var stats BulkStats
+		errs, err := tbl.ApplyBulk(ctx, []string{"a", "b", "c"}, test.muts, GetBulkStats(&stats))
+		cancel()
+		cleanup()
+
+		if err != nil {
+			t.Errorf("%s: %v", test.desc, err)
+			continue
+		}
+		if test.wantErrs == nil {
+			if errs != nil {
+				t.Errorf("%s: got errors %v, want none", test.desc, errs)
+			}
+		} else {
+			var gotErrs []codes.Code
+			for _, err := range errs {
+				gotErrs = append(gotErrs, grpc.Code(err))
+			}
+			if !reflect.DeepEqual(gotErrs, test.wantErrs) {
+				t.Errorf("%s: got error codes %v, want %v", test.desc, gotErrs, test.wantErrs)
+			}
+			for i, err := range errs {
+				code := grpc.Code(err)
+				if want := code.String() + " (100%)"; code != codes.OK && code != codes.Internal && grpc.ErrorDesc(err) != want {
+					t.Errorf("%s: error %d: got message %q, want %q", test.desc, i, grpc.ErrorDesc(err), want)
+				}
+			}
+		}
+		var gotReqs [][]string
+		for _, req := range srv.mutateReqs {
+			var keys []string
+			for _, entry := range req.Entries {
+				keys = append(keys, string(entry.RowKey))
+			}
+			gotReqs = append(gotReqs, keys)
+		}
+		if !reflect.DeepEqual(gotReqs, test.wantReqs) {
+			t.Errorf("%s: got requests %v, want %v", test.desc, gotReqs, test.wantReqs)
+		}
+		if !reflect.DeepEqual(stats, test.wantStat) {
+			t.Errorf("%s: got stats %+v, want %+v", test.desc, stats, test.wantStat)
+		}
+	}
+}
+
+func TestApplyBulkRetryLimit(t *testing.T) {
+	defer func(n int) { maxRetries = n }(maxRetries)
+	maxRetries = 2
+
+	var failures []map[string]codes.Code
+	for i := 0; i < 5; i++ {
+		failures = append(failures, map[string]codes.Code{"b": codes.Unavailable})
+	}
+	srv := &failingServer{mutateFailures: failures}
+	tbl, cleanup := setupFailingServer(t, srv)
+	defer cleanup()
+
+	var muts []*Mutation
+	for i := 0; i < 2; i++ {
+		m := NewMutation()
+		m.Set("fam", "col", 1000, []byte("v"))
+		muts = append(muts, m)
+	}
+	// No deadline, so that only the retry limit ends the retries.
+	var stats BulkStats
+	errs, err := tbl.ApplyBulk(context.Background(), []string{"a", "b"}, muts, GetBulkStats(&stats))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0] != nil || grpc.Code(errs[1]) != codes.Unavailable {
+		t.Errorf("got errors %v, want [nil, Unavailable]", errs)
+	}
+	if want := (BulkStats{Attempts: 3, Retries: []int{0, 2}}); !reflect.DeepEqual(stats, want) {
+		t.Errorf("got stats %+v, want %+v", stats, want)
+	}
+}
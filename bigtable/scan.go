@@ -0,0 +1,144 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// RangesFromSamples splits a table into at most n contiguous RowRanges
+// of approximately equal size, using samples returned by SampleRowKeys.
+// The ranges cover the whole table, and are in ascending order.
+// Fewer than n ranges are returned if there are too few samples.
+func RangesFromSamples(samples []RowKeySample, n int) []RowRange {
+	if n < 1 {
+		n = 1
+	}
+	var total int64
+	for _, s := range samples {
+		if s.OffsetBytes > total {
+			total = s.OffsetBytes
+		}
+	}
+
+	// Choose the split keys: the first sample at or after each
+	// multiple of total/n.
+	var splits []string
+	i := 0
+	for k := 1; k < n; k++ {
+		target := total * int64(k) / int64(n)
+		for i < len(samples) && (samples[i].OffsetBytes < target || samples[i].Key == "") {
+			i++
+		}
+		if i == len(samples) {
+			break
+		}
+		if key := samples[i].Key; len(splits) == 0 || key > splits[len(splits)-1] {
+			splits = append(splits, key)
+		}
+	}
+
+	ranges := make([]RowRange, 0, len(splits)+1)
+	start := ""
+	for _, key := range splits {
+		if key == start {
+			continue
+		}
+		ranges = append(ranges, NewRange(start, key))
+		start = key
+	}
+	return append(ranges, InfiniteRange(start))
+}
+
+// ScanParallel reads every row of the table by splitting it into at most n
+// ranges with SampleRowKeys and RangesFromSamples, and reading the ranges
+// with ReadRows, with at most parallelism reads at once.
+//
+// f is called for each row, as with ReadRows, but calls for rows in different
+// ranges may be concurrent and in any order. If f returns false, all reads
+// are stopped and ScanParallel returns. If a read fails, the other reads
+// are stopped, and the first error is returned.
+func (t *Table) ScanParallel(ctx context.Context, n, parallelism int, f func(Row) bool, opts ...ReadOption) error {
+	samples, err := t.SampleRowKeys(ctx)
+	if err != nil {
+		return err
+	}
+	return t.ReadRangesParallel(ctx, RangesFromSamples(samples, n), parallelism, f, opts...)
+}
+
+// ReadRangesParallel reads the given ranges with ReadRows, with at most
+// parallelism reads at once. f is called as described for ScanParallel.
+func (t *Table) ReadRangesParallel(ctx context.Context, ranges []RowRange, parallelism int, f func(Row) bool, opts ...ReadOption) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		stopped  bool // whether f returned false
+	)
+	sem := make(chan int, parallelism) // limit the number of reads happening at once
+	for _, rr := range ranges {
+		select {
+		case sem <- 1:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(rr RowRange) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := t.ReadRows(ctx, rr, func(r Row) bool {
+				if !f(r) {
+					mu.Lock()
+					stopped = true
+					mu.Unlock()
+					cancel()
+					return false
+				}
+				return true
+			}, opts...)
+			if err != nil && ctx.Err() == nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				mu.Unlock()
+				cancel()
+			}
+		}(rr)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if firstErr == nil && !stopped {
+		// Reads may have been stopped because the caller's context is done.
+		return parent.Err()
+	}
+	return firstErr
+}
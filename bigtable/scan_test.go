@@ -0,0 +1,146 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigtable/bttest"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+)
+
+func TestRangesFromSamples(t *testing.T) {
+	samples := []RowKeySample{
+		{Key: "b", OffsetBytes: 10},
+		{Key: "c", OffsetBytes: 20},
+		{Key: "d", OffsetBytes: 30},
+		{Key: "e", OffsetBytes: 40},
+		{Key: "", OffsetBytes: 50},
+	}
+	for _, test := range []struct {
+		n    int
+		want []RowRange
+	}{
+		{1, []RowRange{InfiniteRange("")}},
+		{2, []RowRange{NewRange("", "d"), InfiniteRange("d")}},
+		{5, []RowRange{NewRange("", "b"), NewRange("b", "c"), NewRange("c", "d"), NewRange("d", "e"), InfiniteRange("e")}},
+		{10, []RowRange{NewRange("", "b"), NewRange("b", "c"), NewRange("c", "d"), NewRange("d", "e"), InfiniteRange("e")}},
+	} {
+		if got := RangesFromSamples(samples, test.n); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("RangesFromSamples(%d) = %v, want %v", test.n, got, test.want)
+		}
+	}
+	if got, want := RangesFromSamples(nil, 3), []RowRange{InfiniteRange("")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("RangesFromSamples(nil, 3) = %v, want %v", got, want)
+	}
+}
+
+// setupTestTable starts a bttest.Server, and returns a table in it named "t"
+// with a column family named "fam", and a function to clean up.
+func setupTestTable(ctx context.Context, t *testing.T) (*Table, func()) {
+	srv, err := bttest.NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := grpc.Dial(srv.Addr, grpc.WithInsecure())
+	if err != nil {
+		t.Fatal(err)
+	}
+	adminClient, err := NewAdminClient(ctx, "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := NewClient(ctx, "proj", "instance", option.WithGRPCConn(conn))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := adminClient.CreateTable(ctx, "t"); err != nil {
+		t.Fatal(err)
+	}
+	if err := adminClient.CreateColumnFamily(ctx, "t", "fam"); err != nil {
+		t.Fatal(err)
+	}
+	return client.Open("t"), func() {
+		adminClient.Close()
+		client.Close()
+		srv.Close()
+	}
+}
+
+func TestScanParallel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	tbl, cleanup := setupTestTable(ctx, t)
+	defer cleanup()
+
+	const numRows = 200
+	var keys []string
+	var muts []*Mutation
+	for i := 0; i < numRows; i++ {
+		m := NewMutation()
+		m.Set("fam", "col", 1000, []byte("value"))
+		keys = append(keys, fmt.Sprintf("row%03d", i))
+		muts = append(muts, m)
+	}
+	if errs, err := tbl.ApplyBulk(ctx, keys, muts); err != nil || errs != nil {
+		t.Fatalf("ApplyBulk: %v, %v", err, errs)
+	}
+
+	samples, err := tbl.SampleRowKeys(ctx)
+	if err != nil {
+		t.Fatalf("SampleRowKeys: %v", err)
+	}
+	if len(samples) < 2 || samples[len(samples)-1].Key != "" {
+		t.Fatalf("SampleRowKeys returned %+v; want several samples, ending with an empty key", samples)
+	}
+	if got := len(RangesFromSamples(samples, 4)); got != 4 {
+		t.Errorf("RangesFromSamples(samples, 4) returned %d ranges, want 4", got)
+	}
+
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	err = tbl.ScanParallel(ctx, 4, 2, func(r Row) bool {
+		mu.Lock()
+		seen[r.Key()]++
+		mu.Unlock()
+		return true
+	})
+	if err != nil {
+		t.Fatalf("ScanParallel: %v", err)
+	}
+	if len(seen) != numRows {
+		t.Errorf("ScanParallel read %d distinct rows, want %d", len(seen), numRows)
+	}
+	for key, n := range seen {
+		if n != 1 {
+			t.Errorf("ScanParallel read row %q %d times, want 1", key, n)
+		}
+	}
+
+	// Stopping early returns no error.
+	err = tbl.ScanParallel(ctx, 4, 2, func(r Row) bool { return false })
+	if err != nil {
+		t.Errorf("ScanParallel stopped early: %v", err)
+	}
+}
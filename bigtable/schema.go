@@ -0,0 +1,248 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/net/context"
+	bttdpb "google.golang.org/genproto/googleapis/bigtable/admin/v2"
+)
+
+// A Schema describes the desired tables of an instance. It maps each
+// table name to the table's column families, and each family name to
+// the family's GC policy. A nil GCPolicy is the same as NoGCPolicy().
+//
+// Tables of the instance that are not in the schema are left alone.
+type Schema map[string]map[string]GCPolicy
+
+// SchemaChangeKind is the kind of a SchemaChange.
+type SchemaChangeKind int
+
+const (
+	// CreateTableChange creates a table.
+	CreateTableChange SchemaChangeKind = iota
+	// CreateFamilyChange creates a column family with the policy New.
+	CreateFamilyChange
+	// SetGCPolicyChange changes the GC policy of a column family from Old to New.
+	SetGCPolicyChange
+	// DeleteFamilyChange deletes a column family and all its data.
+	DeleteFamilyChange
+)
+
+// A SchemaChange is one step in bringing an instance's tables in line with a Schema.
+type SchemaChange struct {
+	Kind          SchemaChangeKind
+	Table, Family string
+	Old, New      GCPolicy
+}
+
+func (c SchemaChange) String() string {
+	switch c.Kind {
+	case CreateTableChange:
+		return fmt.Sprintf("create table %s", c.Table)
+	case CreateFamilyChange:
+		return fmt.Sprintf("create family %s:%s with GC policy %s", c.Table, c.Family, policyString(c.New))
+	case SetGCPolicyChange:
+		return fmt.Sprintf("change GC policy of %s:%s from %s to %s", c.Table, c.Family, policyString(c.Old), policyString(c.New))
+	case DeleteFamilyChange:
+		return fmt.Sprintf("delete family %s:%s", c.Table, c.Family)
+	}
+	return fmt.Sprintf("unknown change %d", int(c.Kind))
+}
+
+func policyString(p GCPolicy) string {
+	if s := p.String(); s != "" {
+		return s
+	}
+	return "none"
+}
+
+// A SchemaOption is an option for DiffSchema.
+type SchemaOption interface {
+	set(*schemaSettings)
+}
+
+type schemaSettings struct {
+	pruneFamilies bool
+}
+
+type schemaOptionFunc func(*schemaSettings)
+
+func (f schemaOptionFunc) set(s *schemaSettings) { f(s) }
+
+// PruneFamilies returns a SchemaOption that makes DiffSchema delete the column
+// families of the schema's tables that the schema does not mention.
+// Without it, such families are left alone.
+func PruneFamilies() SchemaOption {
+	return schemaOptionFunc(func(s *schemaSettings) { s.pruneFamilies = true })
+}
+
+// DiffSchema compares the instance's tables with the schema, and returns
+// the changes that ApplySchema would make to bring them in line with it.
+// The changes are ordered by table and family.
+func (ac *AdminClient) DiffSchema(ctx context.Context, schema Schema, opts ...SchemaOption) ([]SchemaChange, error) {
+	var settings schemaSettings
+	for _, o := range opts {
+		o.set(&settings)
+	}
+
+	tables, err := ac.Tables(ctx)
+	if err != nil {
+		return nil, err
+	}
+	exists := make(map[string]bool)
+	for _, t := range tables {
+		exists[t] = true
+	}
+
+	var names []string
+	for t := range schema {
+		names = append(names, t)
+	}
+	sort.Strings(names)
+
+	var changes []SchemaChange
+	for _, table := range names {
+		want := schema[table]
+		have := make(map[string]GCPolicy)
+		if exists[table] {
+			ti, err := ac.TableInfo(ctx, table)
+			if err != nil {
+				return nil, err
+			}
+			for _, fi := range ti.FamilyInfos {
+				have[fi.Name] = fi.GCPolicy
+			}
+		} else {
+			changes = append(changes, SchemaChange{Kind: CreateTableChange, Table: table})
+		}
+
+		var fams []string
+		for fam := range want {
+			fams = append(fams, fam)
+		}
+		for fam := range have {
+			if _, ok := want[fam]; !ok {
+				fams = append(fams, fam)
+			}
+		}
+		sort.Strings(fams)
+		for _, fam := range fams {
+			wp, wok := want[fam]
+			hp, hok := have[fam]
+			if wp == nil {
+				wp = NoGCPolicy()
+			}
+			switch {
+			case !hok:
+				changes = append(changes, SchemaChange{Kind: CreateFamilyChange, Table: table, Family: fam, New: wp})
+			case !wok:
+				if settings.pruneFamilies {
+					changes = append(changes, SchemaChange{Kind: DeleteFamilyChange, Table: table, Family: fam, Old: hp})
+				}
+			case !equalGCPolicies(wp, hp):
+				changes = append(changes, SchemaChange{Kind: SetGCPolicyChange, Table: table, Family: fam, Old: hp, New: wp})
+			}
+		}
+	}
+	return changes, nil
+}
+
+// ApplySchema makes the given changes, which are usually the result of DiffSchema,
+// in order. It stops at the first change that fails.
+func (ac *AdminClient) ApplySchema(ctx context.Context, changes []SchemaChange) error {
+	for _, c := range changes {
+		var err error
+		switch c.Kind {
+		case CreateTableChange:
+			err = ac.CreateTable(ctx, c.Table)
+		case CreateFamilyChange:
+			err = ac.CreateColumnFamily(ctx, c.Table, c.Family)
+			if err == nil && !isNoGCPolicy(c.New) {
+				err = ac.SetGCPolicy(ctx, c.Table, c.Family, c.New)
+			}
+		case SetGCPolicyChange:
+			p := c.New
+			if p == nil {
+				p = NoGCPolicy()
+			}
+			err = ac.SetGCPolicy(ctx, c.Table, c.Family, p)
+		case DeleteFamilyChange:
+			err = ac.DeleteColumnFamily(ctx, c.Table, c.Family)
+		default:
+			err = fmt.Errorf("unknown schema change kind %d", int(c.Kind))
+		}
+		if err != nil {
+			return fmt.Errorf("%v: %v", c, err)
+		}
+	}
+	return nil
+}
+
+// equalGCPolicies reports whether a and b are the same GC policy. The members
+// of unions and intersections may be in any order.
+func equalGCPolicies(a, b GCPolicy) bool {
+	return proto.Equal(normalizeGCRule(a.proto()), normalizeGCRule(b.proto()))
+}
+
+// isNoGCPolicy reports whether p is nil or a policy that never applies.
+func isNoGCPolicy(p GCPolicy) bool {
+	return p == nil || proto.Equal(p.proto(), NoGCPolicy().proto())
+}
+
+// normalizeGCRule returns a copy of rule with the members of every union and
+// intersection sorted, so that equal rules compare equal with proto.Equal.
+func normalizeGCRule(rule *bttdpb.GcRule) *bttdpb.GcRule {
+	switch r := rule.Rule.(type) {
+	case *bttdpb.GcRule_Intersection_:
+		return &bttdpb.GcRule{Rule: &bttdpb.GcRule_Intersection_{
+			Intersection: &bttdpb.GcRule_Intersection{Rules: normalizeGCRules(r.Intersection.Rules)},
+		}}
+	case *bttdpb.GcRule_Union_:
+		return &bttdpb.GcRule{Rule: &bttdpb.GcRule_Union_{
+			Union: &bttdpb.GcRule_Union{Rules: normalizeGCRules(r.Union.Rules)},
+		}}
+	}
+	return rule
+}
+
+func normalizeGCRules(rules []*bttdpb.GcRule) []*bttdpb.GcRule {
+	var bt byText
+	for _, r := range rules {
+		nr := normalizeGCRule(r)
+		bt.rules = append(bt.rules, nr)
+		bt.texts = append(bt.texts, proto.CompactTextString(nr))
+	}
+	sort.Sort(bt)
+	return bt.rules
+}
+
+// byText sorts GC rules by their text form.
+type byText struct {
+	rules []*bttdpb.GcRule
+	texts []string
+}
+
+func (b byText) Len() int           { return len(b.rules) }
+func (b byText) Less(i, j int) bool { return b.texts[i] < b.texts[j] }
+func (b byText) Swap(i, j int) {
+	b.rules[i], b.rules[j] = b.rules[j], b.rules[i]
+	b.texts[i], b.texts[j] = b.texts[j], b.texts[i]
+}
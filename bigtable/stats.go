@@ -0,0 +1,206 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigtable/internal/stat"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// CallStats describes a completed call of a Table method.
+type CallStats struct {
+	Method string // name of the Table method, e.g. "ReadRows"
+	Table  string
+
+	Start   time.Time
+	Latency time.Duration
+
+	// Code is the status code of the error returned by the call,
+	// or codes.OK if the call succeeded.
+	Code codes.Code
+
+	// Attempts is the number of RPCs made, including retries.
+	Attempts int
+
+	RowsRead    int64 // rows returned to the caller
+	CellsRead   int64 // cells in the rows returned to the caller
+	BytesRead   int64 // total size of the values of the cells read
+	RowsWritten int64 // rows successfully mutated
+}
+
+// A StatsHandler is called after each call of a Table method.
+// See Client.SetStatsHandler.
+type StatsHandler interface {
+	// HandleCall is passed the stats for a call, which it must not retain.
+	// It may be called concurrently.
+	HandleCall(ctx context.Context, s *CallStats)
+}
+
+// SetStatsHandler arranges for h to be called after each call of a method
+// of the Client's Tables. It must be called before the Client is used.
+// A nil handler turns off stats collection.
+func (c *Client) SetStatsHandler(h StatsHandler) {
+	c.stats = h
+}
+
+// startCall returns the stats for a new call of the named method,
+// or nil if stats are not being collected.
+func (t *Table) startCall(method string) *CallStats {
+	if t.c.stats == nil {
+		return nil
+	}
+	return &CallStats{Method: method, Table: t.table, Start: time.Now()}
+}
+
+// endCall completes cs with the result of the call, and passes it to the stats handler.
+func (t *Table) endCall(ctx context.Context, cs *CallStats, err error) {
+	if cs == nil {
+		return
+	}
+	cs.Latency = time.Since(cs.Start)
+	cs.Code = grpc.Code(err)
+	t.c.stats.HandleCall(ctx, cs)
+}
+
+// The methods below may be called on a nil *CallStats.
+
+func (cs *CallStats) attempt() {
+	if cs != nil {
+		cs.Attempts++
+	}
+}
+
+func (cs *CallStats) addRow(r Row) {
+	if cs == nil {
+		return
+	}
+	cs.RowsRead++
+	for _, ris := range r {
+		cs.CellsRead += int64(len(ris))
+		for _, ri := range ris {
+			cs.BytesRead += int64(len(ri.Value))
+		}
+	}
+}
+
+func (cs *CallStats) addWritten(n int) {
+	if cs != nil {
+		cs.RowsWritten += int64(n)
+	}
+}
+
+// A StatsRecorder is a StatsHandler that keeps statistics for each method in memory.
+type StatsRecorder struct {
+	mu      sync.Mutex
+	methods map[string]*methodStats
+}
+
+type methodStats struct {
+	calls, attempts                         int64
+	rowsRead, cellsRead, bytes, rowsWritten int64
+	codes                                   map[codes.Code]int64
+	latency                                 *stat.Histogram
+}
+
+// NewStatsRecorder returns an empty StatsRecorder.
+func NewStatsRecorder() *StatsRecorder {
+	return &StatsRecorder{methods: make(map[string]*methodStats)}
+}
+
+// HandleCall implements StatsHandler.
+func (r *StatsRecorder) HandleCall(ctx context.Context, s *CallStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ms, ok := r.methods[s.Method]
+	if !ok {
+		ms = &methodStats{codes: make(map[codes.Code]int64), latency: stat.NewHistogram(s.Method)}
+		r.methods[s.Method] = ms
+	}
+	ms.calls++
+	ms.attempts += int64(s.Attempts)
+	ms.rowsRead += s.RowsRead
+	ms.cellsRead += s.CellsRead
+	ms.bytes += s.BytesRead
+	ms.rowsWritten += s.RowsWritten
+	ms.codes[s.Code]++
+	ms.latency.Record(s.Latency)
+}
+
+// WriteCSV writes the recorded statistics to w in csv format,
+// with a header row and one row per method.
+// The codes column lists the number of calls that ended with each status code.
+func (r *StatsRecorder) WriteCSV(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var names []string
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	cw := csv.NewWriter(w)
+	err := cw.Write([]string{"method", "calls", "errors", "attempts", "rows_read", "cells_read", "bytes_read", "rows_written",
+		"min", "median", "max", "p75", "p90", "p95", "p99", "codes"})
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		ms := r.methods[name]
+		errors := ms.calls - ms.codes[codes.OK]
+		agg := ms.latency.Aggregate(int(errors))
+		err := cw.Write([]string{
+			name,
+			strconv.FormatInt(ms.calls, 10), strconv.FormatInt(errors, 10), strconv.FormatInt(ms.attempts, 10),
+			strconv.FormatInt(ms.rowsRead, 10), strconv.FormatInt(ms.cellsRead, 10),
+			strconv.FormatInt(ms.bytes, 10), strconv.FormatInt(ms.rowsWritten, 10),
+			agg.Min.String(), agg.Median.String(), agg.Max.String(),
+			agg.P75.String(), agg.P90.String(), agg.P95.String(), agg.P99.String(),
+			formatCodes(ms.codes),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatCodes formats code counts like "OK=10 Unavailable=2", ordered by code.
+func formatCodes(counts map[codes.Code]int64) string {
+	var cs []int
+	for c := range counts {
+		cs = append(cs, int(c))
+	}
+	sort.Ints(cs)
+	var ss []string
+	for _, c := range cs {
+		ss = append(ss, fmt.Sprintf("%v=%d", codes.Code(c), counts[codes.Code(c)]))
+	}
+	return strings.Join(ss, " ")
+}
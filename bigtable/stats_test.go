@@ -0,0 +1,134 @@
+/*
+Copyright 2016 Google Inc. All Rights Reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bigtable
+
+import (
+	"bytes"
+	"encoding/csv"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+)
+
+type statsCollector struct {
+	mu    sync.Mutex
+	calls []CallStats
+}
+
+func (c *statsCollector) HandleCall(ctx context.Context, s *CallStats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, *s)
+}
+
+func TestStatsHandler(t *testing.T) {
+	ctx := context.Background()
+	tbl, cleanup := setupTestTable(ctx, t)
+	defer cleanup()
+
+	coll := &statsCollector{}
+	tbl.c.SetStatsHandler(coll)
+
+	mut := NewMutation()
+	mut.Set("fam", "col", 1000, []byte("value"))
+	if err := tbl.Apply(ctx, "a", mut); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tbl.ApplyBulk(ctx, []string{"b", "c"}, []*Mutation{mut, mut}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.ReadRows(ctx, InfiniteRange(""), func(Row) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tbl.ReadRow(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	bad := NewMutation()
+	bad.Set("nosuchfam", "col", 1000, []byte("value"))
+	if err := tbl.Apply(ctx, "d", bad); err == nil {
+		t.Fatal("Apply to unknown family: got nil, want error")
+	}
+	// A conditional mutation writes the row only if the branch that ran
+	// has mutations. Row "a" exists, so the condition matches.
+	if err := tbl.Apply(ctx, "a", NewCondMutation(RowKeyFilter("a"), nil, mut)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tbl.Apply(ctx, "a", NewCondMutation(RowKeyFilter("a"), mut, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []CallStats{
+		{Method: "Apply", Code: codes.OK, Attempts: 1, RowsWritten: 1},
+		{Method: "ApplyBulk", Code: codes.OK, Attempts: 1, RowsWritten: 2},
+		{Method: "ReadRows", Code: codes.OK, Attempts: 1, RowsRead: 3, CellsRead: 3, BytesRead: 15},
+		{Method: "ReadRow", Code: codes.OK, Attempts: 1, RowsRead: 1, CellsRead: 1, BytesRead: 5},
+		{Method: "Apply", Code: codes.Unknown, Attempts: 1},
+		{Method: "Apply", Code: codes.OK, Attempts: 1},
+		{Method: "Apply", Code: codes.OK, Attempts: 1, RowsWritten: 1},
+	}
+	if len(coll.calls) != len(want) {
+		t.Fatalf("got %d calls, want %d", len(coll.calls), len(want))
+	}
+	for i, got := range coll.calls {
+		if got.Table != "t" {
+			t.Errorf("call %d: table = %q, want %q", i, got.Table, "t")
+		}
+		if got.Start.IsZero() || got.Latency <= 0 {
+			t.Errorf("call %d: start %v, latency %v not set", i, got.Start, got.Latency)
+		}
+		got.Table, got.Start, got.Latency = "", want[i].Start, 0
+		if got != want[i] {
+			t.Errorf("call %d:\ngot  %+v\nwant %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestStatsRecorder(t *testing.T) {
+	ctx := context.Background()
+	r := NewStatsRecorder()
+	r.HandleCall(ctx, &CallStats{Method: "ReadRows", Code: codes.OK, Attempts: 1, RowsRead: 2, CellsRead: 4, BytesRead: 8})
+	r.HandleCall(ctx, &CallStats{Method: "ReadRows", Code: codes.Unavailable, Attempts: 3})
+	r.HandleCall(ctx, &CallStats{Method: "Apply", Code: codes.OK, Attempts: 1, RowsWritten: 1})
+
+	var buf bytes.Buffer
+	if err := r.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	recs, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 3 {
+		t.Fatalf("got %d records, want 3", len(recs))
+	}
+	// Compare all but the latency columns.
+	for i, want := range [][]string{
+		{"Apply", "1", "0", "1", "0", "0", "0", "1", "OK=1"},
+		{"ReadRows", "2", "1", "4", "2", "4", "8", "0", "OK=1 Unavailable=1"},
+	} {
+		rec := recs[i+1]
+		got := append(append([]string{}, rec[:8]...), rec[len(rec)-1])
+		for j := range want {
+			if got[j] != want[j] {
+				t.Errorf("record %d: got %q, want %q", i+1, got, want)
+				break
+			}
+		}
+	}
+}
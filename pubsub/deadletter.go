@@ -0,0 +1,174 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"strconv"
+	"time"
+)
+
+// DeliveryAttemptsAttribute is the attribute that records, on a message
+// published to a dead-letter topic, how many times the message was delivered
+// before it was dead-lettered.
+const DeliveryAttemptsAttribute = "pubsub-delivery-attempts"
+
+// DeadLetterPolicy describes how messages that repeatedly fail to be
+// processed are removed from a subscription.
+//
+// Delivery attempts are counted by the Iterator (or call to Receive) that
+// receives the messages, keyed by message ID. A message is dead-lettered once
+// it has been delivered MaxDeliveryAttempts times without being acknowledged:
+// either when Done(false) is called on its last allowed delivery, or when it
+// is redelivered after its deadline expired. Dead-lettering a message
+// publishes a copy of it, with its original data and attributes plus
+// DeliveryAttemptsAttribute, to Topic, and then acknowledges the original.
+// If publishing fails, the message is nacked, and dead-lettering is
+// attempted again when it is next received.
+//
+// The count for a message is forgotten once it has not been delivered for
+// longer than the maximum time for which its deadline is extended (see
+// MaxExtension) plus twice the subscription's ack deadline, since it has
+// then most likely been acknowledged by another subscriber.
+type DeadLetterPolicy struct {
+	// Topic is the topic to which dead-lettered messages are published.
+	Topic *Topic
+
+	// MaxDeliveryAttempts is the number of deliveries after which a message
+	// is dead-lettered. Values less than 1 are treated as 1.
+	MaxDeliveryAttempts int
+
+	// OnDeadLetter, if non-nil, is called each time the policy is applied to
+	// a message. attempts is the number of times the message was delivered,
+	// and err is the error from publishing it to Topic, if any.
+	// OnDeadLetter may be called concurrently from multiple goroutines.
+	OnDeadLetter func(m *Message, attempts int, err error)
+}
+
+type deadLetter DeadLetterPolicy
+
+func (dl deadLetter) setOptions(o *pullOptions) {
+	if dl.Topic == nil {
+		o.deadLetter = nil
+		return
+	}
+	p := DeadLetterPolicy(dl)
+	if p.MaxDeliveryAttempts < 1 {
+		p.MaxDeliveryAttempts = 1
+	}
+	o.deadLetter = &p
+}
+
+// DeadLetter returns a PullOption that applies policy to the messages
+// received from a subscription. A policy with a nil Topic turns off
+// dead-lettering, which is the default.
+func DeadLetter(policy DeadLetterPolicy) PullOption {
+	return deadLetter(policy)
+}
+
+// deliveryAttempts records the deliveries of a message.
+type deliveryAttempts struct {
+	n    int
+	last time.Time
+}
+
+// deliver records a delivery of m by Next, and reports whether m should
+// be returned to the caller. If m has already used up its delivery attempts,
+// it is dead-lettered instead.
+func (it *Iterator) deliver(m *Message) bool {
+	if it.deadLetter == nil {
+		return true
+	}
+	it.attemptsMu.Lock()
+	now := it.now()
+	it.sweepAttempts(now)
+	n := it.attempts[m.ID].n
+	if n < it.deadLetter.MaxDeliveryAttempts {
+		it.attempts[m.ID] = deliveryAttempts{n: n + 1, last: now}
+	}
+	it.attemptsMu.Unlock()
+
+	if n >= it.deadLetter.MaxDeliveryAttempts {
+		it.publishDeadLetter(m, n)
+		return false
+	}
+	return true
+}
+
+// nack handles Done(false) on m, dead-lettering it if it has used up its
+// delivery attempts.
+func (it *Iterator) nack(m *Message) {
+	if it.deadLetter != nil {
+		it.attemptsMu.Lock()
+		n := it.attempts[m.ID].n
+		it.attemptsMu.Unlock()
+		if n >= it.deadLetter.MaxDeliveryAttempts {
+			it.publishDeadLetter(m, n)
+			return
+		}
+	}
+	it.ka.Remove(m.AckID)
+}
+
+// forget stops counting the delivery attempts of the message with the given ID.
+func (it *Iterator) forget(id string) {
+	if it.deadLetter == nil {
+		return
+	}
+	it.attemptsMu.Lock()
+	delete(it.attempts, id)
+	it.attemptsMu.Unlock()
+}
+
+// sweepAttempts evicts the entries of it.attempts that have not been
+// delivered within it.attemptsTTL, so that messages which are nacked or
+// expire and are then never redelivered to this iterator are not remembered
+// forever. To keep the cost low, it does so at most once per it.attemptsTTL.
+// it.attemptsMu must be held.
+func (it *Iterator) sweepAttempts(now time.Time) {
+	if now.Sub(it.lastSweep) < it.attemptsTTL {
+		return
+	}
+	it.lastSweep = now
+	for id, a := range it.attempts {
+		if now.Sub(a.last) >= it.attemptsTTL {
+			delete(it.attempts, id)
+		}
+	}
+}
+
+// publishDeadLetter publishes m to the dead-letter topic in the background,
+// then acks it, or nacks it if publishing fails. m's deadline continues to
+// be extended in the meantime, so Stop waits for this to finish.
+func (it *Iterator) publishDeadLetter(m *Message, attempts int) {
+	attrs := make(map[string]string, len(m.Attributes)+1)
+	for k, v := range m.Attributes {
+		attrs[k] = v
+	}
+	attrs[DeliveryAttemptsAttribute] = strconv.Itoa(attempts)
+	dl := &Message{Data: m.Data, Attributes: attrs, OrderingKey: m.OrderingKey}
+
+	go func() {
+		_, err := it.deadLetter.Topic.Publish(it.ctx, dl)
+		if it.deadLetter.OnDeadLetter != nil {
+			it.deadLetter.OnDeadLetter(m, attempts, err)
+		}
+		if err != nil {
+			it.ka.Remove(m.AckID)
+			return
+		}
+		it.forget(m.ID)
+		it.acker.Ack(m.AckID)
+	}()
+}
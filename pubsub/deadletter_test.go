@@ -0,0 +1,241 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// redeliveryService delivers one message over and over, with a new ack ID
+// each time, until it is acked or has been delivered maxDeliveries times.
+type redeliveryService struct {
+	service
+	publishErr    error
+	maxDeliveries int // if 0, unlimited
+
+	mu         sync.Mutex
+	deliveries int
+	acked      []string
+	published  []*Message
+}
+
+func (s *redeliveryService) fetchMessages(ctx context.Context, subName string, maxMessages int64) ([]*Message, error) {
+	s.mu.Lock()
+	done := len(s.acked) > 0 || (s.maxDeliveries > 0 && s.deliveries == s.maxDeliveries)
+	if !done {
+		s.deliveries++
+	}
+	n := s.deliveries
+	s.mu.Unlock()
+	if done {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return []*Message{{
+		ID:          "m1",
+		AckID:       fmt.Sprintf("a%d", n),
+		Data:        []byte("poison"),
+		Attributes:  map[string]string{"k": "v"},
+		OrderingKey: "key",
+	}}, nil
+}
+
+func (s *redeliveryService) acknowledge(ctx context.Context, subName string, ackIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, ackIDs...)
+	return nil
+}
+
+func (s *redeliveryService) publishMessages(ctx context.Context, topicName string, msgs []*Message) ([]string, error) {
+	if s.publishErr != nil {
+		return nil, s.publishErr
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.published = append(s.published, msgs...)
+	return []string{"dl1"}, nil
+}
+
+func (s *redeliveryService) modifyAckDeadline(ctx context.Context, subName string, deadline time.Duration, ackIDs []string) error {
+	return nil
+}
+
+func (s *redeliveryService) splitAckIDs(ids []string) ([]string, []string) {
+	return ids, nil
+}
+
+func TestDeadLetter(t *testing.T) {
+	s := &redeliveryService{}
+	dlTopic := &Topic{s: s, name: "projects/p/topics/dead"}
+	notified := make(chan int, 1)
+	po := processPullOptions([]PullOption{DeadLetter(DeadLetterPolicy{
+		Topic:               dlTopic,
+		MaxDeliveryAttempts: 3,
+		OnDeadLetter: func(m *Message, attempts int, err error) {
+			if err != nil {
+				t.Errorf("OnDeadLetter: %v", err)
+			}
+			notified <- attempts
+		},
+	})})
+	po.ackDeadline = 10 * time.Second
+	it := newIterator(context.Background(), s, "subname", po)
+
+	for i := 0; i < 3; i++ {
+		m, err := it.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Done(false)
+	}
+	if got := <-notified; got != 3 {
+		t.Errorf("attempts: got %d, want 3", got)
+	}
+	it.Stop()
+
+	if !reflect.DeepEqual(s.acked, []string{"a3"}) {
+		t.Errorf("acked: got %v, want [a3]", s.acked)
+	}
+	if len(s.published) != 1 {
+		t.Fatalf("published %d messages to the dead-letter topic, want 1", len(s.published))
+	}
+	got := s.published[0]
+	wantAttrs := map[string]string{"k": "v", DeliveryAttemptsAttribute: "3"}
+	if string(got.Data) != "poison" || !reflect.DeepEqual(got.Attributes, wantAttrs) {
+		t.Errorf("dead-lettered message: got %q %v, want %q %v", got.Data, got.Attributes, "poison", wantAttrs)
+	}
+	if got.OrderingKey != "key" {
+		t.Errorf("dead-lettered message: got ordering key %q, want %q", got.OrderingKey, "key")
+	}
+}
+
+func TestDeadLetterOnRedelivery(t *testing.T) {
+	// A message whose deadline expires after its last attempt is
+	// dead-lettered when it is redelivered, without being returned.
+	s := &redeliveryService{maxDeliveries: 2}
+	notified := make(chan int, 1)
+	po := processPullOptions([]PullOption{DeadLetter(DeadLetterPolicy{
+		Topic:               &Topic{s: s, name: "projects/p/topics/dead"},
+		MaxDeliveryAttempts: 1,
+		OnDeadLetter:        func(m *Message, attempts int, err error) { notified <- attempts },
+	})})
+	po.ackDeadline = 10 * time.Second
+	it := newIterator(context.Background(), s, "subname", po)
+
+	m, err := it.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Without calling Done on m, act as if its deadline had expired.
+	// The redelivery is dead-lettered, so Next keeps waiting.
+	next := make(chan error)
+	go func() {
+		_, err := it.Next()
+		next <- err
+	}()
+	if got := <-notified; got != 1 {
+		t.Errorf("attempts: got %d, want 1", got)
+	}
+	m.Done(true)
+	it.Stop()
+	if err := <-next; err != Done {
+		t.Errorf("Next: got %v, want %v", err, Done)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Strings(s.acked)
+	if !reflect.DeepEqual(s.acked, []string{"a1", "a2"}) {
+		t.Errorf("acked: got %v, want [a1 a2]", s.acked)
+	}
+	if len(s.published) != 1 {
+		t.Errorf("published %d messages to the dead-letter topic, want 1", len(s.published))
+	}
+}
+
+func TestDeadLetterPublishError(t *testing.T) {
+	s := &redeliveryService{publishErr: errors.New("bang")}
+	var (
+		mu       sync.Mutex
+		failures int
+	)
+	po := processPullOptions([]PullOption{DeadLetter(DeadLetterPolicy{
+		Topic:               &Topic{s: s, name: "projects/p/topics/dead"},
+		MaxDeliveryAttempts: 1,
+		OnDeadLetter: func(m *Message, attempts int, err error) {
+			mu.Lock()
+			failures++
+			mu.Unlock()
+		},
+	})})
+	po.ackDeadline = 10 * time.Second
+	it := newIterator(context.Background(), s, "subname", po)
+	m, err := it.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Done(false)
+	it.Stop()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if failures != 1 {
+		t.Errorf("got %d failures, want 1", failures)
+	}
+	if len(s.acked) != 0 {
+		t.Errorf("acked %v after failing to dead-letter", s.acked)
+	}
+}
+
+func TestDeliveryAttemptsEviction(t *testing.T) {
+	now := time.Unix(1000, 0)
+	it := &Iterator{
+		deadLetter:  &DeadLetterPolicy{MaxDeliveryAttempts: 5},
+		attempts:    make(map[string]deliveryAttempts),
+		attemptsTTL: time.Minute,
+		lastSweep:   now,
+		now:         func() time.Time { return now },
+	}
+	deliver := func(id string) {
+		if !it.deliver(&Message{ID: id}) {
+			t.Fatalf("message %s was dead-lettered", id)
+		}
+	}
+	deliver("old")
+	deliver("old")
+	now = now.Add(30 * time.Second)
+	deliver("recent")
+	now = now.Add(45 * time.Second)
+	// This delivery sweeps "old", which has not been delivered for 75s,
+	// but not "recent".
+	deliver("new")
+	want := map[string]int{"recent": 1, "new": 1}
+	got := map[string]int{}
+	for id, a := range it.attempts {
+		got[id] = a.n
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got attempts %v, want %v", got, want)
+	}
+}
@@ -36,6 +36,26 @@ Messages may then be published to a topic:
 	Data: []byte("payload"),
  })
 
+Publish sends its messages in a single RPC. PublishAsync instead bundles
+messages in the background, returning a result for each message:
+
+ res := topic.PublishAsync(ctx, &pubsub.Message{Data: []byte("payload")})
+ ...
+ msgID, err := res.Get(ctx)
+
+Bundling is configured with Topic.PublishSettings. Topic.Stop must be called
+to send any messages that are still buffered.
+
+Messages with the same non-empty Message.OrderingKey that are passed to
+PublishAsync are published in order. The Pub/Sub API has no field for the key,
+so this package sends it in the attribute named by OrderingKeyAttribute
+("pubsub-ordering-key") and removes that attribute from received messages.
+Only this package understands the convention: clients in other languages see
+the key as an ordinary attribute, and they neither set it nor receive messages
+in order. Because the attribute is reserved, messages that set it directly in
+Attributes, as programs written before OrderingKey existed may do, now fail to
+publish; set OrderingKey instead.
+
 Receiving
 
 To receive messages published to a topic, clients create subscriptions
@@ -79,6 +99,26 @@ below.
 Note: It is possible for Messages to be redelivered, even if Message.Done has
 been called. Client code must be robust to multiple deliveries of messages.
 
+Alternatively, Subscription.Receive calls a function with each message from a
+pool of goroutines, limiting the number and total size of the messages that
+have not yet been Done:
+
+ err := sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+ 	log.Print("got message: ", string(msg.Data))
+ 	msg.Done(true)
+ })
+
+Receive returns once ctx is done and all the messages it delivered are Done.
+
+For a push subscription, whose PushConfig names an HTTPS endpoint, PushHandler
+returns an http.Handler that serves the endpoint. It acknowledges each message
+for which its function returns nil:
+
+ http.Handle("/push", pubsub.PushHandler(func(ctx context.Context, msg *pubsub.Message) error {
+ 	log.Print("got message: ", string(msg.Data))
+ 	return nil
+ }))
+
 Deadlines
 
 The default pubsub deadlines are suitable for most use cases, but may be
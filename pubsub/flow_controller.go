@@ -0,0 +1,87 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"sync"
+
+	"golang.org/x/net/context"
+)
+
+// flowController limits the number and total size of outstanding messages.
+type flowController struct {
+	maxCount int // If <= 0, the number of messages is not limited.
+	maxSize  int // If <= 0, the total size of messages is not limited.
+
+	mu    sync.Mutex
+	count int
+	size  int
+	// changed is closed, and replaced, whenever count or size decreases.
+	changed chan struct{}
+}
+
+func newFlowController(maxCount, maxSize int) *flowController {
+	return &flowController{
+		maxCount: maxCount,
+		maxSize:  maxSize,
+		changed:  make(chan struct{}),
+	}
+}
+
+// acquire blocks until a message of the given size can be admitted without
+// exceeding the limits, or until ctx is done.
+// A message larger than maxSize is admitted once no other messages are outstanding.
+func (f *flowController) acquire(ctx context.Context, size int) error {
+	for {
+		f.mu.Lock()
+		if f.fits(size) {
+			f.count++
+			f.size += size
+			f.mu.Unlock()
+			return nil
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release returns the capacity held by a message of the given size,
+// which must have been admitted by acquire.
+func (f *flowController) release(size int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.count--
+	f.size -= size
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// fits reports whether a message of the given size may be admitted.
+// f.mu must be held.
+func (f *flowController) fits(size int) bool {
+	if f.maxCount > 0 && f.count >= f.maxCount {
+		return false
+	}
+	if f.maxSize > 0 && f.count > 0 && f.size+size > f.maxSize {
+		return false
+	}
+	return true
+}
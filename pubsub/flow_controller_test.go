@@ -0,0 +1,82 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestFlowControllerCount(t *testing.T) {
+	ctx := context.Background()
+	fc := newFlowController(2, 0)
+	for i := 0; i < 2; i++ {
+		if err := fc.acquire(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	acquired := make(chan error)
+	go func() { acquired <- fc.acquire(ctx, 1) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than maxCount")
+	case <-time.After(50 * time.Millisecond):
+	}
+	fc.release(1)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlowControllerSize(t *testing.T) {
+	ctx := context.Background()
+	fc := newFlowController(0, 10)
+	if err := fc.acquire(ctx, 6); err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan error)
+	go func() { acquired <- fc.acquire(ctx, 6) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquired more than maxSize")
+	case <-time.After(50 * time.Millisecond):
+	}
+	fc.release(6)
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+	fc.release(6)
+
+	// A message larger than maxSize is admitted when nothing else is outstanding.
+	if err := fc.acquire(ctx, 20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFlowControllerCancel(t *testing.T) {
+	fc := newFlowController(1, 0)
+	if err := fc.acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() { acquired <- fc.acquire(ctx, 0) }()
+	cancel()
+	if err := <-acquired; err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+}
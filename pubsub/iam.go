@@ -0,0 +1,219 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"fmt"
+	"sort"
+
+	"golang.org/x/net/context"
+)
+
+// IAMRole is the name of an IAM role, such as "roles/pubsub.publisher".
+type IAMRole string
+
+const (
+	// RoleOwner, RoleEditor and RoleViewer are the primitive IAM roles.
+	RoleOwner  IAMRole = "roles/owner"
+	RoleEditor IAMRole = "roles/editor"
+	RoleViewer IAMRole = "roles/viewer"
+
+	// RoleAdmin grants full control of topics and subscriptions.
+	RoleAdmin IAMRole = "roles/pubsub.admin"
+
+	// RolePublisher grants permission to publish to a topic.
+	RolePublisher IAMRole = "roles/pubsub.publisher"
+
+	// RoleSubscriber grants permission to consume messages from a
+	// subscription, and to attach subscriptions to a topic.
+	RoleSubscriber IAMRole = "roles/pubsub.subscriber"
+)
+
+const (
+	// AllUsers is a member that denotes anyone on the internet, with or
+	// without a Google account.
+	AllUsers = "allUsers"
+
+	// AllAuthenticatedUsers is a member that denotes anyone who is signed in
+	// with a Google account.
+	AllAuthenticatedUsers = "allAuthenticatedUsers"
+)
+
+// maxIAMAttempts is the number of times AddMember and RemoveMember try to
+// update a policy that is being changed concurrently.
+const maxIAMAttempts = 5
+
+// IAMPolicy is an IAM policy: a list of bindings of members to roles.
+// Members are strings such as "user:alice@example.com",
+// "serviceAccount:app@project.iam.gserviceaccount.com", "group:team@example.com",
+// "domain:example.com", AllUsers or AllAuthenticatedUsers.
+//
+// An IAMPolicy obtained from IAMHandle.Policy records the version of the
+// policy it was read from, so that IAMHandle.SetPolicy fails if the policy
+// has changed since. The zero value is an empty policy, which SetPolicy
+// applies unconditionally.
+type IAMPolicy struct {
+	bindings map[IAMRole][]string
+	etag     string
+}
+
+// Roles returns the roles that are bound to at least one member, in sorted order.
+func (p *IAMPolicy) Roles() []IAMRole {
+	var roles []IAMRole
+	for r, members := range p.bindings {
+		if len(members) > 0 {
+			roles = append(roles, r)
+		}
+	}
+	sort.Sort(iamRoles(roles))
+	return roles
+}
+
+// Members returns the members that are bound to role r.
+func (p *IAMPolicy) Members(r IAMRole) []string {
+	return append([]string(nil), p.bindings[r]...)
+}
+
+// HasRole reports whether member is bound to role r.
+func (p *IAMPolicy) HasRole(member string, r IAMRole) bool {
+	return memberIndex(p.bindings[r], member) >= 0
+}
+
+// Add binds member to role r, if it is not already.
+func (p *IAMPolicy) Add(member string, r IAMRole) {
+	if p.HasRole(member, r) {
+		return
+	}
+	if p.bindings == nil {
+		p.bindings = make(map[IAMRole][]string)
+	}
+	p.bindings[r] = append(p.bindings[r], member)
+}
+
+// Remove unbinds member from role r, if it is bound.
+func (p *IAMPolicy) Remove(member string, r IAMRole) {
+	members := p.bindings[r]
+	i := memberIndex(members, member)
+	if i < 0 {
+		return
+	}
+	members = append(members[:i:i], members[i+1:]...)
+	if len(members) == 0 {
+		delete(p.bindings, r)
+	} else {
+		p.bindings[r] = members
+	}
+}
+
+func memberIndex(members []string, m string) int {
+	for i, mm := range members {
+		if mm == m {
+			return i
+		}
+	}
+	return -1
+}
+
+type iamRoles []IAMRole
+
+func (r iamRoles) Len() int           { return len(r) }
+func (r iamRoles) Less(i, j int) bool { return r[i] < r[j] }
+func (r iamRoles) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+
+// IAMHandle provides access to the IAM policy of a topic or subscription.
+type IAMHandle struct {
+	s        service
+	resource string
+}
+
+// IAM returns a handle for the IAM policy of the topic.
+func (t *Topic) IAM() *IAMHandle {
+	return &IAMHandle{s: t.s, resource: t.name}
+}
+
+// IAM returns a handle for the IAM policy of the subscription.
+func (s *Subscription) IAM() *IAMHandle {
+	return &IAMHandle{s: s.s, resource: s.name}
+}
+
+// Policy fetches the IAM policy.
+func (h *IAMHandle) Policy(ctx context.Context) (*IAMPolicy, error) {
+	return h.s.getIAMPolicy(ctx, h.resource)
+}
+
+// SetPolicy replaces the IAM policy with p.
+//
+// If p was obtained from Policy, SetPolicy fails if the policy has been
+// changed since; fetch the policy again, reapply the change, and retry. See
+// AddMember and RemoveMember for helpers that do this.
+func (h *IAMHandle) SetPolicy(ctx context.Context, p *IAMPolicy) error {
+	np, err := h.s.setIAMPolicy(ctx, h.resource, p)
+	if err != nil {
+		return err
+	}
+	*p = *np
+	return nil
+}
+
+// TestPermissions returns the subset of permissions, such as
+// "pubsub.topics.publish", that the caller has on the topic or subscription.
+func (h *IAMHandle) TestPermissions(ctx context.Context, permissions []string) ([]string, error) {
+	return h.s.testIAMPermissions(ctx, h.resource, permissions)
+}
+
+// AddMember binds member to role r in the IAM policy.
+// It retries if the policy is changed concurrently.
+func (h *IAMHandle) AddMember(ctx context.Context, member string, r IAMRole) error {
+	return h.update(ctx, func(p *IAMPolicy) bool {
+		if p.HasRole(member, r) {
+			return false
+		}
+		p.Add(member, r)
+		return true
+	})
+}
+
+// RemoveMember unbinds member from role r in the IAM policy.
+// It retries if the policy is changed concurrently.
+func (h *IAMHandle) RemoveMember(ctx context.Context, member string, r IAMRole) error {
+	return h.update(ctx, func(p *IAMPolicy) bool {
+		if !p.HasRole(member, r) {
+			return false
+		}
+		p.Remove(member, r)
+		return true
+	})
+}
+
+// update performs a read-modify-write of the IAM policy. f changes the
+// policy, reporting whether it did; if not, the policy is not written.
+func (h *IAMHandle) update(ctx context.Context, f func(*IAMPolicy) bool) error {
+	var err error
+	for i := 0; i < maxIAMAttempts; i++ {
+		var p *IAMPolicy
+		p, err = h.Policy(ctx)
+		if err != nil {
+			return err
+		}
+		if !f(p) {
+			return nil
+		}
+		err = h.SetPolicy(ctx, p)
+		if !isConcurrentModification(err) {
+			return err
+		}
+	}
+	return fmt.Errorf("pubsub: IAM policy of %s changed concurrently %d times: %v", h.resource, maxIAMAttempts, err)
+}
@@ -0,0 +1,161 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestIAMPolicy(t *testing.T) {
+	var p IAMPolicy
+	p.Add("user:a", RolePublisher)
+	p.Add("user:b", RolePublisher)
+	p.Add("user:a", RolePublisher)
+	p.Add("group:c", RoleAdmin)
+	if got, want := p.Roles(), []IAMRole{RoleAdmin, RolePublisher}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Roles: got %v, want %v", got, want)
+	}
+	if got, want := p.Members(RolePublisher), []string{"user:a", "user:b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Members: got %v, want %v", got, want)
+	}
+	if !p.HasRole("group:c", RoleAdmin) || p.HasRole("group:c", RolePublisher) {
+		t.Error("HasRole: wrong result")
+	}
+
+	members := p.Members(RolePublisher)
+	p.Remove("user:a", RolePublisher)
+	p.Remove("user:x", RolePublisher)
+	if got, want := p.Members(RolePublisher), []string{"user:b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Members after Remove: got %v, want %v", got, want)
+	}
+	if want := []string{"user:a", "user:b"}; !reflect.DeepEqual(members, want) {
+		t.Errorf("Remove changed the result of an earlier Members call: got %v, want %v", members, want)
+	}
+	p.Remove("group:c", RoleAdmin)
+	if got, want := p.Roles(), []IAMRole{RolePublisher}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Roles after Remove: got %v, want %v", got, want)
+	}
+}
+
+func TestIAMHandle(t *testing.T) {
+	c, rs, done := newRESTClient(t,
+		`{"etag": "BwU=", "bindings": [{"role": "roles/pubsub.publisher", "members": ["user:a"]}]}`,
+		`{"etag": "BwY=", "bindings": [{"role": "roles/pubsub.publisher", "members": ["user:a", "user:b"]}]}`,
+		`{"permissions": ["pubsub.topics.publish"]}`)
+	defer done()
+
+	ctx := context.Background()
+	h := c.Topic("t").IAM()
+	p, err := h.Policy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.Members(RolePublisher), []string{"user:a"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Policy: got members %v, want %v", got, want)
+	}
+	p.Add("user:b", RolePublisher)
+	if err := h.SetPolicy(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	if p.etag != "BwY=" {
+		t.Errorf("SetPolicy: got etag %q, want the one returned by the server", p.etag)
+	}
+	perms, err := h.TestPermissions(ctx, []string{"pubsub.topics.publish", "pubsub.topics.delete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pubsub.topics.publish"}; !reflect.DeepEqual(perms, want) {
+		t.Errorf("TestPermissions: got %v, want %v", perms, want)
+	}
+
+	want := []restCall{
+		{method: "GET", path: "/v1/projects/P/topics/t:getIamPolicy"},
+		{
+			method: "POST",
+			path:   "/v1/projects/P/topics/t:setIamPolicy",
+			body: map[string]interface{}{
+				"policy": map[string]interface{}{
+					"etag": "BwU=",
+					"bindings": []interface{}{
+						map[string]interface{}{
+							"role":    "roles/pubsub.publisher",
+							"members": []interface{}{"user:a", "user:b"},
+						},
+					},
+				},
+			},
+		},
+		{
+			method: "POST",
+			path:   "/v1/projects/P/topics/t:testIamPermissions",
+			body: map[string]interface{}{
+				"permissions": []interface{}{"pubsub.topics.publish", "pubsub.topics.delete"},
+			},
+		},
+	}
+	if !reflect.DeepEqual(rs.calls, want) {
+		t.Errorf("got calls %+v, want %+v", rs.calls, want)
+	}
+}
+
+func TestIAMAddMemberRetry(t *testing.T) {
+	c, rs, done := newRESTClient(t,
+		`{"etag": "AQ=="}`,
+		`{"error": {"code": 409, "message": "etag mismatch"}}`,
+		`{"etag": "Ag==", "bindings": [{"role": "roles/pubsub.subscriber", "members": ["user:x"]}]}`,
+		`{"etag": "Aw=="}`,
+		`{"etag": "Aw==", "bindings": [{"role": "roles/pubsub.subscriber", "members": ["user:x", "user:a"]}]}`)
+	defer done()
+
+	ctx := context.Background()
+	h := c.Subscription("s").IAM()
+	if err := h.AddMember(ctx, "user:a", RoleSubscriber); err != nil {
+		t.Fatal(err)
+	}
+	// The member is already bound, so this makes no change.
+	if err := h.AddMember(ctx, "user:a", RoleSubscriber); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, call := range rs.calls {
+		got = append(got, call.method+" "+call.path)
+	}
+	want := []string{
+		"GET /v1/projects/P/subscriptions/s:getIamPolicy",
+		"POST /v1/projects/P/subscriptions/s:setIamPolicy",
+		"GET /v1/projects/P/subscriptions/s:getIamPolicy",
+		"POST /v1/projects/P/subscriptions/s:setIamPolicy",
+		"GET /v1/projects/P/subscriptions/s:getIamPolicy",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got calls %v, want %v", got, want)
+	}
+	wantPolicy := map[string]interface{}{
+		"etag": "Ag==",
+		"bindings": []interface{}{
+			map[string]interface{}{
+				"role":    "roles/pubsub.subscriber",
+				"members": []interface{}{"user:x", "user:a"},
+			},
+		},
+	}
+	if got := rs.calls[3].body["policy"]; !reflect.DeepEqual(got, wantPolicy) {
+		t.Errorf("retried setIamPolicy: got %v, want %v", got, wantPolicy)
+	}
+}
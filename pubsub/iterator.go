@@ -41,6 +41,22 @@ type Iterator struct {
 
 	// closed is used to signal that Stop has been called.
 	closed chan struct{}
+
+	// ctx is used to publish dead-lettered messages.
+	ctx context.Context
+
+	// deadLetter, if non-nil, is applied to the messages returned by Next.
+	deadLetter *DeadLetterPolicy
+
+	attemptsMu sync.Mutex
+	// key: message ID; value: number of times returned by Next, and when.
+	// Only maintained if deadLetter is non-nil.
+	attempts map[string]deliveryAttempts
+	// Entries of attempts whose last delivery is older than attemptsTTL are
+	// evicted; lastSweep is when that was last done.
+	attemptsTTL time.Duration
+	lastSweep   time.Time
+	now         func() time.Time
 }
 
 // newIterator starts a new Iterator.  Stop must be called on the Iterator
@@ -80,12 +96,20 @@ func newIterator(ctx context.Context, s service, subName string, po *pullOptions
 	ka.Start()
 	ack.Start()
 	return &Iterator{
-		kaTicker:  kaTicker,
-		ackTicker: ackTicker,
-		ka:        ka,
-		acker:     ack,
-		puller:    pull,
-		closed:    make(chan struct{}),
+		kaTicker:   kaTicker,
+		ackTicker:  ackTicker,
+		ka:         ka,
+		acker:      ack,
+		puller:     pull,
+		closed:     make(chan struct{}),
+		ctx:        ctx,
+		deadLetter: po.deadLetter,
+		attempts:   make(map[string]deliveryAttempts),
+		// A message that is not acked is redelivered at the latest once its
+		// deadline, extended for up to maxExtension, expires.
+		attemptsTTL: po.maxExtension + 2*po.ackDeadline,
+		lastSweep:   time.Now(),
+		now:         time.Now,
 	}
 }
 
@@ -93,19 +117,25 @@ func newIterator(ctx context.Context, s service, subName string, po *pullOptions
 // Message.Done when finished with it.
 // Once Stop has been called, calls to Next will return Done.
 func (it *Iterator) Next() (*Message, error) {
-	m, err := it.puller.Next()
-
-	if err == nil {
-		m.it = it
-		return m, nil
-	}
-
-	select {
-	// If Stop has been called, we return Done regardless the value of err.
-	case <-it.closed:
-		return nil, Done
-	default:
-		return nil, err
+	for {
+		m, err := it.puller.Next()
+
+		if err == nil {
+			m.it = it
+			if !it.deliver(m) {
+				// m has been dead-lettered.
+				continue
+			}
+			return m, nil
+		}
+
+		select {
+		// If Stop has been called, we return Done regardless the value of err.
+		case <-it.closed:
+			return nil, Done
+		default:
+			return nil, err
+		}
 	}
 }
 
@@ -151,12 +181,13 @@ func (it *Iterator) Stop() {
 	it.ackTicker.Stop()
 }
 
-func (it *Iterator) done(ackID string, ack bool) {
+func (it *Iterator) done(m *Message, ack bool) {
 	if ack {
-		it.acker.Ack(ackID)
+		it.forget(m.ID)
+		it.acker.Ack(m.AckID)
 		// There's no need to call it.ka.Remove here, as acker will
 		// call it via its Notify function.
 	} else {
-		it.ka.Remove(ackID)
+		it.nack(m)
 	}
 }
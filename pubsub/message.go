@@ -16,10 +16,21 @@ package pubsub
 
 import (
 	"encoding/base64"
+	"fmt"
+	"time"
 
 	raw "google.golang.org/api/pubsub/v1"
 )
 
+// OrderingKeyAttribute is the attribute that carries a Message's
+// OrderingKey, since the Pub/Sub API has no field for it. It is a convention
+// of this package only: other clients see it as an ordinary attribute.
+// It is removed from the Attributes of received Messages, and messages whose
+// Attributes contain it can't be published.
+const OrderingKeyAttribute = "pubsub-ordering-key"
+
+var errReservedAttribute = fmt.Errorf("pubsub: attribute %q is reserved; set Message.OrderingKey instead", OrderingKeyAttribute)
+
 // Message represents a Pub/Sub message.
 type Message struct {
 	// ID identifies this message.
@@ -38,12 +49,33 @@ type Message struct {
 	AckID string
 	// TODO(mcgreevy): unexport AckID.
 
-	// TODO(mcgreevy): add publish time.
+	// PublishTime is the time at which the message was published.
+	// This is populated by the server for Messages obtained from a subscription.
+	// It is otherwise ignored.
+	PublishTime time.Time
+
+	// OrderingKey identifies a sequence of messages. Messages with the same
+	// non-empty OrderingKey that are passed to Topic.PublishAsync are
+	// published in order, and Subscription.Receive never processes two
+	// messages with the same OrderingKey concurrently.
+	//
+	// Pub/Sub does not deliver messages in the order in which they were
+	// published, so Receive processes the messages of a key in the order in
+	// which they arrive, which may differ from publish order.
+	OrderingKey string
 
 	calledDone bool
 
-	// The iterator that created this Message.
+	// The iterator that created this Message, or nil for a Message
+	// received by a PushHandler.
 	it *Iterator
+
+	// push records the outcome of a Message received by a PushHandler.
+	push *pushState
+
+	// release, if non-nil, is called by Done to return the flow control
+	// capacity held by a Message delivered by Subscription.Receive.
+	release func()
 }
 
 func toMessage(resp *raw.ReceivedMessage) (*Message, error) {
@@ -54,18 +86,64 @@ func toMessage(resp *raw.ReceivedMessage) (*Message, error) {
 	if err != nil {
 		return nil, err
 	}
+	var pubTime time.Time
+	if resp.Message.PublishTime != "" {
+		pubTime, err = time.Parse(time.RFC3339, resp.Message.PublishTime)
+		if err != nil {
+			return nil, err
+		}
+	}
+	attrs := resp.Message.Attributes
+	key, ok := attrs[OrderingKeyAttribute]
+	if ok {
+		attrs = make(map[string]string, len(resp.Message.Attributes)-1)
+		for k, v := range resp.Message.Attributes {
+			if k != OrderingKeyAttribute {
+				attrs[k] = v
+			}
+		}
+		if len(attrs) == 0 {
+			attrs = nil
+		}
+	}
 	return &Message{
-		AckID:      resp.AckId,
-		Data:       data,
-		Attributes: resp.Message.Attributes,
-		ID:         resp.Message.MessageId,
+		AckID:       resp.AckId,
+		Data:        data,
+		Attributes:  attrs,
+		ID:          resp.Message.MessageId,
+		PublishTime: pubTime,
+		OrderingKey: key,
 	}, nil
 }
 
-// Done completes the processing of a Message that was returned from an Iterator.
+// checkAttributes returns an error if m's Attributes use a reserved key.
+func (m *Message) checkAttributes() error {
+	if _, ok := m.Attributes[OrderingKeyAttribute]; ok {
+		return errReservedAttribute
+	}
+	return nil
+}
+
+// rawAttributes returns the attributes to send for m, including its ordering key.
+func (m *Message) rawAttributes() map[string]string {
+	if m.OrderingKey == "" {
+		return m.Attributes
+	}
+	attrs := make(map[string]string, len(m.Attributes)+1)
+	for k, v := range m.Attributes {
+		attrs[k] = v
+	}
+	attrs[OrderingKeyAttribute] = m.OrderingKey
+	return attrs
+}
+
+// Done completes the processing of a Message that was returned from an Iterator
+// or passed to a Subscription.Receive callback.
 // ack indicates whether the message should be acknowledged.
 // Client code must call Done when finished for each Message returned by an iterator.
-// Done may only be called on Messages returned by an iterator.
+// Done may only be called on Messages returned by an iterator, passed to a
+// Receive callback, or passed to the function of a PushHandler. For the last,
+// calling Done is optional; Done(false) causes the message to be nacked.
 // If message acknowledgement fails, the Message will be redelivered.
 // Calls to Done have no effect after the first call.
 func (m *Message) Done(ack bool) {
@@ -73,5 +151,14 @@ func (m *Message) Done(ack bool) {
 		return
 	}
 	m.calledDone = true
-	m.it.done(m.AckID, ack)
+	if m.it == nil {
+		if m.push != nil {
+			m.push.done(ack)
+		}
+		return
+	}
+	m.it.done(m, ack)
+	if m.release != nil {
+		m.release()
+	}
 }
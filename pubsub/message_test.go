@@ -0,0 +1,72 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	raw "google.golang.org/api/pubsub/v1"
+)
+
+func TestToMessage(t *testing.T) {
+	got, err := toMessage(&raw.ReceivedMessage{
+		AckId: "ack",
+		Message: &raw.PubsubMessage{
+			Data:        "aGVsbG8=",
+			MessageId:   "id",
+			PublishTime: "2016-10-17T12:34:56.789Z",
+			Attributes:  map[string]string{"k": "v", OrderingKeyAttribute: "key"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Message{
+		ID:          "id",
+		AckID:       "ack",
+		Data:        []byte("hello"),
+		Attributes:  map[string]string{"k": "v"},
+		PublishTime: time.Date(2016, 10, 17, 12, 34, 56, 789e6, time.UTC),
+		OrderingKey: "key",
+	}
+	if !got.PublishTime.Equal(want.PublishTime) {
+		t.Errorf("publish time: got %v, want %v", got.PublishTime, want.PublishTime)
+	}
+	got.PublishTime = want.PublishTime
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if _, err := toMessage(&raw.ReceivedMessage{Message: &raw.PubsubMessage{PublishTime: "yesterday"}}); err == nil {
+		t.Error("bad publish time: got nil, want error")
+	}
+}
+
+func TestRawAttributes(t *testing.T) {
+	m := &Message{Attributes: map[string]string{"k": "v"}}
+	if got := m.rawAttributes(); !reflect.DeepEqual(got, m.Attributes) {
+		t.Errorf("no ordering key: got %v, want %v", got, m.Attributes)
+	}
+	m.OrderingKey = "key"
+	want := map[string]string{"k": "v", OrderingKeyAttribute: "key"}
+	if got := m.rawAttributes(); !reflect.DeepEqual(got, want) {
+		t.Errorf("with ordering key: got %v, want %v", got, want)
+	}
+	if _, ok := m.Attributes[OrderingKeyAttribute]; ok {
+		t.Error("rawAttributes modified Message.Attributes")
+	}
+}
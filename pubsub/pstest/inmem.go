@@ -0,0 +1,731 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+Package pstest contains test helpers for working with the pubsub package.
+
+To use a Server, create it, and then connect to it over plain HTTP:
+(The project ID is used to name topics and subscriptions.)
+
+	srv, err := pstest.NewServer("127.0.0.1:0")
+	...
+	client, err := pubsub.NewClient(ctx, proj,
+		option.WithEndpoint("http://"+srv.Addr+"/"),
+		option.WithHTTPClient(http.DefaultClient))
+	...
+*/
+package pstest // import "cloud.google.com/go/pubsub/pstest"
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deletedTopic is the topic name reported for subscriptions whose topic has been deleted.
+const deletedTopic = "_deleted-topic_"
+
+const (
+	defaultAckDeadline = 10 * time.Second
+	defaultPageSize    = 100
+
+	// pullWait is how long a pull waits for messages before returning an
+	// empty response, unless it asks to return immediately.
+	pullWait = time.Second
+
+	// pollInterval is how often a waiting pull checks for messages whose
+	// ack deadline has expired.
+	pollInterval = 10 * time.Millisecond
+)
+
+// Server is an in-memory Cloud Pub/Sub fake.
+// It is unauthenticated, and only a rough approximation.
+type Server struct {
+	Addr string
+
+	l   net.Listener
+	srv *http.Server
+	s   *server
+}
+
+// server is the real implementation of the fake.
+// It is a separate and unexported type so the API won't be cluttered with
+// methods that are only relevant to the fake's implementation.
+type server struct {
+	mu     sync.Mutex
+	topics map[string]*topic        // keyed by fully qualified name
+	subs   map[string]*subscription // keyed by fully qualified name
+	nextID int                      // used to make message and ack IDs
+	clock  func() time.Time         // if nil, time.Now is used
+
+	// changed is closed, and replaced, when messages may have become
+	// available for pulling.
+	changed chan struct{}
+}
+
+type topic struct {
+	name string
+	subs map[string]*subscription
+}
+
+type subscription struct {
+	name        string
+	topic       string
+	ackDeadline time.Duration
+	pushConfig  pushConfig
+
+	msgs  []*message          // in publish order; acked messages are removed
+	acked map[string]*message // outstanding messages, keyed by current ack ID
+}
+
+// message is a message in a subscription.
+type message struct {
+	id          string
+	data        string // base64 encoded
+	attributes  map[string]string
+	publishTime time.Time
+
+	ackID      string    // the ack ID of the latest delivery, if any
+	deadline   time.Time // when the latest delivery expires; zero if not outstanding
+	deliveries int
+}
+
+// NewServer creates a new Server.
+// The Server will be listening for HTTP requests, without TLS,
+// on the provided address. The resolved address is named by the Addr field.
+func NewServer(laddr string) (*Server, error) {
+	l, err := net.Listen("tcp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		Addr: l.Addr().String(),
+		l:    l,
+		s: &server{
+			topics:  make(map[string]*topic),
+			subs:    make(map[string]*subscription),
+			changed: make(chan struct{}),
+		},
+	}
+	s.srv = &http.Server{Handler: s.s}
+	go s.srv.Serve(l)
+	return s, nil
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.l.Close()
+}
+
+// SetClock sets the function the server uses to get the current time,
+// which determines the publish times of messages and when the ack deadlines
+// of pulled messages expire. Passing nil restores the default, time.Now.
+// Advancing the clock past a message's ack deadline makes it available for
+// redelivery without waiting for real time to pass.
+func (s *Server) SetClock(now func() time.Time) {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+	s.s.clock = now
+	s.s.notify()
+}
+
+// Deliveries returns the number of times the message with the given ID has
+// been delivered on the named subscription, or 0 if the subscription has no
+// such message (for example, because it has been acked).
+// sub is the fully qualified name of the subscription.
+func (s *Server) Deliveries(sub, msgID string) int {
+	s.s.mu.Lock()
+	defer s.s.mu.Unlock()
+	if sb, ok := s.s.subs[sub]; ok {
+		for _, m := range sb.msgs {
+			if m.id == msgID {
+				return m.deliveries
+			}
+		}
+	}
+	return 0
+}
+
+func (s *server) now() time.Time {
+	if s.clock != nil {
+		return s.clock()
+	}
+	return time.Now()
+}
+
+// notify wakes up waiting pulls. s.mu must be held.
+func (s *server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *server) newID(prefix string) string {
+	s.nextID++
+	return prefix + strconv.Itoa(s.nextID)
+}
+
+// ServeHTTP dispatches a request for the Pub/Sub REST API.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	if !strings.HasPrefix(path, "v1/") {
+		writeError(w, http.StatusNotFound, "unknown path %q", r.URL.Path)
+		return
+	}
+	name, verb := path[len("v1/"):], ""
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name, verb = name[:i], name[i+1:]
+	}
+	parts := strings.Split(name, "/")
+
+	var (
+		res  interface{}
+		code int
+		err  error
+	)
+	switch {
+	case len(parts) == 3 && parts[2] == "topics" && r.Method == "GET":
+		res, code, err = s.listTopics(name, r)
+	case len(parts) == 3 && parts[2] == "subscriptions" && r.Method == "GET":
+		res, code, err = s.listSubscriptions(name, r)
+	case len(parts) == 5 && parts[2] == "topics" && parts[4] == "subscriptions" && r.Method == "GET":
+		res, code, err = s.listTopicSubscriptions(strings.Join(parts[:4], "/"), r)
+	case len(parts) == 4 && parts[2] == "topics":
+		res, code, err = s.handleTopic(name, verb, r)
+	case len(parts) == 4 && parts[2] == "subscriptions":
+		res, code, err = s.handleSubscription(name, verb, r)
+	default:
+		code, err = http.StatusNotFound, fmt.Errorf("unknown path %q", r.URL.Path)
+	}
+	if err != nil {
+		writeError(w, code, "%v", err)
+		return
+	}
+	if res == nil {
+		res = struct{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+func (s *server) handleTopic(name, verb string, r *http.Request) (interface{}, int, error) {
+	switch {
+	case verb == "" && r.Method == "PUT":
+		return s.createTopic(name)
+	case verb == "" && r.Method == "GET":
+		return s.getTopic(name)
+	case verb == "" && r.Method == "DELETE":
+		return s.deleteTopic(name)
+	case verb == "publish" && r.Method == "POST":
+		var req publishRequest
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.publish(name, &req)
+	}
+	return nil, http.StatusNotFound, fmt.Errorf("unknown method %s %s:%s", r.Method, name, verb)
+}
+
+func (s *server) handleSubscription(name, verb string, r *http.Request) (interface{}, int, error) {
+	switch {
+	case verb == "" && r.Method == "PUT":
+		var req subscriptionResource
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.createSubscription(name, &req)
+	case verb == "" && r.Method == "GET":
+		return s.getSubscription(name)
+	case verb == "" && r.Method == "DELETE":
+		return s.deleteSubscription(name)
+	case verb == "pull" && r.Method == "POST":
+		var req pullRequest
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.pull(name, &req)
+	case verb == "acknowledge" && r.Method == "POST":
+		var req ackRequest
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.acknowledge(name, &req)
+	case verb == "modifyAckDeadline" && r.Method == "POST":
+		var req ackRequest
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.modifyAckDeadline(name, &req)
+	case verb == "modifyPushConfig" && r.Method == "POST":
+		var req modifyPushConfigRequest
+		if err := decode(r, &req); err != nil {
+			return nil, http.StatusBadRequest, err
+		}
+		return s.modifyPushConfig(name, &req)
+	}
+	return nil, http.StatusNotFound, fmt.Errorf("unknown method %s %s:%s", r.Method, name, verb)
+}
+
+// The JSON representations of the REST API resources and messages.
+
+type topicResource struct {
+	Name string `json:"name"`
+}
+
+type pushConfig struct {
+	PushEndpoint string            `json:"pushEndpoint,omitempty"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+}
+
+type subscriptionResource struct {
+	Name               string      `json:"name,omitempty"`
+	Topic              string      `json:"topic"`
+	PushConfig         *pushConfig `json:"pushConfig,omitempty"`
+	AckDeadlineSeconds int64       `json:"ackDeadlineSeconds,omitempty"`
+}
+
+type pubsubMessage struct {
+	Data        string            `json:"data,omitempty"`
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MessageID   string            `json:"messageId,omitempty"`
+	PublishTime string            `json:"publishTime,omitempty"`
+}
+
+type publishRequest struct {
+	Messages []*pubsubMessage `json:"messages"`
+}
+
+type publishResponse struct {
+	MessageIDs []string `json:"messageIds"`
+}
+
+type pullRequest struct {
+	MaxMessages       int64 `json:"maxMessages"`
+	ReturnImmediately bool  `json:"returnImmediately"`
+}
+
+type receivedMessage struct {
+	AckID   string         `json:"ackId"`
+	Message *pubsubMessage `json:"message"`
+}
+
+type pullResponse struct {
+	ReceivedMessages []*receivedMessage `json:"receivedMessages,omitempty"`
+}
+
+type ackRequest struct {
+	AckIDs             []string `json:"ackIds"`
+	AckDeadlineSeconds int64    `json:"ackDeadlineSeconds"`
+}
+
+type modifyPushConfigRequest struct {
+	PushConfig *pushConfig `json:"pushConfig"`
+}
+
+type listTopicsResponse struct {
+	Topics        []*topicResource `json:"topics,omitempty"`
+	NextPageToken string           `json:"nextPageToken,omitempty"`
+}
+
+type listSubscriptionsResponse struct {
+	Subscriptions []*subscriptionResource `json:"subscriptions,omitempty"`
+	NextPageToken string                  `json:"nextPageToken,omitempty"`
+}
+
+type listTopicSubscriptionsResponse struct {
+	Subscriptions []string `json:"subscriptions,omitempty"`
+	NextPageToken string   `json:"nextPageToken,omitempty"`
+}
+
+func decode(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding request: %v", err)
+	}
+	return nil
+}
+
+// writeError writes an error response in the format that googleapi.CheckResponse expects.
+func writeError(w http.ResponseWriter, code int, format string, args ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	var body struct {
+		Error struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body.Error.Code = code
+	body.Error.Message = fmt.Sprintf(format, args...)
+	json.NewEncoder(w).Encode(body)
+}
+
+func notFound(kind, name string) (interface{}, int, error) {
+	return nil, http.StatusNotFound, fmt.Errorf("%s %q not found", kind, name)
+}
+
+func (s *server) createTopic(name string) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.topics[name]; ok {
+		return nil, http.StatusConflict, fmt.Errorf("topic %q already exists", name)
+	}
+	s.topics[name] = &topic{name: name, subs: make(map[string]*subscription)}
+	return &topicResource{Name: name}, 0, nil
+}
+
+func (s *server) getTopic(name string) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.topics[name]; !ok {
+		return notFound("topic", name)
+	}
+	return &topicResource{Name: name}, 0, nil
+}
+
+func (s *server) deleteTopic(name string) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.topics[name]
+	if !ok {
+		return notFound("topic", name)
+	}
+	for _, sub := range t.subs {
+		sub.topic = deletedTopic
+	}
+	delete(s.topics, name)
+	return nil, 0, nil
+}
+
+// page returns the page of names selected by the pageToken and pageSize
+// query parameters, and the token for the next page.
+func page(names []string, r *http.Request) ([]string, string, error) {
+	sort.Strings(names)
+	start := 0
+	if tok := r.FormValue("pageToken"); tok != "" {
+		var err error
+		if start, err = strconv.Atoi(tok); err != nil || start < 0 || start > len(names) {
+			return nil, "", fmt.Errorf("bad page token %q", tok)
+		}
+	}
+	size := defaultPageSize
+	if ps := r.FormValue("pageSize"); ps != "" {
+		var err error
+		if size, err = strconv.Atoi(ps); err != nil || size <= 0 {
+			return nil, "", fmt.Errorf("bad page size %q", ps)
+		}
+	}
+	end, next := start+size, ""
+	if end < len(names) {
+		next = strconv.Itoa(end)
+	} else {
+		end = len(names)
+	}
+	return names[start:end], next, nil
+}
+
+func (s *server) listTopics(project string, r *http.Request) (interface{}, int, error) {
+	s.mu.Lock()
+	var names []string
+	for name := range s.topics {
+		if strings.HasPrefix(name, project+"/") {
+			names = append(names, name)
+		}
+	}
+	s.mu.Unlock()
+	names, next, err := page(names, r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	res := &listTopicsResponse{NextPageToken: next}
+	for _, name := range names {
+		res.Topics = append(res.Topics, &topicResource{Name: name})
+	}
+	return res, 0, nil
+}
+
+func (s *server) listSubscriptions(project string, r *http.Request) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name := range s.subs {
+		if strings.HasPrefix(name, project+"/") {
+			names = append(names, name)
+		}
+	}
+	names, next, err := page(names, r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	res := &listSubscriptionsResponse{NextPageToken: next}
+	for _, name := range names {
+		res.Subscriptions = append(res.Subscriptions, s.subs[name].resource())
+	}
+	return res, 0, nil
+}
+
+func (s *server) listTopicSubscriptions(name string, r *http.Request) (interface{}, int, error) {
+	s.mu.Lock()
+	t, ok := s.topics[name]
+	var names []string
+	if ok {
+		for name := range t.subs {
+			names = append(names, name)
+		}
+	}
+	s.mu.Unlock()
+	if !ok {
+		return notFound("topic", name)
+	}
+	names, next, err := page(names, r)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return &listTopicSubscriptionsResponse{Subscriptions: names, NextPageToken: next}, 0, nil
+}
+
+func (s *server) publish(name string, req *publishRequest) (interface{}, int, error) {
+	if len(req.Messages) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("no messages")
+	}
+	for _, m := range req.Messages {
+		if _, err := base64.StdEncoding.DecodeString(m.Data); err != nil {
+			return nil, http.StatusBadRequest, fmt.Errorf("bad message data: %v", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.topics[name]
+	if !ok {
+		return notFound("topic", name)
+	}
+	now := s.now()
+	res := &publishResponse{}
+	for _, m := range req.Messages {
+		id := s.newID("m")
+		res.MessageIDs = append(res.MessageIDs, id)
+		for _, sub := range t.subs {
+			sub.msgs = append(sub.msgs, &message{
+				id:          id,
+				data:        m.Data,
+				attributes:  m.Attributes,
+				publishTime: now,
+			})
+		}
+	}
+	s.notify()
+	return res, 0, nil
+}
+
+func (s *server) createSubscription(name string, req *subscriptionResource) (interface{}, int, error) {
+	ackDeadline := defaultAckDeadline
+	if req.AckDeadlineSeconds != 0 {
+		ackDeadline = time.Duration(req.AckDeadlineSeconds) * time.Second
+	}
+	if ackDeadline < 10*time.Second || ackDeadline > 600*time.Second {
+		return nil, http.StatusBadRequest, fmt.Errorf("bad ack deadline %v", ackDeadline)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subs[name]; ok {
+		return nil, http.StatusConflict, fmt.Errorf("subscription %q already exists", name)
+	}
+	t, ok := s.topics[req.Topic]
+	if !ok {
+		return notFound("topic", req.Topic)
+	}
+	sub := &subscription{
+		name:        name,
+		topic:       req.Topic,
+		ackDeadline: ackDeadline,
+		acked:       make(map[string]*message),
+	}
+	if req.PushConfig != nil {
+		sub.pushConfig = *req.PushConfig
+	}
+	s.subs[name] = sub
+	t.subs[name] = sub
+	return sub.resource(), 0, nil
+}
+
+func (sub *subscription) resource() *subscriptionResource {
+	pc := sub.pushConfig
+	return &subscriptionResource{
+		Name:               sub.name,
+		Topic:              sub.topic,
+		PushConfig:         &pc,
+		AckDeadlineSeconds: int64(sub.ackDeadline / time.Second),
+	}
+}
+
+func (s *server) getSubscription(name string) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[name]
+	if !ok {
+		return notFound("subscription", name)
+	}
+	return sub.resource(), 0, nil
+}
+
+func (s *server) deleteSubscription(name string) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[name]
+	if !ok {
+		return notFound("subscription", name)
+	}
+	if t, ok := s.topics[sub.topic]; ok {
+		delete(t.subs, name)
+	}
+	delete(s.subs, name)
+	return nil, 0, nil
+}
+
+func (s *server) modifyPushConfig(name string, req *modifyPushConfigRequest) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[name]
+	if !ok {
+		return notFound("subscription", name)
+	}
+	sub.pushConfig = pushConfig{}
+	if req.PushConfig != nil {
+		sub.pushConfig = *req.PushConfig
+	}
+	return nil, 0, nil
+}
+
+// pull returns the messages that are available on the subscription. Unless
+// the request asks to return immediately, it waits a while for messages if
+// none are available.
+func (s *server) pull(name string, req *pullRequest) (interface{}, int, error) {
+	if req.MaxMessages <= 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("maxMessages must be positive")
+	}
+	timeout := time.NewTimer(pullWait)
+	defer timeout.Stop()
+	poll := time.NewTicker(pollInterval)
+	defer poll.Stop()
+	for {
+		s.mu.Lock()
+		sub, ok := s.subs[name]
+		if !ok {
+			s.mu.Unlock()
+			return notFound("subscription", name)
+		}
+		res := s.deliver(sub, int(req.MaxMessages))
+		changed := s.changed
+		s.mu.Unlock()
+		if len(res.ReceivedMessages) > 0 || req.ReturnImmediately {
+			return res, 0, nil
+		}
+
+		select {
+		case <-changed:
+		case <-poll.C:
+			// Deadlines may have expired.
+		case <-timeout.C:
+			return res, 0, nil
+		}
+	}
+}
+
+// deliver delivers up to max of the available messages on sub, giving them
+// new ack IDs and deadlines. s.mu must be held.
+func (s *server) deliver(sub *subscription, max int) *pullResponse {
+	now := s.now()
+	res := &pullResponse{}
+	for _, m := range sub.msgs {
+		if len(res.ReceivedMessages) == max {
+			break
+		}
+		if !m.deadline.IsZero() && now.Before(m.deadline) {
+			continue // outstanding
+		}
+		delete(sub.acked, m.ackID)
+		m.ackID = s.newID("a")
+		m.deadline = now.Add(sub.ackDeadline)
+		m.deliveries++
+		sub.acked[m.ackID] = m
+		res.ReceivedMessages = append(res.ReceivedMessages, &receivedMessage{
+			AckID: m.ackID,
+			Message: &pubsubMessage{
+				Data:        m.data,
+				Attributes:  m.attributes,
+				MessageID:   m.id,
+				PublishTime: m.publishTime.UTC().Format(time.RFC3339Nano),
+			},
+		})
+	}
+	return res
+}
+
+func (s *server) acknowledge(name string, req *ackRequest) (interface{}, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[name]
+	if !ok {
+		return notFound("subscription", name)
+	}
+	for _, id := range req.AckIDs {
+		m, ok := sub.acked[id]
+		if !ok {
+			// The ack ID has expired or is unknown; ignore it, as the real service does.
+			continue
+		}
+		delete(sub.acked, id)
+		for i, mm := range sub.msgs {
+			if mm == m {
+				sub.msgs = append(sub.msgs[:i], sub.msgs[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil, 0, nil
+}
+
+func (s *server) modifyAckDeadline(name string, req *ackRequest) (interface{}, int, error) {
+	if req.AckDeadlineSeconds < 0 || req.AckDeadlineSeconds > 600 {
+		return nil, http.StatusBadRequest, fmt.Errorf("bad ack deadline %ds", req.AckDeadlineSeconds)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.subs[name]
+	if !ok {
+		return notFound("subscription", name)
+	}
+	now := s.now()
+	for _, id := range req.AckIDs {
+		m, ok := sub.acked[id]
+		if !ok {
+			continue
+		}
+		if req.AckDeadlineSeconds == 0 {
+			// A nack: the message is available again immediately.
+			m.deadline = time.Time{}
+		} else {
+			m.deadline = now.Add(time.Duration(req.AckDeadlineSeconds) * time.Second)
+		}
+	}
+	s.notify()
+	return nil, 0, nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pstest
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"golang.org/x/net/context"
+	"google.golang.org/api/option"
+)
+
+func newClient(ctx context.Context, t *testing.T) (*pubsub.Client, *Server) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := pubsub.NewClient(ctx, "proj",
+		option.WithEndpoint("http://"+srv.Addr+"/"),
+		option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, srv
+}
+
+func TestTopicsAndSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	client, srv := newClient(ctx, t)
+	defer srv.Close()
+
+	topic, err := client.NewTopic(ctx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.NewTopic(ctx, "t"); err == nil {
+		t.Error("creating an existing topic: got nil, want error")
+	}
+	if ok, err := topic.Exists(ctx); err != nil || !ok {
+		t.Errorf("topic.Exists: got %t, %v, want true, nil", ok, err)
+	}
+	if ok, err := client.Topic("nope").Exists(ctx); err != nil || ok {
+		t.Errorf("Exists of missing topic: got %t, %v, want false, nil", ok, err)
+	}
+
+	push := &pubsub.PushConfig{Endpoint: "https://example.com/push"}
+	for _, name := range []string{"s1", "s2"} {
+		if _, err := client.NewSubscription(ctx, name, topic, 20*time.Second, push); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub := client.Subscription("s1")
+	conf, err := sub.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Topic.Name() != topic.Name() || conf.AckDeadline != 20*time.Second || conf.PushConfig.Endpoint != push.Endpoint {
+		t.Errorf("config: got %+v", conf)
+	}
+	if err := sub.ModifyPushConfig(ctx, &pubsub.PushConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if conf, err := sub.Config(ctx); err != nil || conf.PushConfig.Endpoint != "" {
+		t.Errorf("after ModifyPushConfig: got %+v, %v", conf, err)
+	}
+
+	var got []string
+	it := topic.Subscriptions(ctx)
+	for {
+		s, err := it.Next()
+		if err == pubsub.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s.Name())
+	}
+	want := []string{"projects/proj/subscriptions/s1", "projects/proj/subscriptions/s2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("topic subscriptions: got %v, want %v", got, want)
+	}
+
+	if err := client.Subscription("s2").Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := topic.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if conf, err := sub.Config(ctx); err != nil || conf.Topic.Name() != deletedTopic {
+		t.Errorf("after deleting topic: got %+v, %v", conf, err)
+	}
+}
+
+func TestPublishAndPull(t *testing.T) {
+	ctx := context.Background()
+	client, srv := newClient(ctx, t)
+	defer srv.Close()
+
+	topic, err := client.NewTopic(ctx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.NewSubscription(ctx, "s", topic, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids, err := topic.Publish(ctx,
+		&pubsub.Message{Data: []byte("a"), Attributes: map[string]string{"k": "v"}, OrderingKey: "o"},
+		&pubsub.Message{Data: []byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		mu  sync.Mutex
+		got = map[string]string{}
+	)
+	cctx, cancel := context.WithCancel(ctx)
+	err = sub.Receive(cctx, func(ctx context.Context, m *pubsub.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		got[m.ID] = string(m.Data) + m.Attributes["k"] + m.OrderingKey
+		if m.PublishTime.IsZero() {
+			t.Errorf("message %s has no publish time", m.ID)
+		}
+		m.Done(true)
+		if len(got) == len(ids) {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{ids[0]: "avo", ids[1]: "b"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, id := range ids {
+		if n := srv.Deliveries(sub.Name(), id); n != 0 {
+			t.Errorf("message %s still in subscription after ack, with %d deliveries", id, n)
+		}
+	}
+}
+
+func TestRedelivery(t *testing.T) {
+	srv, err := NewServer("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	now := time.Unix(1000, 0)
+	var mu sync.Mutex
+	srv.SetClock(func() time.Time {
+		mu.Lock()
+		defer mu.Unlock()
+		return now
+	})
+	advance := func(d time.Duration) {
+		mu.Lock()
+		now = now.Add(d)
+		mu.Unlock()
+	}
+
+	s := srv.s
+	if _, _, err := s.createTopic("projects/p/topics/t"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.createSubscription("projects/p/subscriptions/s", &subscriptionResource{Topic: "projects/p/topics/t"}); err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := s.publish("projects/p/topics/t", &publishRequest{Messages: []*pubsubMessage{{Data: "YQ=="}, {Data: "Yg=="}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgIDs := res.(*publishResponse).MessageIDs
+
+	pull := func() []string {
+		res, _, err := s.pull("projects/p/subscriptions/s", &pullRequest{MaxMessages: 10, ReturnImmediately: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ackIDs []string
+		for _, rm := range res.(*pullResponse).ReceivedMessages {
+			if rm.Message.PublishTime != "1970-01-01T00:16:40Z" {
+				t.Errorf("publish time: got %q", rm.Message.PublishTime)
+			}
+			ackIDs = append(ackIDs, rm.AckID)
+		}
+		return ackIDs
+	}
+
+	first := pull()
+	if len(first) != 2 {
+		t.Fatalf("first pull: got %d messages, want 2", len(first))
+	}
+	if got := pull(); len(got) != 0 {
+		t.Fatalf("pull before deadline: got %d messages, want 0", len(got))
+	}
+	// Ack the first message, and extend the second.
+	if _, _, err := s.acknowledge("projects/p/subscriptions/s", &ackRequest{AckIDs: first[:1]}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.modifyAckDeadline("projects/p/subscriptions/s", &ackRequest{AckIDs: first[1:], AckDeadlineSeconds: 60}); err != nil {
+		t.Fatal(err)
+	}
+	advance(30 * time.Second)
+	if got := pull(); len(got) != 0 {
+		t.Fatalf("pull before extended deadline: got %d messages, want 0", len(got))
+	}
+	advance(31 * time.Second)
+	second := pull()
+	if len(second) != 1 || second[0] == first[1] {
+		t.Fatalf("pull after deadline: got %v, want one message with a new ack ID", second)
+	}
+	if got := srv.Deliveries("projects/p/subscriptions/s", msgIDs[1]); got != 2 {
+		t.Errorf("deliveries: got %d, want 2", got)
+	}
+
+	// Acking with the expired ack ID has no effect.
+	s.acknowledge("projects/p/subscriptions/s", &ackRequest{AckIDs: first[1:]})
+	// A nack makes the message available immediately.
+	s.modifyAckDeadline("projects/p/subscriptions/s", &ackRequest{AckIDs: second})
+	third := pull()
+	if len(third) != 1 {
+		t.Fatalf("pull after nack: got %v, want one message", third)
+	}
+	s.acknowledge("projects/p/subscriptions/s", &ackRequest{AckIDs: third})
+	if got := pull(); len(got) != 0 {
+		t.Errorf("pull after ack: got %v, want none", got)
+	}
+}
+
+func TestListPaging(t *testing.T) {
+	ctx := context.Background()
+	client, srv := newClient(ctx, t)
+	defer srv.Close()
+
+	var want []string
+	for i := 0; i < 250; i++ {
+		topic, err := client.NewTopic(ctx, "t"+string('a'+rune(i/26%26))+string('a'+rune(i%26)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, topic.Name())
+	}
+	sort.Strings(want)
+	var got []string
+	it := client.Topics(ctx)
+	for {
+		topic, err := it.Next()
+		if err == pubsub.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, topic.Name())
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %d topics, want %d", len(got), len(want))
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/internal/bundler"
+	"golang.org/x/net/context"
+)
+
+const (
+	// DefaultPublishDelayThreshold is the default value for PublishSettings.DelayThreshold.
+	DefaultPublishDelayThreshold = 10 * time.Millisecond
+
+	// DefaultPublishCountThreshold is the default value for PublishSettings.CountThreshold.
+	DefaultPublishCountThreshold = 100
+
+	// DefaultPublishByteThreshold is the default value for PublishSettings.ByteThreshold.
+	DefaultPublishByteThreshold = 1e6 // 1M
+
+	// DefaultPublishBufferedByteLimit is the default value for PublishSettings.BufferedByteLimit.
+	DefaultPublishBufferedByteLimit = 1e8 // 100M
+)
+
+var (
+	// ErrOverflow is the error of a PublishResult when the topic's publish
+	// buffer is full and PublishSettings.BlockOnOverflow is false.
+	ErrOverflow = errors.New("pubsub: publish buffer is full")
+
+	// ErrTopicStopped is the error of a PublishResult when Topic.Stop has
+	// been called.
+	ErrTopicStopped = errors.New("pubsub: Stop has been called on the topic")
+
+	// ErrOrderingKeyPaused is the error of a PublishResult when an earlier
+	// message with the same ordering key failed to be published, and
+	// Topic.ResumePublish has not been called for the key since.
+	ErrOrderingKeyPaused = errors.New("pubsub: publishing is paused for the ordering key after an earlier failure")
+)
+
+// PublishSettings configures Topic.PublishAsync.
+// The zero value of each field means to use its default.
+type PublishSettings struct {
+	// Once this delay has passed since the first message was added to a
+	// bundle, the bundle is published.
+	DelayThreshold time.Duration
+
+	// Once a bundle has this many messages, it is published. Values larger
+	// than MaxPublishBatchSize are treated as MaxPublishBatchSize.
+	CountThreshold int
+
+	// Once the data and attributes of the messages in a bundle reach this
+	// many bytes, it is published.
+	ByteThreshold int
+
+	// The maximum number of bytes of messages that may be buffered or being
+	// published at once.
+	BufferedByteLimit int
+
+	// BlockOnOverflow controls what happens when BufferedByteLimit is
+	// reached. If true, PublishAsync blocks until earlier bundles have been
+	// published; otherwise, the message fails immediately with ErrOverflow.
+	BlockOnOverflow bool
+}
+
+// A PublishResult holds the result of a call to Topic.PublishAsync.
+type PublishResult struct {
+	ready    chan struct{}
+	serverID string
+	err      error
+}
+
+// Ready returns a channel that is closed when the result is available.
+func (r *PublishResult) Ready() <-chan struct{} { return r.ready }
+
+// Get returns the server-assigned ID of the message, or the error that
+// prevented it from being published. It blocks until the result is
+// available, or until ctx is done, in which case it returns ctx.Err().
+func (r *PublishResult) Get(ctx context.Context) (serverID string, err error) {
+	select {
+	case <-r.ready:
+		return r.serverID, r.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (r *PublishResult) set(serverID string, err error) {
+	r.serverID = serverID
+	r.err = err
+	close(r.ready)
+}
+
+// publisher bundles the messages passed to Topic.PublishAsync.
+type publisher struct {
+	t        *Topic
+	bundler  *bundler.Bundler
+	maxBytes int
+	block    bool
+
+	mu      sync.Mutex
+	bytes   int             // bytes of messages that are buffered or being published
+	spacec  chan struct{}   // closed and re-created when bytes decreases
+	paused  map[string]bool // ordering keys whose messages fail until resumed
+	stopped bool
+}
+
+// bundledMessage is a message waiting in a publisher.
+type bundledMessage struct {
+	msg  *Message
+	res  *PublishResult
+	size int
+}
+
+func newPublisher(t *Topic, s PublishSettings) *publisher {
+	if s.DelayThreshold == 0 {
+		s.DelayThreshold = DefaultPublishDelayThreshold
+	}
+	if s.CountThreshold == 0 {
+		s.CountThreshold = DefaultPublishCountThreshold
+	}
+	if s.CountThreshold > MaxPublishBatchSize {
+		s.CountThreshold = MaxPublishBatchSize
+	}
+	if s.ByteThreshold == 0 {
+		s.ByteThreshold = DefaultPublishByteThreshold
+	}
+	if s.BufferedByteLimit == 0 {
+		s.BufferedByteLimit = DefaultPublishBufferedByteLimit
+	}
+
+	p := &publisher{
+		t:        t,
+		maxBytes: s.BufferedByteLimit,
+		block:    s.BlockOnOverflow,
+		spacec:   make(chan struct{}),
+		paused:   make(map[string]bool),
+	}
+	// The bundler handles one bundle at a time, in order, so messages with
+	// the same ordering key are published in sequence.
+	p.bundler = bundler.NewBundler(&bundledMessage{}, func(bms interface{}) {
+		p.publish(bms.([]*bundledMessage))
+	})
+	p.bundler.DelayThreshold = s.DelayThreshold
+	p.bundler.BundleCountThreshold = s.CountThreshold
+	p.bundler.BundleByteThreshold = s.ByteThreshold
+	// The publisher does its own flow control in add, so the bundler must
+	// never reject a message.
+	p.bundler.BufferedByteLimit = math.MaxInt32
+	return p
+}
+
+// PublishAsync adds msg to a bundle of messages to be published to the topic,
+// and returns a PublishResult that holds the outcome. Bundles are published
+// according to the topic's PublishSettings, which must not be changed after
+// the first call to PublishAsync.
+//
+// Messages with the same non-empty OrderingKey are published in the order
+// in which they were passed to PublishAsync. If one of them fails to be
+// published, publishing pauses for that key: the messages with the key that
+// follow it fail with ErrOrderingKeyPaused, until ResumePublish is called.
+// A message whose Attributes contain OrderingKeyAttribute fails without
+// being published.
+//
+// ctx is used only while waiting for buffer space when
+// PublishSettings.BlockOnOverflow is set; bundles are published in the
+// background. Stop must be called once the Topic is no longer needed, to
+// publish any outstanding messages.
+//
+// PublishAsync is safe to use concurrently.
+func (t *Topic) PublishAsync(ctx context.Context, msg *Message) *PublishResult {
+	t.mu.Lock()
+	if t.publisher == nil && !t.stopped {
+		t.publisher = newPublisher(t, t.PublishSettings)
+	}
+	p := t.publisher
+	t.mu.Unlock()
+
+	res := &PublishResult{ready: make(chan struct{})}
+	if p == nil {
+		res.set("", ErrTopicStopped)
+		return res
+	}
+	p.add(ctx, msg, res)
+	return res
+}
+
+// ResumePublish resumes publishing for orderingKey after it was paused by a
+// failure to publish a message with the key.
+func (t *Topic) ResumePublish(orderingKey string) {
+	t.mu.Lock()
+	p := t.publisher
+	t.mu.Unlock()
+	if p != nil {
+		p.mu.Lock()
+		delete(p.paused, orderingKey)
+		p.mu.Unlock()
+	}
+}
+
+// Stop publishes all messages passed to PublishAsync, waiting until they
+// have been sent, and releases the Topic's background resources.
+// Subsequent calls to PublishAsync fail with ErrTopicStopped.
+func (t *Topic) Stop() {
+	t.mu.Lock()
+	p := t.publisher
+	t.stopped = true
+	t.mu.Unlock()
+	if p != nil {
+		p.stop()
+	}
+}
+
+// add adds msg to the current bundle, or sets res to the reason it can't.
+// If the buffer is full, add waits until there is room, or fails with
+// ErrOverflow, depending on p.block. A message larger than the limit is
+// allowed when nothing else is buffered, so that it can still be published.
+func (p *publisher) add(ctx context.Context, msg *Message, res *PublishResult) {
+	if err := msg.checkAttributes(); err != nil {
+		res.set("", err)
+		return
+	}
+	size := len(msg.Data)
+	for k, v := range msg.Attributes {
+		size += len(k) + len(v)
+	}
+	if msg.OrderingKey != "" {
+		// The key is sent as an attribute.
+		size += len(OrderingKeyAttribute) + len(msg.OrderingKey)
+	}
+	for {
+		p.mu.Lock()
+		if p.stopped {
+			p.mu.Unlock()
+			res.set("", ErrTopicStopped)
+			return
+		}
+		if msg.OrderingKey != "" && p.paused[msg.OrderingKey] {
+			p.mu.Unlock()
+			res.set("", ErrOrderingKeyPaused)
+			return
+		}
+		if p.bytes == 0 || p.bytes+size <= p.maxBytes {
+			// Add to the bundler while holding p.mu, so that stop can't
+			// close the bundler in between.
+			err := p.bundler.Add(&bundledMessage{msg: msg, res: res, size: size}, size)
+			if err == nil {
+				p.bytes += size
+			}
+			p.mu.Unlock()
+			if err != nil {
+				res.set("", err)
+			}
+			return
+		}
+		spacec := p.spacec
+		p.mu.Unlock()
+
+		if !p.block {
+			res.set("", ErrOverflow)
+			return
+		}
+		select {
+		case <-spacec:
+		case <-ctx.Done():
+			res.set("", ctx.Err())
+			return
+		}
+	}
+}
+
+// release gives back buffer space taken by add.
+func (p *publisher) release(size int) {
+	p.mu.Lock()
+	p.bytes -= size
+	close(p.spacec)
+	p.spacec = make(chan struct{})
+	p.mu.Unlock()
+}
+
+// publish publishes a bundle of messages and sets their results.
+// Messages whose ordering key is paused are not sent; if sending fails, the
+// ordering keys of the messages that were sent are paused.
+func (p *publisher) publish(bms []*bundledMessage) {
+	size := 0
+	for _, bm := range bms {
+		size += bm.size
+	}
+	defer p.release(size)
+
+	var (
+		send []*bundledMessage
+		msgs []*Message
+	)
+	p.mu.Lock()
+	for _, bm := range bms {
+		if key := bm.msg.OrderingKey; key != "" && p.paused[key] {
+			bm.res.set("", ErrOrderingKeyPaused)
+			continue
+		}
+		send = append(send, bm)
+		msgs = append(msgs, bm.msg)
+	}
+	p.mu.Unlock()
+	if len(send) == 0 {
+		return
+	}
+
+	ids, err := p.t.s.publishMessages(context.Background(), p.t.name, msgs)
+	if err == nil && len(ids) != len(send) {
+		err = errors.New("pubsub: server returned the wrong number of message IDs")
+	}
+	if err != nil {
+		p.mu.Lock()
+		for _, bm := range send {
+			if key := bm.msg.OrderingKey; key != "" {
+				p.paused[key] = true
+			}
+		}
+		p.mu.Unlock()
+	}
+	for i, bm := range send {
+		if err != nil {
+			bm.res.set("", err)
+		} else {
+			bm.res.set(ids[i], nil)
+		}
+	}
+}
+
+// stop publishes all outstanding messages and shuts down the bundler.
+func (p *publisher) stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.mu.Unlock()
+	p.bundler.Close()
+}
@@ -0,0 +1,259 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// publishService records the batches passed to publishMessages.
+type publishService struct {
+	service
+
+	// If non-nil, publishMessages waits to receive from unblock.
+	unblock chan struct{}
+	err     error
+
+	mu      sync.Mutex
+	batches [][]*Message
+}
+
+func (s *publishService) publishMessages(ctx context.Context, topicName string, msgs []*Message) ([]string, error) {
+	if s.unblock != nil {
+		<-s.unblock
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batches = append(s.batches, msgs)
+	if s.err != nil {
+		return nil, s.err
+	}
+	var ids []string
+	for _, m := range msgs {
+		ids = append(ids, "id-"+string(m.Data))
+	}
+	return ids, nil
+}
+
+func TestPublishAsync(t *testing.T) {
+	ctx := context.Background()
+	s := &publishService{}
+	c := &Client{projectID: "projid", s: s}
+	topic := c.Topic("t")
+	topic.PublishSettings = PublishSettings{
+		CountThreshold: 3,
+		DelayThreshold: time.Hour,
+	}
+
+	var results []*PublishResult
+	for i := 0; i < 7; i++ {
+		results = append(results, topic.PublishAsync(ctx, &Message{Data: []byte(fmt.Sprint(i))}))
+	}
+	topic.Stop()
+
+	for i, r := range results {
+		select {
+		case <-r.Ready():
+		default:
+			t.Fatalf("result %d not ready after Stop", i)
+		}
+		id, err := r.Get(ctx)
+		if err != nil {
+			t.Fatalf("result %d: %v", i, err)
+		}
+		if want := fmt.Sprintf("id-%d", i); id != want {
+			t.Errorf("result %d: got ID %q, want %q", i, id, want)
+		}
+	}
+	var sizes []int
+	for _, b := range s.batches {
+		sizes = append(sizes, len(b))
+	}
+	if fmt.Sprint(sizes) != "[3 3 1]" {
+		t.Errorf("batch sizes: got %v, want [3 3 1]", sizes)
+	}
+
+	if _, err := topic.PublishAsync(ctx, &Message{}).Get(ctx); err != ErrTopicStopped {
+		t.Errorf("after Stop: got %v, want %v", err, ErrTopicStopped)
+	}
+}
+
+func TestPublishAsyncError(t *testing.T) {
+	ctx := context.Background()
+	wantErr := errors.New("bang")
+	s := &publishService{err: wantErr}
+	c := &Client{projectID: "projid", s: s}
+	topic := c.Topic("t")
+	r := topic.PublishAsync(ctx, &Message{Data: []byte("x")})
+	topic.Stop()
+	if _, err := r.Get(ctx); err != wantErr {
+		t.Errorf("got %v, want %v", err, wantErr)
+	}
+}
+
+func TestPublishAsyncOverflow(t *testing.T) {
+	for _, block := range []bool{false, true} {
+		ctx := context.Background()
+		s := &publishService{unblock: make(chan struct{})}
+		c := &Client{projectID: "projid", s: s}
+		topic := c.Topic("t")
+		topic.PublishSettings = PublishSettings{
+			CountThreshold:    1,
+			BufferedByteLimit: 10,
+			BlockOnOverflow:   block,
+		}
+
+		// The first message is stuck being published, filling the buffer.
+		r1 := topic.PublishAsync(ctx, &Message{Data: []byte("0123456789")})
+
+		done := make(chan *PublishResult)
+		go func() { done <- topic.PublishAsync(ctx, &Message{Data: []byte("x")}) }()
+		var r2 *PublishResult
+		if block {
+			select {
+			case <-done:
+				t.Fatal("PublishAsync did not block on a full buffer")
+			case <-time.After(50 * time.Millisecond):
+			}
+			s.unblock <- struct{}{}
+			r2 = <-done
+			s.unblock <- struct{}{}
+		} else {
+			r2 = <-done
+			if _, err := r2.Get(ctx); err != ErrOverflow {
+				t.Errorf("got %v, want %v", err, ErrOverflow)
+			}
+			s.unblock <- struct{}{}
+		}
+		topic.Stop()
+
+		if _, err := r1.Get(ctx); err != nil {
+			t.Errorf("block=%t: first message: %v", block, err)
+		}
+		if block {
+			if _, err := r2.Get(ctx); err != nil {
+				t.Errorf("second message: %v", err)
+			}
+		}
+	}
+}
+
+// failOnceService fails the first call to publishMessages.
+type failOnceService struct {
+	publishService
+	failed bool
+}
+
+func (s *failOnceService) publishMessages(ctx context.Context, topicName string, msgs []*Message) ([]string, error) {
+	s.mu.Lock()
+	failed := s.failed
+	s.failed = true
+	s.mu.Unlock()
+	if !failed {
+		return nil, errors.New("bang")
+	}
+	return s.publishService.publishMessages(ctx, topicName, msgs)
+}
+
+func TestPublishAsyncOrderingKeySize(t *testing.T) {
+	ctx := context.Background()
+	s := &publishService{unblock: make(chan struct{})}
+	c := &Client{projectID: "projid", s: s}
+	topic := c.Topic("t")
+	topic.PublishSettings = PublishSettings{
+		CountThreshold:    1,
+		BufferedByteLimit: 10,
+	}
+
+	// The first message is stuck being published. The second fits in the
+	// buffer only if its ordering key is not counted.
+	r1 := topic.PublishAsync(ctx, &Message{Data: []byte("a")})
+	r2 := topic.PublishAsync(ctx, &Message{Data: []byte("b"), OrderingKey: "k"})
+	if _, err := r2.Get(ctx); err != ErrOverflow {
+		t.Errorf("got %v, want %v", err, ErrOverflow)
+	}
+	s.unblock <- struct{}{}
+	topic.Stop()
+	if _, err := r1.Get(ctx); err != nil {
+		t.Errorf("first message: %v", err)
+	}
+}
+
+func TestPublishReservedAttribute(t *testing.T) {
+	ctx := context.Background()
+	s := &publishService{}
+	c := &Client{projectID: "projid", s: s}
+	topic := c.Topic("t")
+	m := &Message{Data: []byte("a"), Attributes: map[string]string{OrderingKeyAttribute: "k"}}
+	if _, err := topic.Publish(ctx, m); err != errReservedAttribute {
+		t.Errorf("Publish: got %v, want %v", err, errReservedAttribute)
+	}
+	if _, err := topic.PublishAsync(ctx, m).Get(ctx); err != errReservedAttribute {
+		t.Errorf("PublishAsync: got %v, want %v", err, errReservedAttribute)
+	}
+	topic.Stop()
+	if len(s.batches) != 0 {
+		t.Errorf("published %d batches, want none", len(s.batches))
+	}
+}
+
+func TestPublishAsyncOrderingKeys(t *testing.T) {
+	ctx := context.Background()
+	s := &failOnceService{}
+	c := &Client{projectID: "projid", s: s}
+	topic := c.Topic("t")
+	topic.PublishSettings = PublishSettings{CountThreshold: 1}
+	defer topic.Stop()
+
+	get := func(r *PublishResult) error {
+		_, err := r.Get(ctx)
+		return err
+	}
+
+	// The first message fails, pausing its key.
+	if err := get(topic.PublishAsync(ctx, &Message{Data: []byte("a1"), OrderingKey: "a"})); err == nil || err == ErrOrderingKeyPaused {
+		t.Fatalf("first message: got %v, want publish error", err)
+	}
+	if err := get(topic.PublishAsync(ctx, &Message{Data: []byte("a2"), OrderingKey: "a"})); err != ErrOrderingKeyPaused {
+		t.Errorf("paused key: got %v, want %v", err, ErrOrderingKeyPaused)
+	}
+	// Other keys, and messages without a key, are unaffected.
+	if err := get(topic.PublishAsync(ctx, &Message{Data: []byte("b1"), OrderingKey: "b"})); err != nil {
+		t.Errorf("other key: %v", err)
+	}
+	if err := get(topic.PublishAsync(ctx, &Message{Data: []byte("x")})); err != nil {
+		t.Errorf("no key: %v", err)
+	}
+
+	topic.ResumePublish("a")
+	if err := get(topic.PublishAsync(ctx, &Message{Data: []byte("a3"), OrderingKey: "a"})); err != nil {
+		t.Errorf("after ResumePublish: %v", err)
+	}
+	var got []string
+	for _, b := range s.batches {
+		for _, m := range b {
+			got = append(got, string(m.Data))
+		}
+	}
+	if want := "[b1 x a3]"; fmt.Sprint(got) != want {
+		t.Errorf("published %v, want %v", got, want)
+	}
+}
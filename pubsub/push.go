@@ -0,0 +1,207 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sync"
+
+	"golang.org/x/net/context"
+	raw "google.golang.org/api/pubsub/v1"
+)
+
+// maxPushBodySize limits the size of a push request body. Messages are at
+// most 10MB, and their data is base64-encoded in the request.
+const maxPushBodySize = 16 << 20
+
+// A PushOption is an optional argument to PushHandler.
+type PushOption interface {
+	setOptions(o *pushOptions)
+}
+
+type pushOptions struct {
+	token     string
+	attrKey   string
+	attrValue string
+	ctx       func(*http.Request) context.Context
+}
+
+type pushToken string
+
+func (t pushToken) setOptions(o *pushOptions) {
+	o.token = string(t)
+}
+
+// PushToken returns a PushOption that makes the handler reject requests whose
+// "token" query parameter is not token. Include the token in the endpoint URL
+// of the subscription's PushConfig, for example
+// "https://example.com/push?token=" + token.
+func PushToken(token string) PushOption {
+	return pushToken(token)
+}
+
+type pushSecretAttribute struct{ key, value string }
+
+func (a pushSecretAttribute) setOptions(o *pushOptions) {
+	o.attrKey = a.key
+	o.attrValue = a.value
+}
+
+// PushSecretAttribute returns a PushOption that makes the handler reject
+// messages that do not have the attribute key set to value. The attribute is
+// removed from the Attributes of the Messages passed to the handler function.
+func PushSecretAttribute(key, value string) PushOption {
+	return pushSecretAttribute{key, value}
+}
+
+type pushContext func(*http.Request) context.Context
+
+func (f pushContext) setOptions(o *pushOptions) {
+	o.ctx = f
+}
+
+// PushContext returns a PushOption that sets the function used to derive,
+// from each push request, the context passed to the handler function.
+// By default, the context is context.Background(), which is not cancelled
+// if the request is abandoned, for example when Pub/Sub times out waiting
+// for the response. Use PushContext to supply a context that is; on Go 1.7
+// and later, a function that returns r.Context() will do.
+//
+// For example, to trace the handling of push requests with the
+// cloud.google.com/go/trace package:
+//
+//	h := pubsub.PushHandler(handle, pubsub.PushContext(func(r *http.Request) context.Context {
+//	    return trace.NewContext(context.Background(), traceClient.SpanFromRequest(r))
+//	}))
+//
+// where handle calls trace.FromContext(ctx).Finish() when it returns.
+func PushContext(f func(*http.Request) context.Context) PushOption {
+	return pushContext(f)
+}
+
+// pushRequest is the body of a request from Pub/Sub to a push endpoint.
+type pushRequest struct {
+	Message      *raw.PubsubMessage `json:"message"`
+	Subscription string             `json:"subscription"`
+}
+
+// PushHandler returns an http.Handler that receives messages pushed by
+// Pub/Sub to the endpoint of a push subscription, and passes each to f.
+//
+// The message is acknowledged if f returns nil, and is redelivered later if
+// f returns an error or calls Done(false) on the message. Calling Done is
+// otherwise unnecessary. The response is sent when f returns, so Done has no
+// effect if it is called after that, for example from another goroutine.
+// Requests that can't be decoded, or that fail the checks of PushToken or
+// PushSecretAttribute, are rejected with a 4xx status; Pub/Sub redelivers
+// such messages too.
+//
+// The AckID of the messages is empty, since push messages are acknowledged
+// by the response to the request. This lets f be shared with a pull
+// subscriber, for example:
+//
+//	sub.Receive(ctx, func(ctx context.Context, m *pubsub.Message) {
+//	    m.Done(handle(ctx, m) == nil)
+//	})
+//
+// The handler is safe to use concurrently.
+func PushHandler(f func(context.Context, *Message) error, opts ...PushOption) http.Handler {
+	po := &pushOptions{
+		ctx: func(*http.Request) context.Context { return context.Background() },
+	}
+	for _, opt := range opts {
+		opt.setOptions(po)
+	}
+	return &pushHandler{f: f, po: po}
+}
+
+type pushHandler struct {
+	f  func(context.Context, *Message) error
+	po *pushOptions
+}
+
+func (h *pushHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.po.token != "" && subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("token")), []byte(h.po.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusForbidden)
+		return
+	}
+	var req pushRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxPushBodySize)).Decode(&req); err != nil {
+		http.Error(w, "invalid push request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Message == nil {
+		http.Error(w, "invalid push request: no message", http.StatusBadRequest)
+		return
+	}
+	m, err := toMessage(&raw.ReceivedMessage{Message: req.Message})
+	if err != nil {
+		http.Error(w, "invalid push request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if h.po.attrKey != "" {
+		v, ok := m.Attributes[h.po.attrKey]
+		if !ok || subtle.ConstantTimeCompare([]byte(v), []byte(h.po.attrValue)) != 1 {
+			http.Error(w, "invalid secret attribute", http.StatusForbidden)
+			return
+		}
+		delete(m.Attributes, h.po.attrKey)
+		if len(m.Attributes) == 0 {
+			m.Attributes = nil
+		}
+	}
+
+	m.push = &pushState{}
+	err = h.f(h.po.ctx(r), m)
+	if nacked := m.push.finish(); err != nil || nacked {
+		// Don't reveal the handler's error to the caller.
+		http.Error(w, "message not acknowledged", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// pushState records whether a Message received by a PushHandler was nacked.
+// Done may be called concurrently with the handler, so the fields are
+// guarded by mu.
+type pushState struct {
+	mu       sync.Mutex
+	nacked   bool
+	returned bool // the handler function has returned
+}
+
+func (p *pushState) done(ack bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.returned {
+		p.nacked = !ack
+	}
+}
+
+// finish is called when the handler function returns. It reports whether
+// the message was nacked, and makes later calls to done have no effect.
+func (p *pushState) finish() (nacked bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.returned = true
+	return p.nacked
+}
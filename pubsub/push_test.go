@@ -0,0 +1,167 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+const pushBody = `{
+  "message": {
+    "attributes": {"k": "v", "secret": "s3cr3t", "pubsub-ordering-key": "o"},
+    "data": "aGVsbG8=",
+    "messageId": "123",
+    "publishTime": "2016-10-01T12:00:00Z"
+  },
+  "subscription": "projects/p/subscriptions/s"
+}`
+
+func newPushRequest(t *testing.T, method, target, body string) *http.Request {
+	r, err := http.NewRequest(method, target, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestPushHandler(t *testing.T) {
+	var got *Message
+	h := PushHandler(func(ctx context.Context, m *Message) error {
+		got = m
+		return nil
+	}, PushSecretAttribute("secret", "s3cr3t"))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newPushRequest(t, "POST", "/push", pushBody))
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	want := &Message{
+		ID:          "123",
+		Data:        []byte("hello"),
+		Attributes:  map[string]string{"k": "v"},
+		PublishTime: time.Date(2016, 10, 1, 12, 0, 0, 0, time.UTC),
+		OrderingKey: "o",
+	}
+	got.push = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestPushHandlerStatus(t *testing.T) {
+	errFail := errors.New("internal detail")
+	for _, test := range []struct {
+		desc   string
+		method string
+		target string
+		body   string
+		f      func(context.Context, *Message) error
+		want   int
+	}{
+		{"ok", "POST", "/push?token=tok", pushBody, nil, http.StatusNoContent},
+		{"error", "POST", "/push?token=tok", pushBody, func(context.Context, *Message) error { return errFail }, http.StatusInternalServerError},
+		{"nack", "POST", "/push?token=tok", pushBody, func(_ context.Context, m *Message) error { m.Done(false); return nil }, http.StatusInternalServerError},
+		{"ack", "POST", "/push?token=tok", pushBody, func(_ context.Context, m *Message) error { m.Done(true); return nil }, http.StatusNoContent},
+		{"method", "GET", "/push?token=tok", "", nil, http.StatusMethodNotAllowed},
+		{"no token", "POST", "/push", pushBody, nil, http.StatusForbidden},
+		{"bad token", "POST", "/push?token=x", pushBody, nil, http.StatusForbidden},
+		{"bad JSON", "POST", "/push?token=tok", "{", nil, http.StatusBadRequest},
+		{"no message", "POST", "/push?token=tok", `{"subscription": "s"}`, nil, http.StatusBadRequest},
+		{"bad data", "POST", "/push?token=tok", `{"message": {"data": "!"}}`, nil, http.StatusBadRequest},
+	} {
+		called := false
+		h := PushHandler(func(ctx context.Context, m *Message) error {
+			called = true
+			if test.f != nil {
+				return test.f(ctx, m)
+			}
+			return nil
+		}, PushToken("tok"))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newPushRequest(t, test.method, test.target, test.body))
+		if w.Code != test.want {
+			t.Errorf("%s: got status %d, want %d", test.desc, w.Code, test.want)
+		}
+		if strings.Contains(w.Body.String(), errFail.Error()) {
+			t.Errorf("%s: response body %q reveals the handler's error", test.desc, w.Body)
+		}
+		if wantCalled := test.want/100 != 4; called != wantCalled {
+			t.Errorf("%s: handler called: got %t, want %t", test.desc, called, wantCalled)
+		}
+	}
+}
+
+func TestPushHandlerLateDone(t *testing.T) {
+	msgc := make(chan *Message, 1)
+	h := PushHandler(func(_ context.Context, m *Message) error {
+		msgc <- m
+		return nil
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newPushRequest(t, "POST", "/push", pushBody))
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusNoContent)
+	}
+	// Done after the handler has returned is ignored, and must not race.
+	m := <-msgc
+	donec := make(chan struct{})
+	go func() {
+		m.Done(false)
+		close(donec)
+	}()
+	<-donec
+	if m.push.finish() {
+		t.Error("late Done(false) marked the message as nacked")
+	}
+}
+
+func TestPushHandlerSecretAttribute(t *testing.T) {
+	h := PushHandler(func(context.Context, *Message) error {
+		t.Error("handler called for message without secret")
+		return nil
+	}, PushSecretAttribute("secret", "other"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, newPushRequest(t, "POST", "/push", pushBody))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+type pushCtxKey struct{}
+
+func TestPushContext(t *testing.T) {
+	var got interface{}
+	h := PushHandler(func(ctx context.Context, m *Message) error {
+		got = ctx.Value(pushCtxKey{})
+		return nil
+	}, PushContext(func(r *http.Request) context.Context {
+		return context.WithValue(context.Background(), pushCtxKey{}, r.Header.Get("X-Cloud-Trace-Context"))
+	}))
+	r := newPushRequest(t, "POST", "/push", pushBody)
+	r.Header.Set("X-Cloud-Trace-Context", "105445aa7843bc8bf206b120001000/0;o=1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if want := "105445aa7843bc8bf206b120001000/0;o=1"; got != want {
+		t.Errorf("context value: got %v, want %q", got, want)
+	}
+}
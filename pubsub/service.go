@@ -18,6 +18,8 @@ import (
 	"encoding/base64"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
@@ -30,12 +32,15 @@ import (
 // The single implementation, *apiService, contains all the knowledge
 // of the generated PubSub API (except for that present in legacy code).
 type service interface {
-	createSubscription(ctx context.Context, topicName, subName string, ackDeadline time.Duration, pushConfig *PushConfig) error
+	createSubscription(ctx context.Context, subName string, cfg *SubscriptionConfig) error
 	getSubscriptionConfig(ctx context.Context, subName string) (*SubscriptionConfig, string, error)
 	listProjectSubscriptions(ctx context.Context, projName, pageTok string) (*stringsPage, error)
 	deleteSubscription(ctx context.Context, name string) error
 	subscriptionExists(ctx context.Context, name string) (bool, error)
 	modifyPushConfig(ctx context.Context, subName string, conf *PushConfig) error
+	updateSubscription(ctx context.Context, subName string, cfg *SubscriptionConfigToUpdate) (*SubscriptionConfig, string, error)
+	seekToTime(ctx context.Context, subName string, t time.Time) error
+	seekToSnapshot(ctx context.Context, subName, snapName string) error
 
 	createTopic(ctx context.Context, name string) error
 	deleteTopic(ctx context.Context, name string) error
@@ -43,6 +48,10 @@ type service interface {
 	listProjectTopics(ctx context.Context, projName, pageTok string) (*stringsPage, error)
 	listTopicSubscriptions(ctx context.Context, topicName, pageTok string) (*stringsPage, error)
 
+	createSnapshot(ctx context.Context, snapName, subName string) (*snapshotInfo, error)
+	deleteSnapshot(ctx context.Context, snapName string) error
+	listProjectSnapshots(ctx context.Context, projName, pageTok string) (*snapshotPage, error)
+
 	modifyAckDeadline(ctx context.Context, subName string, deadline time.Duration, ackIDs []string) error
 	fetchMessages(ctx context.Context, subName string, maxMessages int64) ([]*Message, error)
 	publishMessages(ctx context.Context, topicName string, msgs []*Message) ([]string, error)
@@ -55,6 +64,11 @@ type service interface {
 
 	// acknowledge ACKs the IDs in ackIDs.
 	acknowledge(ctx context.Context, subName string, ackIDs []string) error
+
+	// The IAM methods take the name of a topic or subscription.
+	getIAMPolicy(ctx context.Context, resource string) (*IAMPolicy, error)
+	setIAMPolicy(ctx context.Context, resource string, p *IAMPolicy) (*IAMPolicy, error)
+	testIAMPermissions(ctx context.Context, resource string, permissions []string) ([]string, error)
 }
 
 type apiService struct {
@@ -71,18 +85,24 @@ func newPubSubService(client *http.Client, endpoint string) (*apiService, error)
 	return &apiService{s: s}, nil
 }
 
-func (s *apiService) createSubscription(ctx context.Context, topicName, subName string, ackDeadline time.Duration, pushConfig *PushConfig) error {
+func (s *apiService) createSubscription(ctx context.Context, subName string, cfg *SubscriptionConfig) error {
+	// A zero PushConfig is omitted from the request, whether or not the
+	// caller passed one explicitly to NewSubscription.
 	var rawPushConfig *raw.PushConfig
-	if pushConfig != nil {
+	if cfg.PushConfig.Endpoint != "" || len(cfg.PushConfig.Attributes) != 0 {
 		rawPushConfig = &raw.PushConfig{
-			Attributes:   pushConfig.Attributes,
-			PushEndpoint: pushConfig.Endpoint,
+			Attributes:   cfg.PushConfig.Attributes,
+			PushEndpoint: cfg.PushConfig.Endpoint,
 		}
 	}
 	rawSub := &raw.Subscription{
-		AckDeadlineSeconds: int64(ackDeadline.Seconds()),
-		PushConfig:         rawPushConfig,
-		Topic:              topicName,
+		AckDeadlineSeconds:  int64(cfg.AckDeadline.Seconds()),
+		PushConfig:          rawPushConfig,
+		Topic:               cfg.Topic.Name(),
+		RetainAckedMessages: cfg.RetainAckedMessages,
+	}
+	if cfg.MessageRetentionDuration != 0 {
+		rawSub.MessageRetentionDuration = formatDuration(cfg.MessageRetentionDuration)
 	}
 	_, err := s.s.Projects.Subscriptions.Create(subName, rawSub).Context(ctx).Do()
 	return err
@@ -93,14 +113,138 @@ func (s *apiService) getSubscriptionConfig(ctx context.Context, subName string)
 	if err != nil {
 		return nil, "", err
 	}
+	return toSubscriptionConfig(rawSub)
+}
+
+// toSubscriptionConfig converts rawSub to a SubscriptionConfig, also returning
+// the name of its topic.
+func toSubscriptionConfig(rawSub *raw.Subscription) (*SubscriptionConfig, string, error) {
 	sub := &SubscriptionConfig{
-		AckDeadline: time.Second * time.Duration(rawSub.AckDeadlineSeconds),
-		PushConfig: PushConfig{
+		AckDeadline:         time.Second * time.Duration(rawSub.AckDeadlineSeconds),
+		RetainAckedMessages: rawSub.RetainAckedMessages,
+	}
+	if rawSub.PushConfig != nil {
+		sub.PushConfig = PushConfig{
 			Endpoint:   rawSub.PushConfig.PushEndpoint,
 			Attributes: rawSub.PushConfig.Attributes,
-		},
+		}
+	}
+	if rawSub.MessageRetentionDuration != "" {
+		d, err := time.ParseDuration(rawSub.MessageRetentionDuration)
+		if err != nil {
+			return nil, "", fmt.Errorf("pubsub: cannot parse message retention duration %q: %v", rawSub.MessageRetentionDuration, err)
+		}
+		sub.MessageRetentionDuration = d
+	}
+	return sub, rawSub.Topic, nil
+}
+
+func (s *apiService) updateSubscription(ctx context.Context, subName string, cfg *SubscriptionConfigToUpdate) (*SubscriptionConfig, string, error) {
+	rawSub := &raw.Subscription{Name: subName}
+	var paths []string
+	if cfg.PushConfig != nil {
+		rawSub.PushConfig = &raw.PushConfig{
+			Attributes:   cfg.PushConfig.Attributes,
+			PushEndpoint: cfg.PushConfig.Endpoint,
+		}
+		paths = append(paths, "push_config")
+	}
+	if cfg.AckDeadline != 0 {
+		rawSub.AckDeadlineSeconds = int64(cfg.AckDeadline.Seconds())
+		paths = append(paths, "ack_deadline_seconds")
+	}
+	if cfg.RetainAckedMessages != nil {
+		rawSub.RetainAckedMessages = *cfg.RetainAckedMessages
+		// Send the field even if it is false.
+		rawSub.ForceSendFields = append(rawSub.ForceSendFields, "RetainAckedMessages")
+		paths = append(paths, "retain_acked_messages")
+	}
+	if cfg.MessageRetentionDuration != 0 {
+		rawSub.MessageRetentionDuration = formatDuration(cfg.MessageRetentionDuration)
+		paths = append(paths, "message_retention_duration")
+	}
+	req := &raw.UpdateSubscriptionRequest{
+		Subscription: rawSub,
+		UpdateMask:   strings.Join(paths, ","),
+	}
+	rawSub, err := s.s.Projects.Subscriptions.Patch(subName, req).Context(ctx).Do()
+	if err != nil {
+		return nil, "", err
+	}
+	return toSubscriptionConfig(rawSub)
+}
+
+// formatDuration formats d in the JSON representation of a
+// google.protobuf.Duration, such as "3.5s".
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+func (s *apiService) seekToTime(ctx context.Context, subName string, t time.Time) error {
+	req := &raw.SeekRequest{Time: t.UTC().Format(time.RFC3339Nano)}
+	_, err := s.s.Projects.Subscriptions.Seek(subName, req).Context(ctx).Do()
+	return err
+}
+
+func (s *apiService) seekToSnapshot(ctx context.Context, subName, snapName string) error {
+	req := &raw.SeekRequest{Snapshot: snapName}
+	_, err := s.s.Projects.Subscriptions.Seek(subName, req).Context(ctx).Do()
+	return err
+}
+
+// snapshotInfo describes a snapshot as returned by the service.
+type snapshotInfo struct {
+	name       string
+	topicName  string
+	expiration time.Time
+}
+
+// snapshotPage contains a list of snapshots and a token for fetching the next page.
+type snapshotPage struct {
+	snaps []*snapshotInfo
+	tok   string
+}
+
+func toSnapshotInfo(rawSnap *raw.Snapshot) (*snapshotInfo, error) {
+	info := &snapshotInfo{name: rawSnap.Name, topicName: rawSnap.Topic}
+	if rawSnap.ExpireTime != "" {
+		exp, err := time.Parse(time.RFC3339, rawSnap.ExpireTime)
+		if err != nil {
+			return nil, err
+		}
+		info.expiration = exp
+	}
+	return info, nil
+}
+
+func (s *apiService) createSnapshot(ctx context.Context, snapName, subName string) (*snapshotInfo, error) {
+	req := &raw.CreateSnapshotRequest{Subscription: subName}
+	rawSnap, err := s.s.Projects.Snapshots.Create(snapName, req).Context(ctx).Do()
+	if err != nil {
+		return nil, err
 	}
-	return sub, rawSub.Topic, err
+	return toSnapshotInfo(rawSnap)
+}
+
+func (s *apiService) deleteSnapshot(ctx context.Context, snapName string) error {
+	_, err := s.s.Projects.Snapshots.Delete(snapName).Context(ctx).Do()
+	return err
+}
+
+func (s *apiService) listProjectSnapshots(ctx context.Context, projName, pageTok string) (*snapshotPage, error) {
+	resp, err := s.s.Projects.Snapshots.List(projName).PageToken(pageTok).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	snaps := []*snapshotInfo{}
+	for _, rawSnap := range resp.Snapshots {
+		info, err := toSnapshotInfo(rawSnap)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: cannot decode snapshot %q: %v", rawSnap.Name, err)
+		}
+		snaps = append(snaps, info)
+	}
+	return &snapshotPage{snaps, resp.NextPageToken}, nil
 }
 
 // stringsPage contains a list of strings and a token for fetching the next page.
@@ -254,7 +398,7 @@ func (s *apiService) publishMessages(ctx context.Context, topicName string, msgs
 	for i, msg := range msgs {
 		rawMsgs[i] = &raw.PubsubMessage{
 			Data:       base64.StdEncoding.EncodeToString(msg.Data),
-			Attributes: msg.Attributes,
+			Attributes: msg.rawAttributes(),
 		}
 	}
 
@@ -281,3 +425,79 @@ func (s *apiService) modifyPushConfig(ctx context.Context, subName string, conf
 		Do()
 	return err
 }
+
+// isTopicName reports whether name is the name of a topic, rather than of a subscription.
+func isTopicName(name string) bool {
+	return strings.Contains(name, "/topics/")
+}
+
+func (s *apiService) getIAMPolicy(ctx context.Context, resource string) (*IAMPolicy, error) {
+	var (
+		rawPolicy *raw.Policy
+		err       error
+	)
+	if isTopicName(resource) {
+		rawPolicy, err = s.s.Projects.Topics.GetIamPolicy(resource).Context(ctx).Do()
+	} else {
+		rawPolicy, err = s.s.Projects.Subscriptions.GetIamPolicy(resource).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toIAMPolicy(rawPolicy), nil
+}
+
+func (s *apiService) setIAMPolicy(ctx context.Context, resource string, p *IAMPolicy) (*IAMPolicy, error) {
+	rawPolicy := &raw.Policy{Etag: p.etag}
+	for _, r := range p.Roles() {
+		rawPolicy.Bindings = append(rawPolicy.Bindings, &raw.Binding{
+			Role:    string(r),
+			Members: p.Members(r),
+		})
+	}
+	req := &raw.SetIamPolicyRequest{Policy: rawPolicy}
+	var err error
+	if isTopicName(resource) {
+		rawPolicy, err = s.s.Projects.Topics.SetIamPolicy(resource, req).Context(ctx).Do()
+	} else {
+		rawPolicy, err = s.s.Projects.Subscriptions.SetIamPolicy(resource, req).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return toIAMPolicy(rawPolicy), nil
+}
+
+func toIAMPolicy(rawPolicy *raw.Policy) *IAMPolicy {
+	p := &IAMPolicy{etag: rawPolicy.Etag}
+	for _, b := range rawPolicy.Bindings {
+		for _, m := range b.Members {
+			p.Add(m, IAMRole(b.Role))
+		}
+	}
+	return p
+}
+
+func (s *apiService) testIAMPermissions(ctx context.Context, resource string, permissions []string) ([]string, error) {
+	req := &raw.TestIamPermissionsRequest{Permissions: permissions}
+	var (
+		resp *raw.TestIamPermissionsResponse
+		err  error
+	)
+	if isTopicName(resource) {
+		resp, err = s.s.Projects.Topics.TestIamPermissions(resource, req).Context(ctx).Do()
+	} else {
+		resp, err = s.s.Projects.Subscriptions.TestIamPermissions(resource, req).Context(ctx).Do()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Permissions, nil
+}
+
+// isConcurrentModification reports whether err is the error returned by
+// setIAMPolicy when the policy's etag does not match the current policy.
+func isConcurrentModification(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	return ok && e.Code == http.StatusConflict
+}
@@ -0,0 +1,126 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Snapshot is a reference to a PubSub snapshot. A snapshot captures the
+// acknowledgement state of a subscription, so that the subscription, or
+// another subscription to the same topic, can later be returned to that state
+// with SeekToSnapshot.
+type Snapshot struct {
+	s service
+
+	// The fully qualified identifier for the snapshot, in the format "projects/<projid>/snapshots/<name>"
+	name string
+}
+
+// Snapshot creates a reference to a snapshot.
+func (c *Client) Snapshot(name string) *Snapshot {
+	return &Snapshot{
+		s:    c.s,
+		name: fmt.Sprintf("projects/%s/snapshots/%s", c.projectID, name),
+	}
+}
+
+// Name returns the globally unique name for the snapshot.
+func (snap *Snapshot) Name() string {
+	return snap.name
+}
+
+// Delete deletes the snapshot.
+func (snap *Snapshot) Delete(ctx context.Context) error {
+	return snap.s.deleteSnapshot(ctx, snap.name)
+}
+
+// SnapshotConfig contains the details of a snapshot.
+type SnapshotConfig struct {
+	*Snapshot
+
+	// The topic of the subscription from which the snapshot was created.
+	Topic *Topic
+
+	// The time after which the server may delete the snapshot.
+	Expiration time.Time
+}
+
+func toSnapshotConfig(s service, info *snapshotInfo) *SnapshotConfig {
+	return &SnapshotConfig{
+		Snapshot:   &Snapshot{s: s, name: info.name},
+		Topic:      &Topic{s: s, name: info.topicName},
+		Expiration: info.expiration,
+	}
+}
+
+// CreateSnapshot creates a snapshot of the subscription's acknowledgement
+// state, with the given name, in the subscription's project. The name must
+// satisfy the same restrictions as topic names; see Client.NewTopic.
+// If the snapshot already exists an error will be returned.
+func (s *Subscription) CreateSnapshot(ctx context.Context, name string) (*SnapshotConfig, error) {
+	// s.name has the form "projects/<projid>/subscriptions/<name>".
+	proj := strings.SplitN(s.name, "/", 3)[1]
+	snapName := fmt.Sprintf("projects/%s/snapshots/%s", proj, name)
+	info, err := s.s.createSnapshot(ctx, snapName, s.name)
+	if err != nil {
+		return nil, err
+	}
+	return toSnapshotConfig(s.s, info), nil
+}
+
+// Snapshots returns an iterator which returns all of the snapshots for the client's project.
+func (c *Client) Snapshots(ctx context.Context) *SnapshotConfigIterator {
+	return &SnapshotConfigIterator{
+		s:   c.s,
+		ctx: ctx,
+		fetch: func(ctx context.Context, tok string) (*snapshotPage, error) {
+			return c.s.listProjectSnapshots(ctx, c.fullyQualifiedProjectName(), tok)
+		},
+	}
+}
+
+// SnapshotConfigIterator is an iterator that returns a series of snapshots.
+type SnapshotConfigIterator struct {
+	s     service
+	ctx   context.Context
+	snaps []*snapshotInfo
+	token pageToken
+	fetch func(ctx context.Context, tok string) (*snapshotPage, error)
+}
+
+// Next returns the next snapshot. If there are no more snapshots, Done will be returned.
+func (snaps *SnapshotConfigIterator) Next() (*SnapshotConfig, error) {
+	for len(snaps.snaps) == 0 && snaps.token.more() {
+		page, err := snaps.fetch(snaps.ctx, snaps.token.get())
+		if err != nil {
+			return nil, err
+		}
+		snaps.token.set(page.tok)
+		snaps.snaps = page.snaps
+	}
+
+	if len(snaps.snaps) == 0 {
+		return nil, Done
+	}
+
+	info := snaps.snaps[0]
+	snaps.snaps = snaps.snaps[1:]
+	return toSnapshotConfig(snaps.s, info), nil
+}
@@ -0,0 +1,192 @@
+// Copyright 2016 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pubsub
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func TestCreateSubscriptionRetention(t *testing.T) {
+	c, rs, done := newRESTClient(t, `{}`, `{}`)
+	defer done()
+
+	ctx := context.Background()
+	_, err := c.CreateSubscription(ctx, "s", SubscriptionConfig{
+		Topic:                    c.Topic("t"),
+		RetainAckedMessages:      true,
+		MessageRetentionDuration: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NewSubscription(ctx, "s2", c.Topic("t"), 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []restCall{
+		{
+			method: "PUT",
+			path:   "/v1/projects/P/subscriptions/s",
+			body: map[string]interface{}{
+				"topic":                    "projects/P/topics/t",
+				"ackDeadlineSeconds":       float64(10),
+				"retainAckedMessages":      true,
+				"messageRetentionDuration": "86400s",
+			},
+		},
+		{
+			method: "PUT",
+			path:   "/v1/projects/P/subscriptions/s2",
+			body: map[string]interface{}{
+				"topic":              "projects/P/topics/t",
+				"ackDeadlineSeconds": float64(10),
+			},
+		},
+	}
+	if !reflect.DeepEqual(rs.calls, want) {
+		t.Errorf("got calls %+v, want %+v", rs.calls, want)
+	}
+}
+
+func TestUpdateSubscription(t *testing.T) {
+	c, rs, done := newRESTClient(t, `{
+		"name": "projects/P/subscriptions/s",
+		"topic": "projects/P/topics/t",
+		"ackDeadlineSeconds": 30,
+		"retainAckedMessages": false,
+		"messageRetentionDuration": "3600.5s"
+	}`)
+	defer done()
+
+	retain := false
+	conf, err := c.Subscription("s").Update(context.Background(), SubscriptionConfigToUpdate{
+		AckDeadline:              30 * time.Second,
+		RetainAckedMessages:      &retain,
+		MessageRetentionDuration: time.Hour + 500*time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Topic.Name() != "projects/P/topics/t" || conf.AckDeadline != 30*time.Second ||
+		conf.RetainAckedMessages || conf.MessageRetentionDuration != time.Hour+500*time.Millisecond {
+		t.Errorf("got config %+v", conf)
+	}
+
+	want := restCall{
+		method: "PATCH",
+		path:   "/v1/projects/P/subscriptions/s",
+		body: map[string]interface{}{
+			"subscription": map[string]interface{}{
+				"name":                     "projects/P/subscriptions/s",
+				"ackDeadlineSeconds":       float64(30),
+				"retainAckedMessages":      false,
+				"messageRetentionDuration": "3600.5s",
+			},
+			"updateMask": "ack_deadline_seconds,retain_acked_messages,message_retention_duration",
+		},
+	}
+	if len(rs.calls) != 1 || !reflect.DeepEqual(rs.calls[0], want) {
+		t.Errorf("got calls %+v, want %+v", rs.calls, want)
+	}
+
+	if _, err := c.Subscription("s").Update(context.Background(), SubscriptionConfigToUpdate{}); err == nil {
+		t.Error("empty update: got nil, want error")
+	}
+}
+
+func TestSeek(t *testing.T) {
+	c, rs, done := newRESTClient(t, `{}`, `{}`)
+	defer done()
+
+	ctx := context.Background()
+	sub := c.Subscription("s")
+	if err := sub.SeekToTime(ctx, time.Date(2016, 10, 1, 12, 0, 0, 5e8, time.UTC)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.SeekToSnapshot(ctx, c.Snapshot("snap")); err != nil {
+		t.Fatal(err)
+	}
+	want := []restCall{
+		{
+			method: "POST",
+			path:   "/v1/projects/P/subscriptions/s:seek",
+			body:   map[string]interface{}{"time": "2016-10-01T12:00:00.5Z"},
+		},
+		{
+			method: "POST",
+			path:   "/v1/projects/P/subscriptions/s:seek",
+			body:   map[string]interface{}{"snapshot": "projects/P/snapshots/snap"},
+		},
+	}
+	if !reflect.DeepEqual(rs.calls, want) {
+		t.Errorf("got calls %+v, want %+v", rs.calls, want)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	c, rs, done := newRESTClient(t,
+		`{"name": "projects/P/snapshots/a", "topic": "projects/P/topics/t", "expireTime": "2016-10-08T12:00:00Z"}`,
+		`{"snapshots": [{"name": "projects/P/snapshots/a", "topic": "projects/P/topics/t"}], "nextPageToken": "x"}`,
+		`{"snapshots": [{"name": "projects/P/snapshots/b", "topic": "projects/P/topics/u"}]}`,
+		`{}`)
+	defer done()
+
+	ctx := context.Background()
+	conf, err := c.Subscription("s").CreateSnapshot(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Name() != "projects/P/snapshots/a" || conf.Topic.Name() != "projects/P/topics/t" ||
+		!conf.Expiration.Equal(time.Date(2016, 10, 8, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("CreateSnapshot: got %+v", conf)
+	}
+
+	var got []string
+	it := c.Snapshots(ctx)
+	for {
+		conf, err := it.Next()
+		if err == Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, conf.Name()+" "+conf.Topic.Name())
+	}
+	if want := []string{"projects/P/snapshots/a projects/P/topics/t", "projects/P/snapshots/b projects/P/topics/u"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshots: got %v, want %v", got, want)
+	}
+
+	if err := c.Snapshot("a").Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []restCall{
+		{
+			method: "PUT",
+			path:   "/v1/projects/P/snapshots/a",
+			body:   map[string]interface{}{"subscription": "projects/P/subscriptions/s"},
+		},
+		{method: "GET", path: "/v1/projects/P/snapshots"},
+		{method: "GET", path: "/v1/projects/P/snapshots", pageToken: "x"},
+		{method: "DELETE", path: "/v1/projects/P/snapshots/a"},
+	}
+	if !reflect.DeepEqual(rs.calls, want) {
+		t.Errorf("got calls %+v, want %+v", rs.calls, want)
+	}
+}
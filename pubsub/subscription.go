@@ -17,6 +17,7 @@ package pubsub
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"golang.org/x/net/context"
@@ -28,6 +29,17 @@ const DefaultMaxExtension = 10 * time.Minute
 // The default maximum number of messages that are prefetched from the server.
 const DefaultMaxPrefetch = 100
 
+// The default maximum number of messages that Receive passes to its callback
+// without their being Done.
+const DefaultMaxOutstandingMessages = 1000
+
+// The default maximum total size, in bytes, of the data of the messages that
+// Receive passes to its callback without their being Done.
+const DefaultMaxOutstandingBytes = 1e9
+
+// The default number of goroutines with which Receive calls its callback.
+const DefaultNumGoroutines = 10
+
 // Subscription is a reference to a PubSub subscription.
 type Subscription struct {
 	s service
@@ -89,7 +101,10 @@ type PushConfig struct {
 
 // Subscription config contains the configuration of a subscription.
 type SubscriptionConfig struct {
-	Topic      *Topic
+	Topic *Topic
+
+	// The push configuration of the subscription. A zero PushConfig, with
+	// no Endpoint or Attributes, makes a pull subscription.
 	PushConfig PushConfig
 
 	// The default maximum time after a subscriber receives a message
@@ -98,6 +113,32 @@ type SubscriptionConfig struct {
 	// within this deadline, as the deadline will be automatically
 	// extended.
 	AckDeadline time.Duration
+
+	// Whether to retain acknowledged messages. If true, acknowledged messages
+	// will not be expunged until they fall out of the MessageRetentionDuration
+	// window, so that they can be replayed with SeekToTime or SeekToSnapshot.
+	RetainAckedMessages bool
+
+	// How long to retain messages in the backlog, from the time of publish.
+	// If RetainAckedMessages is true, this also applies to acknowledged
+	// messages.
+	MessageRetentionDuration time.Duration
+}
+
+// SubscriptionConfigToUpdate describes how to update a subscription.
+// Only the fields that are set are changed.
+type SubscriptionConfigToUpdate struct {
+	// If non-nil, the push config is changed.
+	PushConfig *PushConfig
+
+	// If non-zero, the ack deadline is changed.
+	AckDeadline time.Duration
+
+	// If non-nil, whether acknowledged messages are retained is changed.
+	RetainAckedMessages *bool
+
+	// If non-zero, the message retention duration is changed.
+	MessageRetentionDuration time.Duration
 }
 
 // Delete deletes the subscription.
@@ -123,6 +164,39 @@ func (s *Subscription) Config(ctx context.Context) (*SubscriptionConfig, error)
 	return conf, nil
 }
 
+// Update changes the configuration of the subscription as described by cfg,
+// and returns the new configuration.
+func (s *Subscription) Update(ctx context.Context, cfg SubscriptionConfigToUpdate) (*SubscriptionConfig, error) {
+	if cfg.PushConfig == nil && cfg.AckDeadline == 0 && cfg.RetainAckedMessages == nil && cfg.MessageRetentionDuration == 0 {
+		return nil, errors.New("pubsub: Update: no fields to update")
+	}
+	conf, topicName, err := s.s.updateSubscription(ctx, s.name, &cfg)
+	if err != nil {
+		return nil, err
+	}
+	conf.Topic = &Topic{
+		s:    s.s,
+		name: topicName,
+	}
+	return conf, nil
+}
+
+// SeekToTime marks as acknowledged the messages of the subscription that
+// were published before t, and marks as unacknowledged those published at or
+// after t. Acknowledged messages can only be replayed if they are retained;
+// see SubscriptionConfig.RetainAckedMessages.
+func (s *Subscription) SeekToTime(ctx context.Context, t time.Time) error {
+	return s.s.seekToTime(ctx, s.name, t)
+}
+
+// SeekToSnapshot restores the subscription's acknowledgement state to that
+// captured by snap, which must have been created from a subscription to the
+// same topic. Messages retained since the snapshot was created are marked as
+// unacknowledged, unless they had been acknowledged at the time.
+func (s *Subscription) SeekToSnapshot(ctx context.Context, snap *Snapshot) error {
+	return s.s.seekToSnapshot(ctx, s.name, snap.name)
+}
+
 // Pull returns an Iterator that can be used to fetch Messages. The Iterator
 // will automatically extend the ack deadline of all fetched Messages, for the
 // period specified by DefaultMaxExtension. This may be overridden by supplying
@@ -142,6 +216,151 @@ func (s *Subscription) Pull(ctx context.Context, opts ...PullOption) (*Iterator,
 	return newIterator(ctx, s.s, s.name, po), nil
 }
 
+// Receive calls f with the messages from the subscription, from a pool of
+// goroutines whose size may be set with the NumGoroutines pull option. As with
+// Pull, the ack deadlines of the messages are automatically extended.
+//
+// f must call Message.Done on each Message it is passed, though it may do so
+// after returning. Receive applies flow control: it stops passing messages to
+// f while the number of Messages that are not yet Done, or the total size of
+// their data, is at the limit set by the MaxOutstandingMessages or
+// MaxOutstandingBytes pull option.
+//
+// Receive blocks until ctx is done, or until an unrecoverable error occurs,
+// which it returns. Once ctx is done, Receive passes no more messages to f,
+// and returns nil after all calls to f have returned and all the Messages
+// passed to f are Done. Acks and deadline extensions are not sent with ctx, so
+// that the Messages still being processed when ctx is done can be acked.
+//
+// Receive never calls f concurrently for Messages with the same non-empty
+// OrderingKey; it passes them to f one after another, in the order in which
+// they arrived. Pub/Sub does not guarantee that this is the order in which
+// they were published.
+func (s *Subscription) Receive(ctx context.Context, f func(context.Context, *Message), opts ...PullOption) error {
+	config, err := s.Config(ctx)
+	if err != nil {
+		return err
+	}
+	po := processPullOptions(opts)
+	po.ackDeadline = config.AckDeadline
+	return receive(ctx, s.s, s.name, po, f)
+}
+
+// receive implements Subscription.Receive.
+func receive(ctx context.Context, s service, subName string, po *pullOptions, f func(context.Context, *Message)) error {
+	it := newIterator(context.Background(), s, subName, po)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopped := make(chan struct{})
+	go func() {
+		<-ctx.Done()
+		// Unblock any pending call to Next, and wait for the outstanding
+		// messages to be Done.
+		it.Stop()
+		close(stopped)
+	}()
+
+	msgs := make(chan *Message)
+	kq := &keyQueues{queues: make(map[string][]*Message)}
+	var wg sync.WaitGroup
+	for i := 0; i < po.numGoroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for m := range msgs {
+				// Process m, then any messages with the same ordering key
+				// that arrived in the meantime.
+				for ; m != nil; m = kq.next(m) {
+					if ctx.Err() != nil {
+						m.Done(false)
+						continue
+					}
+					f(ctx, m)
+				}
+			}
+		}()
+	}
+
+	fc := newFlowController(po.maxOutstandingMessages, po.maxOutstandingBytes)
+	var err error
+	for err == nil {
+		var m *Message
+		m, err = it.Next()
+		if err != nil {
+			break
+		}
+		size := len(m.Data)
+		if err = fc.acquire(ctx, size); err != nil {
+			m.Done(false)
+			break
+		}
+		m.release = func() { fc.release(size) }
+		if !kq.add(m) {
+			// m will be processed after the message ahead of it.
+			continue
+		}
+		select {
+		case msgs <- m:
+		case <-ctx.Done():
+			m.Done(false)
+			err = ctx.Err()
+		}
+	}
+	if ctx.Err() != nil {
+		// Stopping the iterator, or ctx itself, caused the error.
+		err = nil
+	}
+
+	close(msgs)
+	wg.Wait()
+	cancel()
+	<-stopped
+	return err
+}
+
+// keyQueues serializes the processing of messages with the same ordering key.
+type keyQueues struct {
+	mu sync.Mutex
+	// An ordering key is present while a message with the key is being
+	// processed. Its value holds the messages with the key that are
+	// waiting to be processed, in order.
+	queues map[string][]*Message
+}
+
+// add reports whether m may be processed now. If not, m is queued behind
+// the message with the same ordering key that is being processed.
+func (q *keyQueues) add(m *Message) bool {
+	if m.OrderingKey == "" {
+		return true
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if queue, ok := q.queues[m.OrderingKey]; ok {
+		q.queues[m.OrderingKey] = append(queue, m)
+		return false
+	}
+	q.queues[m.OrderingKey] = nil
+	return true
+}
+
+// next is called once the processing of m is finished. It returns the
+// next message with m's ordering key to process, or nil if there is none.
+func (q *keyQueues) next(m *Message) *Message {
+	if m.OrderingKey == "" {
+		return nil
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	queue := q.queues[m.OrderingKey]
+	if len(queue) == 0 {
+		delete(q.queues, m.OrderingKey)
+		return nil
+	}
+	q.queues[m.OrderingKey] = queue[1:]
+	return queue[0]
+}
+
 // ModifyPushConfig updates the endpoint URL and other attributes of a push subscription.
 func (s *Subscription) ModifyPushConfig(ctx context.Context, conf *PushConfig) error {
 	if conf == nil {
@@ -151,7 +370,7 @@ func (s *Subscription) ModifyPushConfig(ctx context.Context, conf *PushConfig) e
 	return s.s.modifyPushConfig(ctx, s.name, conf)
 }
 
-// A PullOption is an optional argument to Subscription.Pull.
+// A PullOption is an optional argument to Subscription.Pull or Subscription.Receive.
 type PullOption interface {
 	setOptions(o *pullOptions)
 }
@@ -168,12 +387,32 @@ type pullOptions struct {
 	// ackDeadline is the default ack deadline for the subscription.  Not
 	// configurable via a PullOption.
 	ackDeadline time.Duration
+
+	// deadLetter, if non-nil, is the policy for messages that repeatedly
+	// fail to be processed.
+	deadLetter *DeadLetterPolicy
+
+	// The following are used only by Receive.
+
+	// maxOutstandingMessages is the maximum number of Messages passed to
+	// the callback that are not yet Done.
+	maxOutstandingMessages int
+
+	// maxOutstandingBytes is the maximum total size of the data of the
+	// Messages passed to the callback that are not yet Done.
+	maxOutstandingBytes int
+
+	// numGoroutines is the number of goroutines that call the callback.
+	numGoroutines int
 }
 
 func processPullOptions(opts []PullOption) *pullOptions {
 	po := &pullOptions{
-		maxExtension: DefaultMaxExtension,
-		maxPrefetch:  DefaultMaxPrefetch,
+		maxExtension:           DefaultMaxExtension,
+		maxPrefetch:            DefaultMaxPrefetch,
+		maxOutstandingMessages: DefaultMaxOutstandingMessages,
+		maxOutstandingBytes:    DefaultMaxOutstandingBytes,
+		numGoroutines:          DefaultNumGoroutines,
 	}
 
 	for _, o := range opts {
@@ -220,6 +459,56 @@ func MaxExtension(duration time.Duration) PullOption {
 	return maxExtension(duration)
 }
 
+type maxOutstandingMessages int
+
+func (max maxOutstandingMessages) setOptions(o *pullOptions) {
+	o.maxOutstandingMessages = int(max)
+}
+
+// MaxOutstandingMessages returns a PullOption that limits the number of
+// Messages that Subscription.Receive passes to its callback without their
+// being Done. If num is less than 1, the number is not limited.
+//
+// MaxOutstandingMessages has no effect on Subscription.Pull.
+func MaxOutstandingMessages(num int) PullOption {
+	return maxOutstandingMessages(num)
+}
+
+type maxOutstandingBytes int
+
+func (max maxOutstandingBytes) setOptions(o *pullOptions) {
+	o.maxOutstandingBytes = int(max)
+}
+
+// MaxOutstandingBytes returns a PullOption that limits the total size of the
+// data of the Messages that Subscription.Receive passes to its callback
+// without their being Done. A single Message larger than the limit is passed
+// to the callback once no other Messages are outstanding. If bytes is less
+// than 1, the size is not limited.
+//
+// MaxOutstandingBytes has no effect on Subscription.Pull.
+func MaxOutstandingBytes(bytes int) PullOption {
+	return maxOutstandingBytes(bytes)
+}
+
+type numGoroutines int
+
+func (num numGoroutines) setOptions(o *pullOptions) {
+	if o.numGoroutines = int(num); o.numGoroutines < 1 {
+		o.numGoroutines = 1
+	}
+}
+
+// NumGoroutines returns a PullOption that sets the number of goroutines with
+// which Subscription.Receive calls its callback.
+//
+// If num is less than 1, it will be treated as if it were 1.
+//
+// NumGoroutines has no effect on Subscription.Pull.
+func NumGoroutines(num int) PullOption {
+	return numGoroutines(num)
+}
+
 // NewSubscription creates a new subscription to a topic.
 //
 // name is the name of the subscription to create. It must start with a letter,
@@ -239,17 +528,38 @@ func MaxExtension(duration time.Duration) PullOption {
 // within this deadline, as the deadline will be automatically extended.
 //
 // pushConfig may be set to configure this subscription for push delivery.
+// A pushConfig with no Endpoint or Attributes is treated like nil: it is not
+// sent to the server, and the subscription is a pull subscription.
 //
 // If the subscription already exists an error will be returned.
+//
+// To set other properties of the subscription, use CreateSubscription.
 func (c *Client) NewSubscription(ctx context.Context, name string, topic *Topic, ackDeadline time.Duration, pushConfig *PushConfig) (*Subscription, error) {
-	if ackDeadline == 0 {
-		ackDeadline = 10 * time.Second
+	cfg := SubscriptionConfig{Topic: topic, AckDeadline: ackDeadline}
+	if pushConfig != nil {
+		cfg.PushConfig = *pushConfig
+	}
+	return c.CreateSubscription(ctx, name, cfg)
+}
+
+// CreateSubscription creates a new subscription with the given name, as
+// described by cfg. cfg.Topic is required; the name and AckDeadline are
+// subject to the same restrictions as for NewSubscription. If
+// cfg.MessageRetentionDuration is zero, the server's default is used.
+//
+// If the subscription already exists an error will be returned.
+func (c *Client) CreateSubscription(ctx context.Context, name string, cfg SubscriptionConfig) (*Subscription, error) {
+	if cfg.Topic == nil {
+		return nil, errors.New("pubsub: CreateSubscription: missing topic")
+	}
+	if cfg.AckDeadline == 0 {
+		cfg.AckDeadline = 10 * time.Second
 	}
-	if d := ackDeadline.Seconds(); d < 10 || d > 600 {
+	if d := cfg.AckDeadline.Seconds(); d < 10 || d > 600 {
 		return nil, fmt.Errorf("ack deadline must be between 10 and 600 seconds; got: %v", d)
 	}
 
 	sub := c.Subscription(name)
-	err := c.s.createSubscription(ctx, topic.Name(), sub.Name(), ackDeadline, pushConfig)
+	err := c.s.createSubscription(ctx, sub.Name(), &cfg)
 	return sub, err
 }
@@ -16,8 +16,12 @@ package pubsub
 
 import (
 	"errors"
+	"fmt"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
+	"time"
 
 	"golang.org/x/net/context"
 )
@@ -145,3 +149,206 @@ func subNames(subs []*Subscription) []string {
 	}
 	return names
 }
+
+// receiveService delivers a fixed set of messages, and records acks.
+type receiveService struct {
+	service
+
+	mu    sync.Mutex
+	msgs  []*Message
+	acked []string
+}
+
+func (s *receiveService) fetchMessages(ctx context.Context, subName string, maxMessages int64) ([]*Message, error) {
+	s.mu.Lock()
+	n := len(s.msgs)
+	if int64(n) > maxMessages {
+		n = int(maxMessages)
+	}
+	msgs := s.msgs[:n]
+	s.msgs = s.msgs[n:]
+	s.mu.Unlock()
+	if len(msgs) > 0 {
+		return msgs, nil
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *receiveService) acknowledge(ctx context.Context, subName string, ackIDs []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, ackIDs...)
+	return nil
+}
+
+func (s *receiveService) modifyAckDeadline(ctx context.Context, subName string, deadline time.Duration, ackIDs []string) error {
+	return nil
+}
+
+func (s *receiveService) splitAckIDs(ids []string) ([]string, []string) {
+	return ids, nil
+}
+
+func newReceiveService(n int) *receiveService {
+	s := &receiveService{}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("a%02d", i)
+		s.msgs = append(s.msgs, &Message{AckID: id, Data: []byte(id)})
+	}
+	return s
+}
+
+func receiveOptions(opts ...PullOption) *pullOptions {
+	po := processPullOptions(opts)
+	po.ackDeadline = 10 * time.Second
+	return po
+}
+
+func TestReceive(t *testing.T) {
+	const n = 20
+	s := newReceiveService(n)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu   sync.Mutex
+		seen []string
+	)
+	err := receive(ctx, s, "subname", receiveOptions(), func(ctx context.Context, m *Message) {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, string(m.Data))
+		m.Done(true)
+		if len(seen) == n {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, fmt.Sprintf("a%02d", i))
+	}
+	sort.Strings(seen)
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("received: got %v, want %v", seen, want)
+	}
+	sort.Strings(s.acked)
+	if !reflect.DeepEqual(s.acked, want) {
+		t.Errorf("acked: got %v, want %v", s.acked, want)
+	}
+}
+
+func TestReceiveFlowControl(t *testing.T) {
+	const n, maxOutstanding = 20, 3
+	s := newReceiveService(n)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu                   sync.Mutex
+		outstanding, maxSeen int
+		received             int
+		wg                   sync.WaitGroup
+	)
+	opts := receiveOptions(NumGoroutines(10), MaxOutstandingMessages(maxOutstanding))
+	err := receive(ctx, s, "subname", opts, func(ctx context.Context, m *Message) {
+		mu.Lock()
+		outstanding++
+		if outstanding > maxSeen {
+			maxSeen = outstanding
+		}
+		received++
+		if received == n {
+			cancel()
+		}
+		mu.Unlock()
+
+		// Finish the message after the callback returns.
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(5 * time.Millisecond)
+			mu.Lock()
+			outstanding--
+			mu.Unlock()
+			m.Done(true)
+		}()
+	})
+	wg.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if received != n {
+		t.Errorf("received %d messages, want %d", received, n)
+	}
+	if maxSeen > maxOutstanding {
+		t.Errorf("got %d outstanding messages, want at most %d", maxSeen, maxOutstanding)
+	}
+}
+
+func TestReceiveReturnsOnCancel(t *testing.T) {
+	s := newReceiveService(0)
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	err := receive(ctx, s, "subname", receiveOptions(), func(ctx context.Context, m *Message) {
+		t.Errorf("unexpected message %q", m.Data)
+		m.Done(false)
+	})
+	if err != nil {
+		t.Errorf("got %v, want nil", err)
+	}
+}
+
+func TestReceiveOrderingKeys(t *testing.T) {
+	const keys, perKey = 3, 10
+	s := &receiveService{}
+	for i := 0; i < perKey; i++ {
+		for k := 0; k < keys; k++ {
+			id := fmt.Sprintf("%d-%02d", k, i)
+			s.msgs = append(s.msgs, &Message{AckID: id, Data: []byte(id), OrderingKey: fmt.Sprint(k)})
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		mu       sync.Mutex
+		active   = map[string]bool{}
+		received = map[string][]string{}
+		total    int
+	)
+	opts := receiveOptions(NumGoroutines(10))
+	err := receive(ctx, s, "subname", opts, func(ctx context.Context, m *Message) {
+		mu.Lock()
+		if active[m.OrderingKey] {
+			t.Errorf("concurrent handlers for key %q", m.OrderingKey)
+		}
+		active[m.OrderingKey] = true
+		mu.Unlock()
+
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		active[m.OrderingKey] = false
+		received[m.OrderingKey] = append(received[m.OrderingKey], string(m.Data))
+		total++
+		if total == keys*perKey {
+			cancel()
+		}
+		mu.Unlock()
+		m.Done(true)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k := 0; k < keys; k++ {
+		key := fmt.Sprint(k)
+		var want []string
+		for i := 0; i < perKey; i++ {
+			want = append(want, fmt.Sprintf("%d-%02d", k, i))
+		}
+		if !reflect.DeepEqual(received[key], want) {
+			t.Errorf("key %s: got %v, want %v", key, received[key], want)
+		}
+	}
+}
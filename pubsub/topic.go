@@ -16,6 +16,7 @@ package pubsub
 
 import (
 	"fmt"
+	"sync"
 
 	"golang.org/x/net/context"
 )
@@ -28,6 +29,15 @@ type Topic struct {
 
 	// The fully qualified identifier for the topic, in the format "projects/<projid>/topics/<name>"
 	name string
+
+	// PublishSettings configures the bundling of messages passed to
+	// PublishAsync. It must not be changed after the first call to
+	// PublishAsync.
+	PublishSettings PublishSettings
+
+	mu        sync.Mutex
+	publisher *publisher // created by the first call to PublishAsync
+	stopped   bool
 }
 
 // NewTopic creates a new topic.
@@ -110,9 +120,11 @@ func (t *Topic) Subscriptions(ctx context.Context) *SubscriptionIterator {
 	}
 }
 
-// Publish publishes the supplied Messages to the topic.
+// Publish publishes the supplied Messages to the topic with a single RPC.
+// To have messages bundled automatically, use PublishAsync instead.
 // If successful, the server-assigned message IDs are returned in the same order as the supplied Messages.
-// At most MaxPublishBatchSize messages may be supplied.
+// At most MaxPublishBatchSize messages may be supplied, and none may have
+// OrderingKeyAttribute in its Attributes.
 func (t *Topic) Publish(ctx context.Context, msgs ...*Message) ([]string, error) {
 	if len(msgs) == 0 {
 		return nil, nil
@@ -120,5 +132,10 @@ func (t *Topic) Publish(ctx context.Context, msgs ...*Message) ([]string, error)
 	if len(msgs) > MaxPublishBatchSize {
 		return nil, fmt.Errorf("pubsub: got %d messages, but maximum batch size is %d", len(msgs), MaxPublishBatchSize)
 	}
+	for _, m := range msgs {
+		if err := m.checkAttributes(); err != nil {
+			return nil, err
+		}
+	}
 	return t.s.publishMessages(ctx, t.name, msgs)
 }
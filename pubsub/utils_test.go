@@ -15,9 +15,15 @@
 package pubsub
 
 import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
 	"time"
 
 	"golang.org/x/net/context"
+	"google.golang.org/api/option"
 )
 
 type modDeadlineCall struct {
@@ -61,3 +67,54 @@ func (s *testService) acknowledge(ctx context.Context, subName string, ackIDs []
 func (s *testService) splitAckIDs(ids []string) ([]string, []string) {
 	return ids, nil
 }
+
+// restCall is a request received by a restServer.
+type restCall struct {
+	method, path, pageToken string
+	body                    map[string]interface{}
+}
+
+// restServer replies to each request to the REST API with the next of its
+// responses, recording the request. A response of the form
+// {"error": {"code": ...}} is sent with that status code.
+type restServer struct {
+	t         *testing.T
+	responses []string
+	calls     []restCall
+}
+
+func (rs *restServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	call := restCall{method: r.Method, path: r.URL.Path, pageToken: r.URL.Query().Get("pageToken")}
+	if b, err := ioutil.ReadAll(r.Body); err == nil && len(b) > 0 {
+		if err := json.Unmarshal(b, &call.body); err != nil {
+			rs.t.Errorf("%s %s: bad body: %v", r.Method, r.URL.Path, err)
+		}
+	}
+	rs.calls = append(rs.calls, call)
+	if len(rs.responses) == 0 {
+		rs.t.Errorf("unexpected call: %+v", call)
+		http.Error(w, "unexpected call", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	var resp struct {
+		Error *struct{ Code int }
+	}
+	if err := json.Unmarshal([]byte(rs.responses[0]), &resp); err == nil && resp.Error != nil {
+		w.WriteHeader(resp.Error.Code)
+	}
+	w.Write([]byte(rs.responses[0]))
+	rs.responses = rs.responses[1:]
+}
+
+func newRESTClient(t *testing.T, responses ...string) (*Client, *restServer, func()) {
+	rs := &restServer{t: t, responses: responses}
+	srv := httptest.NewServer(rs)
+	c, err := NewClient(context.Background(), "P",
+		option.WithEndpoint(srv.URL+"/"),
+		option.WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, rs, srv.Close
+}